@@ -0,0 +1,21 @@
+package album
+
+import (
+	"LocalDex/util"
+	"net/http"
+)
+
+// Delete removes the album in the path. Its photos stay in the library.
+func Delete(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := Remove(r.Context(), id); err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"deleted": id})
+	return nil
+}
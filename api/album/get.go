@@ -0,0 +1,38 @@
+package album
+
+import (
+	"LocalDex/util"
+	"net/http"
+)
+
+// Get returns a single album.
+func Get(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	a, err := Find(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, a)
+	return nil
+}
+
+// GetMultiple lists the albums, see ParseListQuery for the parameters.
+func GetMultiple(w http.ResponseWriter, r *http.Request) error {
+	q, err := ParseListQuery(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	page, err := List(r.Context(), q)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, page)
+	return nil
+}
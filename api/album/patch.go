@@ -0,0 +1,45 @@
+package album
+
+import (
+	"LocalDex/types"
+	"LocalDex/util"
+	"encoding/json"
+	"net/http"
+)
+
+// Patch edits the title, description, filter or cover of an album. `null`
+// unsets the cover, which then falls back to the first photo.
+func Patch(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	a, err := Find(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	// Decoding over the current values only changes what the body mentions
+	edit := albumDetails{Title: a.Title, Description: a.Description, Filter: a.Filter, CoverPhotoID: a.CoverPhotoID}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&edit); err != nil {
+		return types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+	if err := edit.validate(a.Smart); err != nil {
+		return err
+	}
+
+	a.Title, a.Description, a.Filter, a.CoverPhotoID = edit.Title, edit.Description, edit.Filter, edit.CoverPhotoID
+	if err := Update(r.Context(), a); err != nil {
+		return err
+	}
+
+	if a, err = Find(r.Context(), id); err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, a)
+	return nil
+}
@@ -0,0 +1,143 @@
+package album
+
+import (
+	"LocalDex/types"
+	"LocalDex/util"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// decodeIDs reads the photo IDs of a request body, which may name where they
+// go with `position`.
+func decodeIDs(w http.ResponseWriter, r *http.Request) ([]int64, *int, error) {
+	var req struct {
+		IDs      []int64 `json:"ids"`
+		Position *int    `json:"position"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return nil, nil, types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+
+	var details []types.FieldError
+	if len(req.IDs) == 0 {
+		details = append(details, types.FieldError{Field: "ids", Code: "required", Message: "must list at least one ID"})
+	}
+	if len(req.IDs) > util.MaxBulkIDs {
+		details = append(details, types.FieldError{Field: "ids", Code: "invalid", Message: "must not list more than " + strconv.Itoa(util.MaxBulkIDs) + " IDs"})
+	}
+	if req.Position != nil && *req.Position < 0 {
+		details = append(details, types.FieldError{Field: "position", Code: "out_of_range", Message: "must not be negative"})
+	}
+	if len(details) != 0 {
+		return nil, nil, types.ErrValidation("Invalid list of IDs!", details...)
+	}
+	return req.IDs, req.Position, nil
+}
+
+// findAlbum loads the album in the path.
+func findAlbum(r *http.Request) (*types.Album, error) {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	return Find(r.Context(), id)
+}
+
+// GetPhotos lists the photos of an album, with the parameters of photo
+// listings. Manual albums are in their own order unless sorted otherwise.
+func GetPhotos(w http.ResponseWriter, r *http.Request) error {
+	a, err := findAlbum(r)
+	if err != nil {
+		return err
+	}
+
+	q, err := ParsePhotosQuery(a, r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	page, err := Photos(r.Context(), a, q)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, page)
+	return nil
+}
+
+// PostPhotos adds the photos listed in the body to a manual album, at
+// `position` or at the end. Photos that aren't live or already in the album
+// are skipped; the response lists the rest.
+func PostPhotos(w http.ResponseWriter, r *http.Request) error {
+	a, err := findAlbum(r)
+	if err != nil {
+		return err
+	}
+
+	ids, position, err := decodeIDs(w, r)
+	if err != nil {
+		return err
+	}
+
+	at := -1
+	if position != nil {
+		at = *position
+	}
+	added, err := AddPhotos(r.Context(), a, ids, at)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"added": added})
+	return nil
+}
+
+// DeletePhotos takes the photos listed in `ids` out of a manual album. They
+// stay in the library.
+func DeletePhotos(w http.ResponseWriter, r *http.Request) error {
+	a, err := findAlbum(r)
+	if err != nil {
+		return err
+	}
+
+	ids, err := util.ParseIDs(r.URL.Query().Get("ids"), "ids")
+	if err != nil {
+		return err
+	}
+
+	removed, err := RemovePhotos(r.Context(), a, ids)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"removed": removed})
+	return nil
+}
+
+// PutOrder moves the photos listed in the body to the front of a manual
+// album, in that order. The rest keep their order after them.
+func PutOrder(w http.ResponseWriter, r *http.Request) error {
+	a, err := findAlbum(r)
+	if err != nil {
+		return err
+	}
+
+	ids, position, err := decodeIDs(w, r)
+	if err != nil {
+		return err
+	}
+	if position != nil {
+		return types.ErrValidation("Invalid list of IDs!", types.FieldError{Field: "position", Code: "invalid", Message: "isn't used when reordering"})
+	}
+
+	order, err := Reorder(r.Context(), a, ids)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"order": order})
+	return nil
+}
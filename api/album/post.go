@@ -0,0 +1,86 @@
+package album
+
+import (
+	"LocalDex/api/photo"
+	"LocalDex/types"
+	"LocalDex/util"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// albumDetails is the editable part of an album. Fields left out of a PATCH
+// body keep their value.
+type albumDetails struct {
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	Filter       string `json:"filter"`
+	CoverPhotoID *int64 `json:"cover_photo_id"`
+}
+
+func (d *albumDetails) validate(smart bool) error {
+	d.Title = strings.TrimSpace(d.Title)
+	d.Filter = strings.TrimSpace(d.Filter)
+
+	var details []types.FieldError
+	if len(d.Title) == 0 {
+		details = append(details, types.FieldError{Field: "title", Code: "required", Message: "must not be empty"})
+	}
+	if smart && len(d.Filter) == 0 {
+		details = append(details, types.FieldError{Field: "filter", Code: "required", Message: "must not be empty for smart albums"})
+	}
+	if !smart && len(d.Filter) != 0 {
+		details = append(details, types.FieldError{Field: "filter", Code: "invalid", Message: "only smart albums have a filter"})
+	}
+	if len(details) != 0 {
+		return types.ErrValidation("Invalid album!", details...)
+	}
+
+	return photo.CheckFilter(d.Filter)
+}
+
+// Post creates an album. Smart albums are defined by `filter`, in the syntax
+// of photo listings; manual ones start out with the photos in `photo_ids`.
+func Post(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		albumDetails
+		Smart    bool    `json:"smart"`
+		PhotoIDs []int64 `json:"photo_ids"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+
+	if err := req.validate(req.Smart); err != nil {
+		return err
+	}
+	if req.Smart && len(req.PhotoIDs) != 0 {
+		return types.ErrValidation("Invalid album!", types.FieldError{Field: "photo_ids", Code: "invalid", Message: "smart albums can't list photos"})
+	}
+	if len(req.PhotoIDs) > util.MaxBulkIDs {
+		return types.ErrValidation("Invalid album!", types.FieldError{Field: "photo_ids", Code: "invalid", Message: "must not list more than " + strconv.Itoa(util.MaxBulkIDs) + " IDs"})
+	}
+
+	a := &types.Album{
+		Title:        req.Title,
+		Description:  req.Description,
+		Smart:        req.Smart,
+		Filter:       req.Filter,
+		CoverPhotoID: req.CoverPhotoID,
+	}
+	if err := Create(r.Context(), a, req.PhotoIDs); err != nil {
+		return err
+	}
+
+	// Count the photos and resolve the cover
+	a, err := Find(r.Context(), a.ID)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusCreated, a)
+	return nil
+}
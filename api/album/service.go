@@ -0,0 +1,206 @@
+package album
+
+import (
+	"LocalDex/api/photo"
+	"LocalDex/db"
+	"LocalDex/types"
+	"LocalDex/util"
+	"context"
+	"errors"
+	"net/url"
+	"slices"
+)
+
+// ParseListQuery validates the query string of the album listing.
+func ParseListQuery(values url.Values) (types.ListQuery, error) {
+	return util.ParseListQuery(values, db.AlbumSorts.Keys())
+}
+
+// List returns one page of albums.
+func List(ctx context.Context, q types.ListQuery) (*types.Page[types.Album], error) {
+	items, total, err := db.ListAlbums(ctx, q)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to list albums!").WithCause(err)
+	}
+	return types.NewPage(items, q, total), nil
+}
+
+// Find returns an album with its photo count and cover.
+func Find(ctx context.Context, id int64) (*types.Album, error) {
+	a, err := db.GetAlbum(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Album not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to load album!").WithCause(err)
+	}
+	return a, nil
+}
+
+// errSmartAlbum rejects changes to the photos of a smart album, which follow
+// from its filter.
+func errSmartAlbum() error {
+	return types.ErrConflict("The photos of a smart album follow from its filter!")
+}
+
+// ParsePhotosQuery validates the query string of an album's photo listing.
+// Manual albums also sort by their own order, which is their default.
+func ParsePhotosQuery(a *types.Album, values url.Values) (types.ListQuery, error) {
+	sorts := db.PhotoSorts.Keys()
+	if !a.Smart {
+		sorts = db.AlbumPhotoSorts.Keys()
+	}
+
+	q, err := util.ParseListQuery(values, sorts)
+	if err != nil {
+		return q, err
+	}
+	return q, photo.CheckFilter(q.Filter)
+}
+
+// Photos returns one page of the photos of an album. Smart albums are
+// evaluated as they are listed.
+func Photos(ctx context.Context, a *types.Album, q types.ListQuery) (*types.Page[types.Photo], error) {
+	items, total, err := db.ListAlbumPhotos(ctx, a, q)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to list album photos!").WithCause(err)
+	}
+	return types.NewPage(items, q, total), nil
+}
+
+// checkCover makes sure the chosen cover of an album is one of its photos.
+// A new manual album isn't saved yet, so its cover must be one of the live
+// photos it is created with.
+func checkCover(ctx context.Context, a *types.Album, photoIDs []int64) error {
+	if a.CoverPhotoID == nil {
+		return nil
+	}
+
+	var (
+		found bool
+		err   error
+	)
+	if a.ID == 0 && !a.Smart {
+		if slices.Contains(photoIDs, *a.CoverPhotoID) {
+			_, err = db.GetPhoto(ctx, *a.CoverPhotoID)
+			found = err == nil
+			if errors.Is(err, db.ErrNotFound) || errors.Is(err, db.ErrDeleted) {
+				err = nil
+			}
+		}
+	} else {
+		found, err = db.AlbumContains(ctx, a, *a.CoverPhotoID)
+	}
+
+	if err != nil {
+		return types.ErrInternal("Failed to check album cover!").WithCause(err)
+	}
+	if !found {
+		return types.ErrValidation("Invalid album!", types.FieldError{
+			Field:   "cover_photo_id",
+			Code:    "invalid",
+			Message: "must be a photo in the album",
+		})
+	}
+	return nil
+}
+
+// Create adds a new album, with the listed photos when it is a manual one.
+func Create(ctx context.Context, a *types.Album, photoIDs []int64) error {
+	if err := checkCover(ctx, a, photoIDs); err != nil {
+		return err
+	}
+
+	if err := db.CreateAlbum(ctx, a, photoIDs); err != nil {
+		return types.ErrInternal("Failed to save album!").WithCause(err)
+	}
+	return nil
+}
+
+// Update saves the details of an album.
+func Update(ctx context.Context, a *types.Album) error {
+	if err := checkCover(ctx, a, nil); err != nil {
+		return err
+	}
+
+	err := db.UpdateAlbum(ctx, a)
+	if errors.Is(err, db.ErrNotFound) {
+		return types.ErrNotFound("Album not found!")
+	}
+	if err != nil {
+		return types.ErrInternal("Failed to update album!").WithCause(err)
+	}
+	return nil
+}
+
+// Remove deletes an album, leaving its photos in the library.
+func Remove(ctx context.Context, id int64) error {
+	err := db.DeleteAlbum(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return types.ErrNotFound("Album not found!")
+	}
+	if err != nil {
+		return types.ErrInternal("Failed to delete album!").WithCause(err)
+	}
+	return nil
+}
+
+// AddPhotos adds live photos to a manual album at position, or at the end
+// when it is negative, and returns the IDs that were added.
+func AddPhotos(ctx context.Context, a *types.Album, ids []int64, position int) ([]int64, error) {
+	if a.Smart {
+		return nil, errSmartAlbum()
+	}
+
+	added, err := db.AddAlbumPhotos(ctx, a.ID, ids, position)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Album not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to add photos to album!").WithCause(err)
+	}
+	if added == nil {
+		added = []int64{}
+	}
+	return added, nil
+}
+
+// RemovePhotos takes photos out of a manual album and returns the IDs that
+// were removed.
+func RemovePhotos(ctx context.Context, a *types.Album, ids []int64) ([]int64, error) {
+	if a.Smart {
+		return nil, errSmartAlbum()
+	}
+
+	removed, err := db.RemoveAlbumPhotos(ctx, a.ID, ids)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Album not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to remove photos from album!").WithCause(err)
+	}
+	if removed == nil {
+		removed = []int64{}
+	}
+	return removed, nil
+}
+
+// Reorder moves the listed photos of a manual album to the front and returns
+// the new order.
+func Reorder(ctx context.Context, a *types.Album, ids []int64) ([]int64, error) {
+	if a.Smart {
+		return nil, errSmartAlbum()
+	}
+
+	order, err := db.ReorderAlbumPhotos(ctx, a.ID, ids)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Album not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to reorder album!").WithCause(err)
+	}
+	if order == nil {
+		order = []int64{}
+	}
+	return order, nil
+}
@@ -1,7 +1,24 @@
 package anime
 
-import "net/http"
+import (
+	"LocalDex/util"
+	"net/http"
+)
 
-func Delete(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Delete Anime"))
+// Delete moves the anime in the path, with its episodes, to the trash.
+func Delete(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err := Find(r.Context(), id, true); err != nil {
+		return err
+	}
+
+	if err := Remove(r.Context(), id); err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"deleted": id})
+	return nil
 }
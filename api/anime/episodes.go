@@ -0,0 +1,28 @@
+package anime
+
+import (
+	"LocalDex/api/auth"
+	"LocalDex/util"
+	"net/http"
+)
+
+// GetEpisodes lists the episodes of an anime.
+func GetEpisodes(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	a, err := Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return err
+	}
+
+	episodes, err := Episodes(r.Context(), a.ID)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, episodes)
+	return nil
+}
@@ -1,11 +1,39 @@
 package anime
 
-import "net/http"
+import (
+	"LocalDex/api/auth"
+	"LocalDex/util"
+	"net/http"
+)
 
-func Get(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Get Anime"))
+// Get returns a single anime.
+func Get(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	a, err := Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, a)
+	return nil
 }
 
-func GetMultiple(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Get Multiple Anime"))
+// GetMultiple lists the anime library, see ParseListQuery for the parameters.
+func GetMultiple(w http.ResponseWriter, r *http.Request) error {
+	q, err := ParseListQuery(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	page, err := List(r.Context(), q)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, page)
+	return nil
 }
@@ -1,7 +1,55 @@
 package anime
 
-import "net/http"
+import (
+	"LocalDex/types"
+	"LocalDex/util"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
 
-func Post(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Post Anime"))
+// Post adds a new anime series. Episodes are added through resumable uploads,
+// see the upload package.
+func Post(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		Title       string   `json:"title"`
+		Type        string   `json:"type"`
+		Description string   `json:"description"`
+		Status      string   `json:"status"`
+		AltTitles   []string `json:"alt_titles"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+
+	a := &types.Anime{
+		Title:       strings.TrimSpace(req.Title),
+		Type:        req.Type,
+		Description: req.Description,
+		Status:      req.Status,
+		AltTitles:   util.CleanTitles(req.AltTitles),
+	}
+	if len(a.Type) == 0 {
+		a.Type = types.AnimeTypeAnime
+	}
+
+	var details []types.FieldError
+	if len(a.Title) == 0 {
+		details = append(details, types.FieldError{Field: "title", Code: "required", Message: "must not be empty"})
+	}
+	if a.Type != types.AnimeTypeAnime && a.Type != types.AnimeTypeHentai {
+		details = append(details, types.FieldError{Field: "type", Code: "invalid", Message: "must be " + types.AnimeTypeAnime + " or " + types.AnimeTypeHentai})
+	}
+	if len(details) != 0 {
+		return types.ErrValidation("Invalid anime!", details...)
+	}
+
+	if err := Create(r.Context(), a); err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusCreated, a)
+	return nil
 }
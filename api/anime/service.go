@@ -0,0 +1,212 @@
+package anime
+
+import (
+	"LocalDex/db"
+	"LocalDex/mediainfo"
+	"LocalDex/types"
+	"LocalDex/util"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// INFO: Service calls shared by the JSON API and the SSR loaders, so a page
+// preloads exactly what the client would otherwise fetch.
+
+// ParseListQuery validates the query string of an anime listing.
+func ParseListQuery(values url.Values) (types.ListQuery, error) {
+	q, err := util.ParseListQuery(values, db.AnimeSorts.Keys(), types.AnimeTypeAnime, types.AnimeTypeHentai)
+	if err != nil {
+		return q, err
+	}
+	return q, util.FilterError(db.CheckFilter(types.MediaAnime, q.Filter))
+}
+
+// List returns one page of the anime library.
+func List(ctx context.Context, q types.ListQuery) (*types.Page[types.Anime], error) {
+	items, total, err := db.ListAnime(ctx, q)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to list anime!").WithCause(err)
+	}
+	return types.NewPage(items, q, total), nil
+}
+
+// Find returns a live anime. NSFW entries are only handed out to signed-in
+// users.
+func Find(ctx context.Context, id int64, authenticated bool) (*types.Anime, error) {
+	a, err := db.GetAnime(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Anime not found!")
+	}
+	if errors.Is(err, db.ErrDeleted) {
+		return nil, types.ErrGone("Anime was deleted!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to load anime!").WithCause(err)
+	}
+	if a.NSFW() && !authenticated {
+		return nil, types.ErrForbidden(types.ErrCodeNSFWLocked, "Sign in to view this anime.")
+	}
+	return a, nil
+}
+
+// Remove moves an anime to the trash.
+func Remove(ctx context.Context, id int64) error {
+	if _, err := db.SoftDeleteItems(ctx, types.MediaAnime, []int64{id}); err != nil {
+		return types.ErrInternal("Failed to delete anime!").WithCause(err)
+	}
+	return nil
+}
+
+// Create adds a new anime series.
+func Create(ctx context.Context, a *types.Anime) error {
+	if err := db.CreateAnime(ctx, a); err != nil {
+		return types.ErrInternal("Failed to save anime!").WithCause(err)
+	}
+	return nil
+}
+
+// Episodes lists the episodes of an anime.
+func Episodes(ctx context.Context, animeID int64) ([]types.AnimeEpisode, error) {
+	episodes, err := db.ListEpisodes(ctx, animeID)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to list episodes!").WithCause(err)
+	}
+	return episodes, nil
+}
+
+// episodeDir is where the episode files of an anime are kept.
+func episodeDir(animeID int64) string {
+	return filepath.Join(os.Getenv("APP_ROOT"), "library", "anime", strconv.FormatInt(animeID, 10))
+}
+
+// describeEpisode reads the type, size and length of a video on disk.
+func describeEpisode(path string) (*types.AnimeEpisode, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to open file!").WithCause(err)
+	}
+
+	e := &types.AnimeEpisode{FilePath: path, Size: stat.Size()}
+	info, err := mediainfo.Extract(path)
+	if err == nil && strings.HasPrefix(info.MimeType, "video/") {
+		e.MimeType, e.Duration = info.MimeType, info.Duration
+		return e, nil
+	}
+
+	// Matroska and friends aren't parsed, but still play in browsers
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to open file!").WithCause(err)
+	}
+	head := make([]byte, 512)
+	n, _ := f.Read(head)
+	f.Close()
+
+	e.MimeType = http.DetectContentType(head[:n])
+	if !strings.HasPrefix(e.MimeType, "video/") {
+		return nil, types.NewAPIError(http.StatusUnsupportedMediaType, types.ErrCodeUnsupportedMedia, "Episodes must be video files!")
+	}
+	return e, nil
+}
+
+// createEpisode saves a described episode as episode number of an anime.
+func createEpisode(ctx context.Context, e *types.AnimeEpisode) error {
+	err := db.CreateEpisode(ctx, e)
+	if errors.Is(err, db.ErrConflict) {
+		return types.ErrConflict(fmt.Sprintf("Episode %d already exists!", e.Number))
+	}
+	if err != nil {
+		return types.ErrInternal("Failed to save episode!").WithCause(err)
+	}
+	return nil
+}
+
+// ImportEpisode adds a video on disk, such as a finished resumable upload, as
+// episode number of an anime. The file is moved into the library; it stays
+// where it is when the import fails.
+func ImportEpisode(ctx context.Context, animeID int64, number int, title string, path string, filename string) (*types.AnimeEpisode, error) {
+	if _, err := Find(ctx, animeID, true); err != nil {
+		return nil, err
+	}
+
+	e, err := describeEpisode(path)
+	if err != nil {
+		return nil, err
+	}
+	e.AnimeID, e.Number, e.Title = animeID, number, title
+
+	if err := os.MkdirAll(episodeDir(animeID), 0755); err != nil {
+		return nil, types.ErrInternal("Failed to prepare anime storage!").WithCause(err)
+	}
+	e.FilePath = filepath.Join(episodeDir(animeID), fmt.Sprintf("episode-%04d%s", number, strings.ToLower(filepath.Ext(filename))))
+	if _, err := os.Stat(e.FilePath); err == nil {
+		return nil, types.ErrConflict(fmt.Sprintf("Episode %d already exists!", number))
+	}
+	if err := os.Rename(path, e.FilePath); err != nil {
+		return nil, types.ErrInternal("Failed to store episode!").WithCause(err)
+	}
+
+	if err := createEpisode(ctx, e); err != nil {
+		os.Rename(e.FilePath, path)
+		return nil, err
+	}
+	return e, nil
+}
+
+// FindOrCreate returns the anime of a type with the given title, adding it
+// when the library has none yet.
+func FindOrCreate(ctx context.Context, title string, animeType string) (*types.Anime, error) {
+	a, err := db.AnimeByTitle(ctx, title, animeType)
+	if err == nil {
+		return a, nil
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrInternal("Failed to load anime!").WithCause(err)
+	}
+
+	a = &types.Anime{Title: title, Type: animeType}
+	if err := Create(ctx, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// IndexEpisode adds a video from a library root as episode number of an
+// anime without moving it.
+func IndexEpisode(ctx context.Context, animeID int64, number int, path string) (*types.AnimeEpisode, error) {
+	e, err := describeEpisode(path)
+	if err != nil {
+		return nil, err
+	}
+	e.AnimeID, e.Number = animeID, number
+
+	if err := createEpisode(ctx, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// RefreshEpisode rereads the file of an indexed episode that changed on disk.
+func RefreshEpisode(ctx context.Context, id int64, path string) (*types.AnimeEpisode, error) {
+	e, err := describeEpisode(path)
+	if err != nil {
+		return nil, err
+	}
+	e.ID = id
+
+	err = db.UpdateEpisodeFile(ctx, e)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Episode not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to save episode!").WithCause(err)
+	}
+	return e, nil
+}
@@ -0,0 +1,62 @@
+package anime
+
+import (
+	"LocalDex/api/tag"
+	"LocalDex/types"
+	"LocalDex/util"
+	"encoding/json"
+	"net/http"
+)
+
+// GetTags lists the tags of the anime in the path.
+func GetTags(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err := Find(r.Context(), id, true); err != nil {
+		return err
+	}
+
+	tags, err := tag.ItemTags(r.Context(), types.MediaAnime, id)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, tags)
+	return nil
+}
+
+// PutTags replaces the tags of the anime in the path with those in the
+// body, plus the tags they imply. Missing tags are created.
+func PutTags(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+	if _, err := Find(r.Context(), id, true); err != nil {
+		return err
+	}
+
+	var req struct {
+		Tags []string `json:"tags"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+
+	parsed, err := tag.ParseTags(req.Tags, "tags")
+	if err != nil {
+		return err
+	}
+
+	tags, err := tag.SetItemTags(r.Context(), types.MediaAnime, id, parsed)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, tags)
+	return nil
+}
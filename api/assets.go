@@ -0,0 +1,257 @@
+package api
+
+import (
+	vars "LocalDex"
+	"LocalDex/logger"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// INFO: Cache policies for embedded files.
+//   - Vite emits content-hashed chunk names, so those can be cached forever.
+//   - The service worker, the manifest and the HTML shell keep stable names and
+//     must be revalidated, otherwise clients never see a new deployment.
+//   - Everything else (icons, splash screens) may be cached for a day and is
+//     then revalidated cheaply through its ETag.
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+	cacheShortLived = "public, max-age=86400"
+)
+
+const (
+	assetsFSKey    = "assets"
+	viteFSKey      = "vite"
+	viteDistPrefix = "client/dist/"
+)
+
+var revalidatedAssets = map[string]bool{
+	"assets/sw.js":           true,
+	"assets/manifest.json":   true,
+	"client/dist/index.html": true,
+}
+
+// Vite writes the chunks it hashes to its assetsDir, `src` in
+// client/vite.config.ts, as `name-<8 character hash>.ext`. Files copied from
+// public/ keep their names and land next to index.html, so a name like
+// apple-touch-icon.png is never taken for a hashed one.
+const viteAssetsPrefix = viteDistPrefix + "src/"
+
+var hashedAssetName = regexp.MustCompile(`-[A-Za-z0-9_-]{8}\.[A-Za-z0-9]+$`)
+
+func cachePolicyFor(name string) string {
+	if revalidatedAssets[name] {
+		return cacheRevalidate
+	}
+	if strings.HasPrefix(name, viteAssetsPrefix) && hashedAssetName.MatchString(path.Base(name)) {
+		return cacheImmutable
+	}
+	return cacheShortLived
+}
+
+// INFO: An embedded file together with its content hash and lazily built
+// compressed variants. The embedded filesystems never change at runtime, so
+// each variant is produced at most once and then served straight from memory.
+type embeddedAsset struct {
+	content      []byte
+	mimeType     string
+	hash         string
+	cacheControl string
+
+	mu       sync.Mutex
+	variants map[string][]byte
+}
+
+// etag returns the strong validator for the identity body or for one of its
+// compressed variants. Each representation needs its own strong ETag.
+func (a *embeddedAsset) etag(encoding string) string {
+	if len(encoding) == 0 {
+		return `"` + a.hash + `"`
+	}
+	return `"` + a.hash + "-" + encoding + `"`
+}
+
+// variant returns the asset compressed with the given coding, or nil when the
+// compressed form would not be smaller than the original.
+func (a *embeddedAsset) variant(encoding string) []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if v, ok := a.variants[encoding]; ok {
+		return v
+	}
+
+	compressed, err := compressBytes(encoding, a.content)
+	if err != nil {
+		logger.TimedError("failed to precompress embedded asset:\n    " + err.Error())
+		compressed = nil
+	} else if len(compressed) >= len(a.content) {
+		compressed = nil
+	}
+
+	a.variants[encoding] = compressed
+	return compressed
+}
+
+// Index of every embedded file, keyed by "<fs>:<path>". Built once by
+// IndexEmbeddedAssets and read-only afterwards.
+var (
+	assetIndex     = make(map[string]*embeddedAsset)
+	assetIndexOnce sync.Once
+)
+
+func newEmbeddedAsset(name string, content []byte) *embeddedAsset {
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+	if len(mimeType) == 0 {
+		mimeType = "application/octet-stream"
+	}
+
+	sum := sha256.Sum256(content)
+
+	return &embeddedAsset{
+		content:      content,
+		mimeType:     mimeType,
+		hash:         hex.EncodeToString(sum[:16]),
+		cacheControl: cachePolicyFor(name),
+		variants:     make(map[string][]byte),
+	}
+}
+
+// IndexEmbeddedAssets hashes every file of both embedded filesystems. It is
+// safe to call more than once; only the first call does any work.
+func IndexEmbeddedAssets() {
+	assetIndexOnce.Do(func() {
+		roots := []struct {
+			key  string
+			fsys fs.FS
+			dir  string
+		}{
+			{assetsFSKey, vars.AssetsFS, "assets"},
+			{viteFSKey, vars.ViteFS, "client/dist"},
+		}
+
+		for _, root := range roots {
+			err := fs.WalkDir(root.fsys, root.dir, func(name string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+
+				content, err := fs.ReadFile(root.fsys, name)
+				if err != nil {
+					return err
+				}
+
+				assetIndex[root.key+":"+name] = newEmbeddedAsset(name, content)
+				return nil
+			})
+			if err != nil {
+				logger.TimedError("failed to index embedded assets in `" + root.dir + "`:\n    " + err.Error())
+			}
+		}
+
+		logger.TimedOkay("Indexed", len(assetIndex), "embedded assets.")
+	})
+}
+
+func lookupEmbeddedAsset(fsKey string, name string) (*embeddedAsset, bool) {
+	IndexEmbeddedAssets()
+	asset, ok := assetIndex[fsKey+":"+name]
+	return asset, ok
+}
+
+// PrecompressEmbeddedAssets builds every compressed variant up front, so the
+// first visitor doesn't pay for it.
+func PrecompressEmbeddedAssets() {
+	IndexEmbeddedAssets()
+
+	count := 0
+	for _, asset := range assetIndex {
+		if len(asset.content) < minCompressSize || !isCompressibleType(asset.mimeType) {
+			continue
+		}
+
+		for _, encoding := range supportedEncodings {
+			asset.variant(encoding)
+		}
+		count++
+	}
+
+	logger.TimedOkay("Precompressed", count, "embedded assets.")
+}
+
+// etagMatches reports whether an If-None-Match header matches any of the given
+// validators. If-None-Match uses the weak comparison function, so W/ prefixes
+// are ignored on both sides.
+func etagMatches(ifNoneMatch string, etags ...string) bool {
+	if len(ifNoneMatch) == 0 {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		for _, etag := range etags {
+			if candidate == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveEmbeddedAsset writes an embedded file, using a cached precompressed
+// variant whenever the client accepts one and answering conditional requests
+// with 304 Not Modified.
+func serveEmbeddedAsset(w http.ResponseWriter, r *http.Request, asset *embeddedAsset, mimeType string) {
+	if len(mimeType) == 0 {
+		mimeType = asset.mimeType
+	}
+
+	body := asset.content
+	encoding := ""
+	addVary(w.Header(), "Accept-Encoding")
+
+	if len(body) >= minCompressSize && isCompressibleType(mimeType) {
+		if negotiated := NegotiateEncoding(r.Header.Get("Accept-Encoding")); len(negotiated) != 0 {
+			if compressed := asset.variant(negotiated); compressed != nil {
+				body = compressed
+				encoding = negotiated
+			}
+		}
+	}
+
+	w.Header().Set("ETag", asset.etag(encoding))
+	w.Header().Set("Cache-Control", asset.cacheControl)
+
+	// Any representation of the same content is still fresh for the client.
+	validators := []string{asset.etag("")}
+	for _, enc := range supportedEncodings {
+		validators = append(validators, asset.etag(enc))
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), validators...) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if len(encoding) != 0 {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
@@ -2,12 +2,15 @@ package auth
 
 import (
 	"LocalDex/logger"
+	"LocalDex/types"
+	"LocalDex/util"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"gopkg.in/gomail.v2"
 	"net/http"
@@ -35,6 +38,11 @@ var authTokens = struct {
 	m map[string]time.Time
 }{m: make(map[string]time.Time)}
 
+var (
+	ErrTokenNotFound = errors.New("token not found")
+	ErrTokenExpired  = errors.New("token expired")
+)
+
 type otpEntry struct {
 	Code      string
 	ExpiresAt time.Time
@@ -220,30 +228,26 @@ func buildEmailBody(otp string, expMinutes int) string {
 }
 
 // SendOTPHandler validates email+password, generates an OTP, emails it, and stores it.
-func SendOTPHandler(w http.ResponseWriter, r *http.Request) {
+func SendOTPHandler(w http.ResponseWriter, r *http.Request) error {
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
-		return
+		return types.ErrBadRequest("invalid request body")
 	}
 	if len(os.Getenv("ADMIN_EMAIL")) == 0 {
-		http.Error(w, "internal server", http.StatusInternalServerError)
-		return
+		return types.ErrInternal("").WithCause(errors.New("admin email isn't set properly"))
 	}
 
 	// verify admin credentials
 	if req.Email != os.Getenv("ADMIN_EMAIL") || !verifyPassword(req.Password) {
-		http.Error(w, "invalid credentials", http.StatusUnauthorized)
-		return
+		return types.ErrUnauthorized(types.ErrCodeInvalidCredentials, "invalid credentials")
 	}
 
 	otp, err := generateSecureToken(6) // 12-char hex
 	if err != nil {
-		http.Error(w, "failed to generate OTP", http.StatusInternalServerError)
-		return
+		return types.ErrInternal("failed to generate OTP").WithCause(err)
 	}
 	var (
 		smtpHost = os.Getenv("SMTP_HOST")
@@ -252,9 +256,7 @@ func SendOTPHandler(w http.ResponseWriter, r *http.Request) {
 		smtpPass = os.Getenv("SMTP_PASS")
 	)
 	if len(smtpHost) == 0 || len(smtpPort) == 0 || len(smtpUser) == 0 || len(smtpPass) == 0 {
-		logger.TimedError("smpt not set up correctly")
-		http.Error(w, "internal server", http.StatusInternalServerError)
-		return
+		return types.ErrInternal("").WithCause(errors.New("smtp not set up correctly"))
 	}
 
 	// store OTP
@@ -270,9 +272,7 @@ func SendOTPHandler(w http.ResponseWriter, r *http.Request) {
 	port, err := strconv.Atoi(smtpPort)
 
 	if err != nil {
-		logger.TimedError("Failed to parse port integer", "\n    ", err.Error())
-		http.Error(w, "Something went wrong!", http.StatusInternalServerError)
-		return
+		return types.ErrInternal("Something went wrong!").WithCause(fmt.Errorf("failed to parse smtp port: %w", err))
 	}
 
 	smptProvider := SMTP{
@@ -288,24 +288,21 @@ func SendOTPHandler(w http.ResponseWriter, r *http.Request) {
 		Subject: subject,
 		Body:    body,
 	}); err != nil {
-		logger.TimedInfo("failed to send OTP email: " + err.Error())
-		http.Error(w, "failed to send OTP", http.StatusInternalServerError)
-		return
+		return types.NewAPIError(http.StatusBadGateway, types.ErrCodeInternal, "failed to send OTP").WithCause(err)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message":"OTP sent"}`))
+	util.WriteJSON(w, http.StatusOK, map[string]string{"message": "OTP sent"})
+	return nil
 }
 
 // VerifyOTPHandler checks the OTP and, if valid, issues a session cookie.
-func VerifyOTPHandler(w http.ResponseWriter, r *http.Request) {
+func VerifyOTPHandler(w http.ResponseWriter, r *http.Request) error {
 	var req struct {
 		Email string `json:"email"`
 		OTP   string `json:"otp"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request", http.StatusBadRequest)
-		return
+		return types.ErrBadRequest("invalid request body")
 	}
 
 	// verify OTP
@@ -313,8 +310,7 @@ func VerifyOTPHandler(w http.ResponseWriter, r *http.Request) {
 	entry, ok := otpStore.m[req.Email]
 	otpStore.RUnlock()
 	if !ok || time.Now().After(entry.ExpiresAt) || entry.Code != req.OTP {
-		http.Error(w, "invalid or expired OTP", http.StatusUnauthorized)
-		return
+		return types.ErrUnauthorized(types.ErrCodeInvalidOTP, "invalid or expired OTP")
 	}
 
 	// consume OTP
@@ -325,8 +321,7 @@ func VerifyOTPHandler(w http.ResponseWriter, r *http.Request) {
 	// issue session token
 	token, err := generateSecureToken(32) // 64-char hex
 	if err != nil {
-		http.Error(w, "failed to generate session token", http.StatusInternalServerError)
-		return
+		return types.ErrInternal("failed to generate session token").WithCause(err)
 	}
 	expiry := time.Now().Add(sessionValidity)
 
@@ -344,8 +339,18 @@ func VerifyOTPHandler(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteStrictMode,
 	})
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"message":"authenticated"}`))
+	// rotate the CSRF token, the pre-login one was bound to the anonymous session
+	csrfToken, err := NewCSRFToken(token)
+	if err != nil {
+		return types.ErrInternal("failed to generate CSRF token").WithCause(err)
+	}
+	setCSRFCookie(w, csrfToken)
+
+	util.WriteJSON(w, http.StatusOK, map[string]string{
+		"message":    "authenticated",
+		"csrf_token": csrfToken,
+	})
+	return nil
 }
 
 // VerifyAuthToken checks and renews a session token.
@@ -354,13 +359,13 @@ func VerifyAuthToken(token string) error {
 	exp, ok := authTokens.m[token]
 	authTokens.RUnlock()
 	if !ok {
-		return fmt.Errorf("token not found")
+		return ErrTokenNotFound
 	}
 	if time.Now().After(exp) {
 		authTokens.Lock()
 		delete(authTokens.m, token)
 		authTokens.Unlock()
-		return fmt.Errorf("token expired")
+		return ErrTokenExpired
 	}
 
 	// renew
@@ -371,22 +376,44 @@ func VerifyAuthToken(token string) error {
 	return nil
 }
 
-// VerifyAuthStatus is a protected handler to check/renew the session cookie.
-func VerifyAuthStatus(w http.ResponseWriter, r *http.Request) {
+// RequireSession validates (and renews) the session of a request, returning
+// the matching 401 problem when there is none.
+func RequireSession(r *http.Request) error {
 	c, err := r.Cookie("auth_token")
 	if err != nil {
-		http.Error(w, "missing auth token", http.StatusForbidden)
-		return
+		return types.ErrUnauthorized(types.ErrCodeSessionMissing, "missing auth token")
 	}
 
 	if err := VerifyAuthToken(c.Value); err != nil {
-		if err.Error() == "token expired" {
-			http.Error(w, err.Error(), 498)
-		} else {
-			http.Error(w, err.Error(), http.StatusForbidden)
+		if errors.Is(err, ErrTokenExpired) {
+			return types.ErrUnauthorized(types.ErrCodeSessionExpired, err.Error())
 		}
-		return
+		return types.ErrUnauthorized(types.ErrCodeSessionInvalid, err.Error())
 	}
+	return nil
+}
+
+// IsAuthenticated reports whether the request carries a valid session.
+func IsAuthenticated(r *http.Request) bool {
+	return RequireSession(r) == nil
+}
+
+// Protected wraps an API handler so it only runs for signed-in users.
+func Protected(handler types.APIHandler) types.APIHandler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		if err := RequireSession(r); err != nil {
+			return err
+		}
+		return handler(w, r)
+	}
+}
+
+// VerifyAuthStatus is a protected handler to check/renew the session cookie.
+func VerifyAuthStatus(w http.ResponseWriter, r *http.Request) error {
+	if err := RequireSession(r); err != nil {
+		return err
+	}
+	c, _ := r.Cookie("auth_token")
 
 	// renew cookie
 	newExpiry := time.Now().Add(sessionValidity)
@@ -400,6 +427,6 @@ func VerifyAuthStatus(w http.ResponseWriter, r *http.Request) {
 		SameSite: http.SameSiteStrictMode,
 	})
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("authorized"))
+	util.WriteJSON(w, http.StatusOK, map[string]string{"message": "authorized"})
+	return nil
 }
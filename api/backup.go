@@ -0,0 +1,65 @@
+package api
+
+import (
+	"LocalDex/backup"
+	"LocalDex/db"
+	"LocalDex/logger"
+	"LocalDex/types"
+	"LocalDex/util"
+	"errors"
+	"net/http"
+)
+
+// ListBackupsHandler returns the database snapshots, newest first.
+func ListBackupsHandler(w http.ResponseWriter, r *http.Request) error {
+	snapshots, err := backup.List()
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, snapshots)
+	return nil
+}
+
+// CreateBackupHandler takes a snapshot of the running database.
+func CreateBackupHandler(w http.ResponseWriter, r *http.Request) error {
+	snapshot, err := backup.Create(r.Context())
+	if err != nil {
+		return err
+	}
+
+	logger.TimedOkay("Created database snapshot `" + snapshot.Name + "`.")
+	util.WriteJSON(w, http.StatusCreated, snapshot)
+	return nil
+}
+
+// RestoreBackupHandler replaces the database with the snapshot named in the
+// path. Other requests get 503 until it is done.
+func RestoreBackupHandler(w http.ResponseWriter, r *http.Request) error {
+	name := r.PathValue("name")
+
+	if err := backup.Restore(r.Context(), name); err != nil {
+		if errors.Is(err, backup.ErrUnknownSnapshot) {
+			return types.ErrNotFound("Snapshot not found!").WithCause(err)
+		}
+		return err
+	}
+
+	logger.TimedOkay("Restored database from snapshot `" + name + "`.")
+	util.WriteJSON(w, http.StatusOK, map[string]any{"restored": name})
+	return nil
+}
+
+// IntegrityCheckHandler runs `PRAGMA integrity_check` on the live database.
+func IntegrityCheckHandler(w http.ResponseWriter, r *http.Request) error {
+	problems, err := db.IntegrityCheck(r.Context())
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"ok":       len(problems) == 0,
+		"problems": problems,
+	})
+	return nil
+}
@@ -0,0 +1,404 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// INFO: Supported content codings, listed in the order the server prefers them
+// when the client assigns them equal weight.
+const (
+	encodingBrotli = "br"
+	encodingZstd   = "zstd"
+	encodingGzip   = "gzip"
+)
+
+var supportedEncodings = []string{encodingBrotli, encodingZstd, encodingGzip}
+
+// Responses smaller than this are not worth the framing overhead of compression.
+const minCompressSize = 1024
+
+// INFO: Media types that are already compressed; running them through another
+// encoder only burns CPU and can make the payload bigger.
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/vnd.comicbook+zip",
+	"application/vnd.comicbook-rar",
+	"application/pdf",
+	"application/octet-stream",
+	"application/offset+octet-stream",
+}
+
+// Exceptions to the `image/` prefix above.
+var compressibleImageTypes = []string{
+	"image/svg+xml",
+	"image/x-icon",
+	"image/vnd.microsoft.icon",
+	"image/bmp",
+}
+
+func isCompressibleType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if len(mediaType) == 0 {
+		return false
+	}
+
+	for _, t := range compressibleImageTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+
+	for _, t := range incompressibleTypes {
+		if strings.HasPrefix(mediaType, t) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NegotiateEncoding picks the best supported content coding from an
+// Accept-Encoding header. It returns an empty string when the response should
+// be sent as-is.
+func NegotiateEncoding(acceptEncoding string) string {
+	if len(acceptEncoding) == 0 {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if len(name) == 0 {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		// Older clients still advertise the x- prefixed alias.
+		if name == "x-gzip" {
+			name = encodingGzip
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range supportedEncodings {
+		q, ok := weights[enc]
+		if !ok {
+			if wildcard < 0 {
+				continue
+			}
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+
+	return best
+}
+
+// addVary appends a token to the Vary header without duplicating it.
+func addVary(h http.Header, token string) {
+	for _, v := range h.Values("Vary") {
+		for _, existing := range strings.Split(v, ",") {
+			existing = strings.TrimSpace(existing)
+			if existing == "*" || strings.EqualFold(existing, token) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", token)
+}
+
+// INFO: Encoder pools for on-the-fly compression. Dynamic responses favour speed
+// over ratio; embedded assets are compressed once at the best level instead.
+var (
+	gzipPool = sync.Pool{New: func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+		return w
+	}}
+	brotliPool = sync.Pool{New: func() any {
+		return brotli.NewWriterLevel(io.Discard, 5)
+	}}
+	zstdPool = sync.Pool{New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		return w
+	}}
+)
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func acquireEncoder(encoding string, w io.Writer) (encoder, func()) {
+	switch encoding {
+	case encodingBrotli:
+		enc := brotliPool.Get().(*brotli.Writer)
+		enc.Reset(w)
+		return enc, func() { brotliPool.Put(enc) }
+
+	case encodingZstd:
+		enc := zstdPool.Get().(*zstd.Encoder)
+		enc.Reset(w)
+		return enc, func() { zstdPool.Put(enc) }
+
+	default:
+		enc := gzipPool.Get().(*gzip.Writer)
+		enc.Reset(w)
+		return enc, func() { gzipPool.Put(enc) }
+	}
+}
+
+// compressBytes compresses a whole payload at the highest level of the given
+// coding. It is meant for content that is compressed once and then cached.
+func compressBytes(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch encoding {
+	case encodingBrotli:
+		w := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+	case encodingZstd:
+		w, err := zstd.NewWriter(&buf, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+	case encodingGzip:
+		w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, errors.New("unsupported content encoding: " + encoding)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// body is worth compressing, then either streams it through an encoder or
+// passes it through untouched.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         []byte
+
+	enc     encoder
+	release func()
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	// Informational responses are forwarded immediately and don't end the header phase.
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < minCompressSize {
+			return len(p), nil
+		}
+		if err := cw.decide(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// decide commits the response headers and flushes the buffered prefix.
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	h := cw.ResponseWriter.Header()
+
+	if cw.shouldCompress() {
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", cw.encoding)
+		if etag := h.Get("ETag"); len(etag) != 0 && !strings.HasPrefix(etag, "W/") {
+			// The representation changed, so a strong validator no longer applies.
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.enc, cw.release = acquireEncoder(cw.encoding, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+func (cw *compressWriter) shouldCompress() bool {
+	h := cw.ResponseWriter.Header()
+
+	if len(h.Get("Content-Encoding")) != 0 {
+		return false
+	}
+	if cw.status < 200 || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified || cw.status == http.StatusPartialContent {
+		return false
+	}
+	if len(cw.buf) < minCompressSize {
+		return false
+	}
+	if strings.Contains(strings.ToLower(h.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+
+	contentType := h.Get("Content-Type")
+	if len(contentType) == 0 {
+		contentType = http.DetectContentType(cw.buf)
+		h.Set("Content-Type", contentType)
+	}
+	return isCompressibleType(contentType)
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		if err := cw.decide(); err != nil {
+			return
+		}
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close finishes the response, writing out whatever is still buffered.
+func (cw *compressWriter) close() {
+	if !cw.wroteHeader {
+		// Handler wrote nothing at all; let net/http send its implicit 200.
+		return
+	}
+	if !cw.decided {
+		cw.decide()
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.release()
+		cw.enc = nil
+	}
+}
+
+// CompressionMiddleware negotiates br/zstd/gzip with the client and compresses
+// responses on the fly. Handlers that already set Content-Encoding (for example
+// when serving a precompressed asset) are passed through untouched.
+func CompressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+
+		encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if len(encoding) == 0 || r.Method == http.MethodHead || len(r.Header.Get("Range")) != 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -5,151 +5,118 @@ import (
 	"LocalDex/parser"
 	"LocalDex/types"
 	"LocalDex/util"
-	"bytes"
-	"encoding/json"
-	"fmt"
 	"net/http"
-	"os"
 )
 
+// problemFrom builds an APIError with an optional message override.
+func problemFrom(status int, code string, msg *string) *types.APIError {
+	message := ""
+	if msg != nil {
+		message = *msg
+	}
+	return types.NewAPIError(status, code, message)
+}
+
 func BadRequest(w http.ResponseWriter, r *http.Request, msg *string) {
-	util.WriteError(w, http.StatusBadRequest, "400 Bad Request", msg)
+	util.WriteProblem(w, r, problemFrom(http.StatusBadRequest, types.ErrCodeBadRequest, msg))
 }
 
 func Unauthorized(w http.ResponseWriter, r *http.Request, msg *string) {
-	util.WriteError(w, http.StatusUnauthorized, "401 Unauthorized", msg)
+	util.WriteProblem(w, r, problemFrom(http.StatusUnauthorized, types.ErrCodeUnauthorized, msg))
 }
 
 func Forbidden(w http.ResponseWriter, r *http.Request, msg *string) {
-	util.WriteError(w, http.StatusForbidden, "403 Forbidden", msg)
+	util.WriteProblem(w, r, problemFrom(http.StatusForbidden, types.ErrCodeForbidden, msg))
 }
 
 func NotFoundAPI(w http.ResponseWriter, r *http.Request, msg *string) {
-	util.WriteError(w, http.StatusNotFound, "404 Not Found", msg)
+	util.WriteProblem(w, r, problemFrom(http.StatusNotFound, types.ErrCodeNotFound, msg))
 }
 
 func MethodNotAllowed(w http.ResponseWriter, r *http.Request, msg *string) {
-	util.WriteError(w, http.StatusMethodNotAllowed, "405 Method Not Allowed", msg)
+	util.WriteProblem(w, r, problemFrom(http.StatusMethodNotAllowed, types.ErrCodeMethodNotAllowed, msg))
 }
 
 func RequestTimeout(w http.ResponseWriter, r *http.Request, msg *string) {
-	util.WriteError(w, http.StatusRequestTimeout, "408 Request Timeout", msg)
+	util.WriteProblem(w, r, problemFrom(http.StatusRequestTimeout, types.ErrCodeRequestTimeout, msg))
 }
 
 func InternalErrorAPI(w http.ResponseWriter, r *http.Request, msg *string) {
-	util.WriteError(w, http.StatusInternalServerError, "500 Internal Server Error", msg)
+	util.WriteProblem(w, r, problemFrom(http.StatusInternalServerError, types.ErrCodeInternal, msg))
 }
 
-func InternalErrorPage(w http.ResponseWriter, r *http.Request, msg *string) {
-	// Attempt to get the HTML shell
-	html, err := parser.GetHTML()
-	if err != nil {
-		// If even the shell fails, fall back to basic response
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		logger.Error("failed to get html shell in error handler:\n    " + err.Error())
-		return
-	}
-
-	// Create the SSR data as JSON
-	payload := map[string]any{
-		"status":  500,
-		"message": "Internal Server Error",
-	}
-	if msg != nil {
-		payload["message"] = *msg
-	}
-
-	jsonData, err := json.Marshal(payload)
-	if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		logger.Error("failed to marshal SSR error JSON:\n    " + err.Error())
-		return
-	}
-
-	serverProps, err := parser.ParseStaticMetadataForPaths([]string{"*", "#internal_server_error"})
-	if err != nil {
-		http.Error(w, "Something went wrong!", http.StatusInternalServerError)
-		logger.Error("failed to parse metadata for server props:\n    " + err.Error())
-		return
-	}
-
-	// Build the <script> tag with ID __SERVER_DATA__
-	ssrScript := fmt.Sprintf(`<script id="__SERVER_DATA__" type="application/json">%s</script>`, jsonData)
-
-	// Inject into the HTML shell at the SSR Data marker
-	ssrInjectedHTML := bytes.Replace(html, []byte("<!-- SSR Data -->"), []byte(ssrScript), 1)
-	finalHTML := bytes.Replace(ssrInjectedHTML, []byte("<!-- Server Props -->"), []byte(serverProps), 1)
+// Messages shown on error pages when the caller doesn't provide one.
+var errorPageMessages = map[int]string{
+	http.StatusUnauthorized:        "Sign in to view this page",
+	http.StatusForbidden:           "You are not allowed to view this page",
+	http.StatusNotFound:            "Page not found",
+	http.StatusGone:                "This item has been deleted",
+	http.StatusInternalServerError: "Internal Server Error",
+	http.StatusServiceUnavailable:  "Service temporarily unavailable",
+}
 
-	// Write the response
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if os.Getenv("ENV") == types.ENV.Prod {
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "DENY")
-		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self'; connect-src 'self'")
-		w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
+// ErrorPage renders the HTML shell for an error status: the `#<status>`
+// metadata from `static.route.json` goes into the head and the status,
+// message and path into `__SERVER_DATA__`, so the client can show the
+// matching error screen.
+func ErrorPage(w http.ResponseWriter, r *http.Request, status int, msg *string) {
+	// fail renders a 500 page instead, or plain text when even that failed
+	fail := func(reason string, err error) {
+		logger.Error(reason + ":\n    " + err.Error())
+		if status == http.StatusInternalServerError {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		ErrorPage(w, r, http.StatusInternalServerError, util.AddrOf("Something went wrong!"))
 	}
-	w.Header().Set("Cache-Control", "no-store")
-	w.Header().Set("Pragma", "no-cache")
-	w.Header().Set("Expires", "0")
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write(finalHTML)
-}
 
-func NotFoundPage(w http.ResponseWriter, r *http.Request, msg *string) {
 	// Attempt to get the HTML shell
-	html, err := parser.GetHTML()
+	shell, err := parser.Shell()
 	if err != nil {
-		InternalErrorPage(w, r, util.AddrOf("Something went wrong!"))
-		logger.Error("failed to get html shell in error handler:\n    " + err.Error())
+		fail("failed to get html shell in error handler", err)
 		return
 	}
 
-	// Create the SSR data as JSON
-	payload := map[string]any{
-		"status":  404,
-		"message": "Page not found",
-		"path":    r.URL.Path,
+	message, ok := errorPageMessages[status]
+	if !ok {
+		message = http.StatusText(status)
 	}
 	if msg != nil {
-		payload["message"] = *msg
+		message = *msg
 	}
 
-	jsonData, err := json.Marshal(payload)
+	// Create the SSR data script
+	ssrScript, err := parser.SSRDataScript(map[string]any{
+		"status":  status,
+		"message": message,
+		"path":    r.URL.Path,
+	})
 	if err != nil {
-		InternalErrorPage(w, r, util.AddrOf("Internal Server Error"))
-		logger.Error("failed to marshal SSR error JSON:\n    " + err.Error())
+		fail("failed to marshal SSR error JSON", err)
 		return
 	}
 
-	serverProps, err := parser.ParseStaticMetadataForPaths([]string{"*", "#not_found"})
+	serverProps, err := parser.ParseErrorMetadata(status, CSPNonce(r))
 	if err != nil {
-		InternalErrorPage(w, r, util.AddrOf("Something went wrong!"))
-		logger.Error("failed to parse metadata for server props:\n    " + err.Error())
+		fail("failed to parse metadata for server props", err)
 		return
 	}
 
-	// Build the <script> tag with ID __SERVER_DATA__
-	ssrScript := fmt.Sprintf(`<script id="__SERVER_DATA__" type="application/json">%s</script>`, jsonData)
-
-	// Inject into the HTML shell at the SSR Data marker
-	ssrInjectedHTML := bytes.Replace(html, []byte("<!-- SSR Data -->"), []byte(ssrScript), 1)
-	finalHTML := bytes.Replace(ssrInjectedHTML, []byte("<!-- Server Props -->"), []byte(serverProps), 1)
+	finalHTML, _ := parser.InjectNonce(shell.Render([]byte(serverProps), ssrScript), CSPNonce(r))
 
 	// Write the response
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if os.Getenv("ENV") == types.ENV.Prod {
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "DENY")
-		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self'; connect-src 'self'")
-		w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
-	}
 	w.Header().Set("Cache-Control", "no-store")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Expires", "0")
-	w.WriteHeader(http.StatusNotFound)
+	w.WriteHeader(status)
 	w.Write(finalHTML)
 }
+
+func InternalErrorPage(w http.ResponseWriter, r *http.Request, msg *string) {
+	ErrorPage(w, r, http.StatusInternalServerError, msg)
+}
+
+func NotFoundPage(w http.ResponseWriter, r *http.Request, msg *string) {
+	ErrorPage(w, r, http.StatusNotFound, msg)
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"LocalDex/db"
+	"LocalDex/scanner"
+	"LocalDex/types"
+	"LocalDex/util"
+	"errors"
+	"net/http"
+)
+
+// LibraryScanStatusHandler reports whether a library scan is running and
+// what the last one found.
+func LibraryScanStatusHandler(w http.ResponseWriter, r *http.Request) error {
+	util.WriteJSON(w, http.StatusOK, scanner.Status())
+	return nil
+}
+
+// StartLibraryScanHandler rescans the library roots in the background.
+func StartLibraryScanHandler(w http.ResponseWriter, r *http.Request) error {
+	if err := scanner.Start(); err != nil {
+		if errors.Is(err, scanner.ErrScanRunning) {
+			return types.ErrConflict("A library scan is already running!")
+		}
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusAccepted, scanner.Status())
+	return nil
+}
+
+// OfflineLibraryFilesHandler lists indexed files that are missing from disk.
+// Their items stay in the library until the files turn up again.
+func OfflineLibraryFilesHandler(w http.ResponseWriter, r *http.Request) error {
+	files, err := db.OfflineLibraryFiles(r.Context())
+	if err != nil {
+		return types.ErrInternal("Failed to list offline files!").WithCause(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, files)
+	return nil
+}
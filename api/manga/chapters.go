@@ -0,0 +1,28 @@
+package manga
+
+import (
+	"LocalDex/api/auth"
+	"LocalDex/util"
+	"net/http"
+)
+
+// GetChapters lists the chapters of a manga.
+func GetChapters(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	m, err := Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return err
+	}
+
+	chapters, err := Chapters(r.Context(), m.ID)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, chapters)
+	return nil
+}
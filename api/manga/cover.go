@@ -0,0 +1,27 @@
+package manga
+
+import (
+	"LocalDex/api/auth"
+	"LocalDex/util"
+	"net/http"
+)
+
+// GetCover streams the cover image of a manga, or a thumbnail of it when a
+// `size` is given.
+func GetCover(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	m, err := Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if r.URL.Query().Has("size") {
+		return util.ServeThumbnail(w, r, m.CoverPath, 0)
+	}
+	return util.ServeLibraryFile(w, r, m.CoverPath, "")
+}
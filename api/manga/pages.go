@@ -0,0 +1,97 @@
+package manga
+
+import (
+	"LocalDex/api/auth"
+	"LocalDex/types"
+	"LocalDex/util"
+	"archive/zip"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// chapterFromPath loads the manga and chapter named by the route.
+func chapterFromPath(r *http.Request) (*types.MangaChapter, error) {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return nil, err
+	}
+	chapterID, err := util.PathID(r, "chapter")
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return nil, err
+	}
+	return Chapter(r.Context(), m.ID, chapterID)
+}
+
+// GetPages lists the pages of a chapter.
+func GetPages(w http.ResponseWriter, r *http.Request) error {
+	c, err := chapterFromPath(r)
+	if err != nil {
+		return err
+	}
+
+	pages, err := Pages(c)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, pages)
+	return nil
+}
+
+// GetPage streams a page of a chapter, or a thumbnail of it when a `size` is
+// given.
+func GetPage(w http.ResponseWriter, r *http.Request) error {
+	c, err := chapterFromPath(r)
+	if err != nil {
+		return err
+	}
+
+	entries, err := pageEntries(c)
+	if err != nil {
+		return err
+	}
+	number, err := strconv.Atoi(r.PathValue("page"))
+	if err != nil || number < 1 || number > len(entries) {
+		return types.ErrNotFound("Page not found!")
+	}
+	entry := entries[number-1]
+
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	if r.URL.Query().Has("size") {
+		return util.ServePageThumbnail(w, r, c.FilePath, entry)
+	}
+
+	archive, err := zip.OpenReader(c.FilePath)
+	if err != nil {
+		return types.ErrInternal("Failed to open chapter!").WithCause(err)
+	}
+	defer archive.Close()
+
+	f, err := archive.Open(entry)
+	if err != nil {
+		return types.ErrInternal("Failed to open page!").WithCause(err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return types.ErrInternal("Failed to open page!").WithCause(err)
+	}
+
+	// Like library files, pages are cacheable as Cache-Control says
+	w.Header().Del("Pragma")
+	w.Header().Del("Expires")
+	w.Header().Set("Content-Type", pageTypes[strings.ToLower(path.Ext(entry))])
+	w.Header().Set("Content-Length", strconv.FormatInt(stat.Size(), 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, f)
+	return nil
+}
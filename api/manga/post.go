@@ -1,7 +1,53 @@
 package manga
 
-import "net/http"
+import (
+	"LocalDex/types"
+	"LocalDex/util"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
 
-func Post(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Post Manga"))
+// Post adds a new manga series. Chapters are added through resumable
+// uploads, see the upload package.
+func Post(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		Title       string   `json:"title"`
+		Type        string   `json:"type"`
+		Description string   `json:"description"`
+		AltTitles   []string `json:"alt_titles"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+
+	m := &types.Manga{
+		Title:       strings.TrimSpace(req.Title),
+		Type:        req.Type,
+		Description: req.Description,
+		AltTitles:   util.CleanTitles(req.AltTitles),
+	}
+	if len(m.Type) == 0 {
+		m.Type = types.MangaTypeManga
+	}
+
+	var details []types.FieldError
+	if len(m.Title) == 0 {
+		details = append(details, types.FieldError{Field: "title", Code: "required", Message: "must not be empty"})
+	}
+	if m.Type != types.MangaTypeManga && m.Type != types.MangaTypeDoujin {
+		details = append(details, types.FieldError{Field: "type", Code: "invalid", Message: "must be " + types.MangaTypeManga + " or " + types.MangaTypeDoujin})
+	}
+	if len(details) != 0 {
+		return types.ErrValidation("Invalid manga!", details...)
+	}
+
+	if err := Create(r.Context(), m); err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusCreated, m)
+	return nil
 }
@@ -0,0 +1,292 @@
+package manga
+
+import (
+	"LocalDex/db"
+	"LocalDex/thumb"
+	"LocalDex/types"
+	"LocalDex/util"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// INFO: Service calls shared by the JSON API and the SSR loaders, so a page
+// preloads exactly what the client would otherwise fetch.
+
+// ParseListQuery validates the query string of a manga listing.
+func ParseListQuery(values url.Values) (types.ListQuery, error) {
+	q, err := util.ParseListQuery(values, db.MangaSorts.Keys(), types.MangaTypeManga, types.MangaTypeDoujin)
+	if err != nil {
+		return q, err
+	}
+	return q, util.FilterError(db.CheckFilter(types.MediaManga, q.Filter))
+}
+
+// List returns one page of the manga library.
+func List(ctx context.Context, q types.ListQuery) (*types.Page[types.Manga], error) {
+	items, total, err := db.ListManga(ctx, q)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to list manga!").WithCause(err)
+	}
+	return types.NewPage(items, q, total), nil
+}
+
+// Find returns a live manga. NSFW entries are only handed out to signed-in
+// users.
+func Find(ctx context.Context, id int64, authenticated bool) (*types.Manga, error) {
+	m, err := db.GetManga(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Manga not found!")
+	}
+	if errors.Is(err, db.ErrDeleted) {
+		return nil, types.ErrGone("Manga was deleted!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to load manga!").WithCause(err)
+	}
+	if m.NSFW() && !authenticated {
+		return nil, types.ErrForbidden(types.ErrCodeNSFWLocked, "Sign in to view this manga.")
+	}
+	return m, nil
+}
+
+// Remove moves a manga to the trash.
+func Remove(ctx context.Context, id int64) error {
+	if _, err := db.SoftDeleteItems(ctx, types.MediaManga, []int64{id}); err != nil {
+		return types.ErrInternal("Failed to delete manga!").WithCause(err)
+	}
+	return nil
+}
+
+// Create adds a new manga series.
+func Create(ctx context.Context, m *types.Manga) error {
+	if err := db.CreateManga(ctx, m); err != nil {
+		return types.ErrInternal("Failed to save manga!").WithCause(err)
+	}
+	return nil
+}
+
+// Archive formats manga chapters are read from, by extension
+var chapterTypes = map[string]string{
+	".cbz":  "application/vnd.comicbook+zip",
+	".zip":  "application/zip",
+	".cbr":  "application/vnd.comicbook-rar",
+	".rar":  "application/vnd.rar",
+	".cb7":  "application/x-cb7",
+	".7z":   "application/x-7z-compressed",
+	".pdf":  "application/pdf",
+	".epub": "application/epub+zip",
+}
+
+// IsChapterFile reports whether a file looks like a manga chapter archive.
+func IsChapterFile(path string) bool {
+	_, ok := chapterTypes[strings.ToLower(filepath.Ext(path))]
+	return ok
+}
+
+// describeChapter reads the type and size of a chapter archive on disk.
+func describeChapter(path string) (*types.MangaChapter, error) {
+	mimeType, ok := chapterTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, types.NewAPIError(http.StatusUnsupportedMediaType, types.ErrCodeUnsupportedMedia, "Chapters must be comic archives, PDF or EPUB files!")
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to open file!").WithCause(err)
+	}
+	return &types.MangaChapter{FilePath: path, MimeType: mimeType, Size: stat.Size()}, nil
+}
+
+// Chapters lists the chapters of a manga.
+func Chapters(ctx context.Context, mangaID int64) ([]types.MangaChapter, error) {
+	chapters, err := db.ListChapters(ctx, mangaID)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to list chapters!").WithCause(err)
+	}
+	return chapters, nil
+}
+
+// Chapter returns a chapter of a manga.
+func Chapter(ctx context.Context, mangaID int64, id int64) (*types.MangaChapter, error) {
+	c, err := db.GetChapter(ctx, mangaID, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Chapter not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to load chapter!").WithCause(err)
+	}
+	return c, nil
+}
+
+// Archive formats whose pages can be listed and served one by one
+var pagedTypes = map[string]bool{
+	".cbz": true,
+	".zip": true,
+}
+
+// Page images by extension
+var pageTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// compareNatural orders names with the numbers in them compared by value, so
+// page 2 comes before page 10.
+func compareNatural(a string, b string) int {
+	for len(a) != 0 && len(b) != 0 {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na, nb := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(na) != len(nb) {
+				return len(na) - len(nb)
+			}
+			if c := strings.Compare(na, nb); c != 0 {
+				return c
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// pageEntries lists the images of a chapter archive in reading order.
+// Directories and files hidden by the archiver, such as macOS resource forks,
+// are skipped.
+func pageEntries(c *types.MangaChapter) ([]string, error) {
+	if !pagedTypes[strings.ToLower(filepath.Ext(c.FilePath))] {
+		return nil, types.NewAPIError(http.StatusUnsupportedMediaType, types.ErrCodeUnsupportedMedia, "Pages can only be read from zip archives!")
+	}
+
+	archive, err := zip.OpenReader(c.FilePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, types.ErrNotFound("The file of this chapter is missing from the library!").WithCause(err)
+		}
+		return nil, types.ErrInternal("Failed to open chapter!").WithCause(err)
+	}
+	defer archive.Close()
+
+	entries := []string{}
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+		if _, ok := pageTypes[strings.ToLower(path.Ext(f.Name))]; ok {
+			entries = append(entries, f.Name)
+		}
+	}
+	slices.SortFunc(entries, compareNatural)
+	return entries, nil
+}
+
+// Pages lists the pages of a chapter.
+func Pages(c *types.MangaChapter) ([]types.MangaPage, error) {
+	entries, err := pageEntries(c)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]types.MangaPage, len(entries))
+	for i, entry := range entries {
+		pages[i] = types.MangaPage{Number: i + 1, Name: entry}
+	}
+	return pages, nil
+}
+
+// enqueuePages generates the page thumbnails of a chapter in the background,
+// when its pages can be read.
+func enqueuePages(c *types.MangaChapter) {
+	if !pagedTypes[strings.ToLower(filepath.Ext(c.FilePath))] {
+		return
+	}
+	if entries, err := pageEntries(c); err == nil {
+		thumb.EnqueuePages(c.FilePath, entries)
+	}
+}
+
+// FindOrCreate returns the manga of a type with the given title, adding it
+// when the library has none yet.
+func FindOrCreate(ctx context.Context, title string, mangaType string) (*types.Manga, error) {
+	m, err := db.MangaByTitle(ctx, title, mangaType)
+	if err == nil {
+		return m, nil
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrInternal("Failed to load manga!").WithCause(err)
+	}
+
+	m = &types.Manga{Title: title, Type: mangaType}
+	if err := Create(ctx, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// IndexChapter adds an archive from a library root as a chapter of a manga
+// without moving it. Chapter zero stands for a whole volume.
+func IndexChapter(ctx context.Context, mangaID int64, volume int, chapter float64, path string) (*types.MangaChapter, error) {
+	c, err := describeChapter(path)
+	if err != nil {
+		return nil, err
+	}
+	c.MangaID, c.Volume, c.Chapter = mangaID, volume, chapter
+
+	err = db.CreateChapter(ctx, c)
+	if errors.Is(err, db.ErrConflict) {
+		return nil, types.ErrConflict(fmt.Sprintf("Volume %d chapter %g already exists!", volume, chapter))
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to save chapter!").WithCause(err)
+	}
+
+	enqueuePages(c)
+	return c, nil
+}
+
+// RefreshChapter rereads the file of an indexed chapter that changed on disk.
+func RefreshChapter(ctx context.Context, id int64, path string) (*types.MangaChapter, error) {
+	c, err := describeChapter(path)
+	if err != nil {
+		return nil, err
+	}
+	c.ID = id
+
+	err = db.UpdateChapterFile(ctx, c)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Chapter not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to save chapter!").WithCause(err)
+	}
+
+	enqueuePages(c)
+	return c, nil
+}
@@ -0,0 +1,15 @@
+package api
+
+import (
+	"LocalDex/parser"
+	"LocalDex/util"
+	"net/http"
+)
+
+// MetricsHandler reports internal counters of the running server.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) error {
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"static_routes": parser.StaticRouteStats(),
+	})
+	return nil
+}
@@ -1,9 +1,16 @@
 package api
 
 import (
+	"LocalDex/api/auth"
+	"LocalDex/backup"
 	"LocalDex/logger"
+	"LocalDex/settings"
+	"LocalDex/types"
+	"LocalDex/util"
 	"fmt"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
 )
 
@@ -41,6 +48,24 @@ func RecoveryMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// MaintenanceMiddleware answers every request with 503 while the database is
+// being restored.
+func MaintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !backup.InMaintenance() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Retry-After", "30")
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			util.WriteProblem(w, r, types.NewAPIError(http.StatusServiceUnavailable, types.ErrCodeUnavailable, "Server is in maintenance mode, try again shortly!"))
+			return
+		}
+		ErrorPage(w, r, http.StatusServiceUnavailable, nil)
+	})
+}
+
 func NoCache(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Cache-Control", "no-store")
@@ -56,3 +81,86 @@ func Cacheable(maxAge int, next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// API routes that can't carry a CSRF token. Browsers send CSP reports on their own.
+var csrfExemptRoutes = map[string]bool{
+	"POST /api/csp-report": true,
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// originOf reduces a URL to its scheme://host[:port] form.
+func originOf(raw string) (*url.URL, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return nil, false
+	}
+	return &url.URL{Scheme: strings.ToLower(u.Scheme), Host: strings.ToLower(u.Host)}, true
+}
+
+// isTrustedOrigin compares the request's Origin (or Referer, when a browser
+// omits Origin) with the configured HOST and any extra trusted origins. In
+// development the port is ignored, since the Vite dev server and the backend
+// listen on different ones.
+func isTrustedOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if len(source) == 0 || source == "null" {
+		source = r.Header.Get("Referer")
+	}
+	origin, ok := originOf(source)
+	if !ok {
+		return false
+	}
+
+	trusted := append([]string{os.Getenv("HOST")}, settings.Get().Security.TrustedOrigins...)
+	for _, candidate := range trusted {
+		allowed, ok := originOf(candidate)
+		if !ok {
+			continue
+		}
+
+		if os.Getenv("ENV") == types.ENV.Dev {
+			if origin.Hostname() == allowed.Hostname() {
+				return true
+			}
+			continue
+		}
+
+		if origin.Scheme == allowed.Scheme && origin.Host == allowed.Host {
+			return true
+		}
+	}
+	return false
+}
+
+// CSRFMiddleware guards state-changing API calls. The request must come from a
+// trusted origin and carry a CSRF token bound to its session; tokens are
+// handed out by `GET /api/auth/csrf`.
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || isSafeMethod(r.Method) || csrfExemptRoutes[r.Method+" "+r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !isTrustedOrigin(r) {
+			logger.TimedWarning("Rejected cross-origin", r.Method, r.URL.Path, "from", r.Header.Get("Origin"), r.Header.Get("Referer"))
+			util.WriteProblem(w, r, types.ErrForbidden(types.ErrCodeOriginNotAllowed, "Request origin is not allowed!"))
+			return
+		}
+
+		if err := auth.VerifyCSRF(r); err != nil {
+			util.WriteProblem(w, r, types.ErrForbidden(types.ErrCodeCSRFFailed, "CSRF validation failed: "+err.Error()))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
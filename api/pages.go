@@ -5,10 +5,10 @@ import (
 	"LocalDex/parser"
 	"LocalDex/types"
 	"LocalDex/util"
-	"bytes"
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"net/http"
-	"os"
 )
 
 func ServePages(w http.ResponseWriter, r *http.Request) {
@@ -17,66 +17,89 @@ func ServePages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	html, err := parser.GetHTML()
+	shell, err := parser.Shell()
 	if err != nil {
 		InternalErrorPage(w, r, util.AddrOf("Something went wrong when getting html from FS!"))
 		logger.Error("failed to get html shell:\n    " + err.Error())
 		return
 	}
 
-	ssrData, err, status := parser.PerformSSR(r.URL.Path)
+	ssr, err, status := parser.PerformSSR(r)
 	if err != nil {
-		if status == http.StatusNotFound {
-			NotFoundPage(w, r, util.AddrOf("Content of dynamic page could not be found!"))
-			return
+		var msg *string
+
+		// Loaders report not found, gone, forbidden etc. as typed errors
+		var apiErr *types.APIError
+		if errors.As(err, &apiErr) && len(apiErr.Message) != 0 {
+			msg = &apiErr.Message
+		} else if status >= http.StatusInternalServerError {
+			msg = util.AddrOf("Failed to perform SSR!")
+		}
+
+		if status == http.StatusInternalServerError {
+			logger.Error("performing SSR failed:\n    " + err.Error())
 		}
 
-		// TODO: Implement dedicated error pages intead of generic 500 error.
-		InternalErrorPage(w, r, util.AddrOf("Failed to perform SSR!"))
-		logger.Error("performing SSR failed:\n    " + err.Error())
+		ErrorPage(w, r, status, msg)
 		return
 	}
 
-	if len(ssrData) == 0 {
-		var metadata string
+	var dynamicMeta *types.RouteMetadata
+	if ssr != nil {
+		dynamicMeta = ssr.Metadata
+	}
 
-		defaultCase := func() error {
-			metadata, err = parser.ParseMetadata(r.URL.Path, nil)
-			if err != nil {
-				return fmt.Errorf("metadata parsing failed: %w", err)
-			}
-			return nil
-		}
+	metadata, err := parser.ParseMetadata(r.URL.Path, dynamicMeta, CSPNonce(r))
+	if err != nil {
+		InternalErrorPage(w, r, util.AddrOf("Failed to parse metadata of the page!"))
+		logger.Error("metadata parsing failed:\n    " + err.Error())
+		return
+	}
 
-		switch r.URL.Path {
-		default:
-			if err := defaultCase(); err != nil {
-				InternalErrorPage(w, r, util.AddrOf("Failed to parse metadata of the page!"))
-				logger.Error(err.Error())
-				return
-			}
+	var ssrScript []byte
+	if ssr != nil && ssr.Data != nil {
+		ssrScript, err = parser.SSRDataScript(ssr.Data)
+		if err != nil {
+			InternalErrorPage(w, r, util.AddrOf("Failed to serialize SSR data!"))
+			logger.Error("failed to marshal SSR data:\n    " + err.Error())
+			return
 		}
+	}
 
-		// Replace marker in HTML
-		html = bytes.Replace(html, []byte("<!-- Server Props -->"), []byte(metadata), 1)
-	} else {
-		html = bytes.Replace(html, []byte("<!-- SSR Data -->"), []byte(ssrData), 1)
+	if ssr != nil && len(ssr.InitialData) != 0 {
+		initialScript, err := parser.InitialDataScript(ssr.InitialData)
+		if err != nil {
+			InternalErrorPage(w, r, util.AddrOf("Failed to serialize SSR data!"))
+			logger.Error("failed to marshal initial data:\n    " + err.Error())
+			return
+		}
+		ssrScript = append(ssrScript, initialScript...)
 	}
 
+	html := shell.Render([]byte(metadata), ssrScript)
+
+	// INFO: The shell references the current build's hashed chunks, so it must
+	//        always be revalidated; the ETag keeps that down to a 304.
+	//        Pages carrying nonced inline scripts can't be revalidated, since a
+	//        cached body would keep a nonce that no longer matches the new CSP.
+	sum := sha256.Sum256(html)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	html, nonced := parser.InjectNonce(html, CSPNonce(r))
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if len(ssrData) == 0 {
-		w.Header().Set("Cache-Control", "public, max-age=86400")
+	if nonced {
+		w.Header().Set("Cache-Control", "no-store")
 	} else {
-		w.Header().Set("Cache-Control", "public, max-age=3600")
-	}
-	if os.Getenv("ENV") == types.ENV.Prod {
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		w.Header().Set("X-Frame-Options", "DENY")
-		w.Header().Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		w.Header().Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
-		w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; font-src 'self'; connect-src 'self'")
-		w.Header().Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains; preload")
+		w.Header().Set("Cache-Control", cacheRevalidate)
+		w.Header().Set("ETag", etag)
+
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 	}
+
 	w.WriteHeader(http.StatusOK)
 	w.Write(html)
 }
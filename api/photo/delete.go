@@ -1,7 +1,23 @@
 package photo
 
-import "net/http"
+import (
+	"LocalDex/util"
+	"net/http"
+)
 
-func DeleteMultiple(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Delete Multiple Photo"))
+// DeleteMultiple moves the photos listed in `ids` to the trash. IDs that are
+// unknown or already deleted are skipped; the response lists the rest.
+func DeleteMultiple(w http.ResponseWriter, r *http.Request) error {
+	ids, err := util.ParseIDs(r.URL.Query().Get("ids"), "ids")
+	if err != nil {
+		return err
+	}
+
+	deleted, err := Delete(r.Context(), ids)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"deleted": deleted})
+	return nil
 }
@@ -0,0 +1,269 @@
+package photo
+
+import (
+	"LocalDex/db"
+	"LocalDex/thumb"
+	"LocalDex/types"
+	"LocalDex/util"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// INFO: Bounds of the `distance` parameter, the number of dHash bits two
+// photos may differ in and still count as the same picture. Zero only finds
+// exact copies.
+const (
+	defaultDuplicateDistance = 5
+	maxDuplicateDistance     = 12
+)
+
+func parseDistance(raw string) (int, error) {
+	if len(raw) == 0 {
+		return defaultDuplicateDistance, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 || n > maxDuplicateDistance {
+		return 0, types.ErrValidation("Invalid duplicate distance!", types.FieldError{
+			Field:   "distance",
+			Code:    "out_of_range",
+			Message: "must be a number between 0 and " + strconv.Itoa(maxDuplicateDistance),
+		})
+	}
+	return n, nil
+}
+
+// unionFind joins photo indexes into groups.
+type unionFind []int
+
+func (u unionFind) find(i int) int {
+	for u[i] != i {
+		u[i] = u[u[i]]
+		i = u[i]
+	}
+	return i
+}
+
+func (u unionFind) union(a int, b int) {
+	u[u.find(a)] = u.find(b)
+}
+
+// betterPhoto orders the copies of a picture, the one worth keeping first.
+func betterPhoto(a, b types.Photo) int {
+	return cmp.Or(
+		cmp.Compare(b.Width*b.Height, a.Width*a.Height),
+		cmp.Compare(b.Size, a.Size),
+		a.CreatedAt.Compare(b.CreatedAt),
+		cmp.Compare(a.ID, b.ID),
+	)
+}
+
+// groupDuplicates groups photos with the same content hash, and with dHashes
+// at most distance bits apart.
+func groupDuplicates(photos []types.Photo, distance int) []types.DuplicateGroup {
+	groups := make(unionFind, len(photos))
+	for i := range groups {
+		groups[i] = i
+	}
+
+	bySum := map[string]int{}
+	for i, p := range photos {
+		if first, ok := bySum[p.SHA256]; ok {
+			groups.union(i, first)
+		} else {
+			bySum[p.SHA256] = i
+		}
+	}
+
+	if distance > 0 {
+		// Two hashes at most `distance` bits apart agree completely on at least
+		// one of `distance+1` parts, so only photos sharing a part need to be
+		// compared
+		parts := distance + 1
+		width := (64 + parts - 1) / parts
+		buckets := map[[2]uint64][]int{}
+		for i, p := range photos {
+			if p.DHash == nil {
+				continue
+			}
+			for s := range parts {
+				shift := s * width
+				if shift >= 64 {
+					break
+				}
+				key := [2]uint64{uint64(s), (*p.DHash >> shift) & (1<<width - 1)}
+				buckets[key] = append(buckets[key], i)
+			}
+		}
+
+		for _, bucket := range buckets {
+			for x := range bucket {
+				for y := x + 1; y < len(bucket); y++ {
+					a, b := bucket[x], bucket[y]
+					if groups.find(a) != groups.find(b) && thumb.Distance(*photos[a].DHash, *photos[b].DHash) <= distance {
+						groups.union(a, b)
+					}
+				}
+			}
+		}
+	}
+
+	members := map[int][]types.Photo{}
+	for i, p := range photos {
+		root := groups.find(i)
+		members[root] = append(members[root], p)
+	}
+
+	result := []types.DuplicateGroup{}
+	for _, group := range members {
+		if len(group) < 2 {
+			continue
+		}
+		slices.SortFunc(group, betterPhoto)
+
+		exact := true
+		for _, p := range group[1:] {
+			exact = exact && p.SHA256 == group[0].SHA256
+		}
+		result = append(result, types.DuplicateGroup{Exact: exact, Best: group[0].ID, Photos: group})
+	}
+
+	slices.SortFunc(result, func(a, b types.DuplicateGroup) int {
+		return cmp.Compare(a.Best, b.Best)
+	})
+	return result
+}
+
+// FindDuplicates groups the live photos that are copies of each other.
+func FindDuplicates(ctx context.Context, distance int) ([]types.DuplicateGroup, error) {
+	photos, err := db.HashedPhotos(ctx)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to load photos!").WithCause(err)
+	}
+	return groupDuplicates(photos, distance), nil
+}
+
+// GetDuplicates lists groups of duplicate photos, see parseDistance for the
+// `distance` parameter.
+func GetDuplicates(w http.ResponseWriter, r *http.Request) error {
+	distance, err := parseDistance(r.URL.Query().Get("distance"))
+	if err != nil {
+		return err
+	}
+
+	groups, err := FindDuplicates(r.Context(), distance)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"distance": distance,
+		"groups":   groups,
+	})
+	return nil
+}
+
+// duplicateChoice is a group of duplicates as the client reviewed it: every
+// photo in Photos except Keep goes to the trash.
+type duplicateChoice struct {
+	Keep   int64   `json:"keep"`
+	Photos []int64 `json:"photos"`
+}
+
+// validateChoices checks that every group keeps one of its own photos, that no
+// photo is listed twice and that there aren't more than util.MaxBulkIDs.
+func validateChoices(choices []duplicateChoice) error {
+	var details []types.FieldError
+	invalid := func(field string, message string) {
+		details = append(details, types.FieldError{Field: field, Code: "invalid", Message: message})
+	}
+
+	if len(choices) == 0 {
+		invalid("groups", "must list at least one group")
+	}
+
+	seen := map[int64]bool{}
+	for i, choice := range choices {
+		field := "groups[" + strconv.Itoa(i) + "]"
+		if len(seen)+len(choice.Photos) > util.MaxBulkIDs {
+			invalid("groups", "must not list more than "+strconv.Itoa(util.MaxBulkIDs)+" photos")
+			break
+		}
+		if len(choice.Photos) < 2 {
+			invalid(field+".photos", "must list at least two photos")
+		}
+		if !slices.Contains(choice.Photos, choice.Keep) {
+			invalid(field+".keep", "must be one of the group's photos")
+		}
+		for _, id := range choice.Photos {
+			if id <= 0 || seen[id] {
+				invalid(field+".photos", "must list positive IDs, each in one group only")
+				break
+			}
+			seen[id] = true
+		}
+	}
+
+	if len(details) != 0 {
+		return types.ErrValidation("Invalid duplicate groups!", details...)
+	}
+	return nil
+}
+
+// ResolveDuplicates moves the duplicates the client reviewed to the trash,
+// like DeleteMultiple. Only the photos named in the body's groups are
+// touched; a group whose kept photo is no longer in the library is skipped,
+// so no picture loses its last copy.
+func ResolveDuplicates(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		Groups []duplicateChoice `json:"groups"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+	if err := validateChoices(req.Groups); err != nil {
+		return err
+	}
+
+	kept, skipped, remove := []int64{}, []int64{}, []int64{}
+	for _, choice := range req.Groups {
+		_, err := db.GetPhoto(r.Context(), choice.Keep)
+		if errors.Is(err, db.ErrNotFound) || errors.Is(err, db.ErrDeleted) {
+			skipped = append(skipped, choice.Keep)
+			continue
+		}
+		if err != nil {
+			return types.ErrInternal("Failed to load photo!").WithCause(err)
+		}
+
+		kept = append(kept, choice.Keep)
+		for _, id := range choice.Photos {
+			if id != choice.Keep {
+				remove = append(remove, id)
+			}
+		}
+	}
+
+	deleted := []int64{}
+	if len(remove) != 0 {
+		ids, err := Delete(r.Context(), remove)
+		if err != nil {
+			return err
+		}
+		deleted = ids
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{
+		"kept":    kept,
+		"skipped": skipped,
+		"deleted": deleted,
+	})
+	return nil
+}
@@ -0,0 +1,23 @@
+package photo
+
+import (
+	"LocalDex/api/auth"
+	"LocalDex/util"
+	"net/http"
+)
+
+// GetFile streams the original photo or video.
+func GetFile(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	p, err := Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	return util.ServeLibraryFile(w, r, p.FilePath, p.MimeType)
+}
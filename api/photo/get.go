@@ -1,11 +1,39 @@
 package photo
 
-import "net/http"
+import (
+	"LocalDex/api/auth"
+	"LocalDex/util"
+	"net/http"
+)
 
-func Get(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Get Photo"))
+// Get returns a single photo.
+func Get(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	p, err := Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, p)
+	return nil
 }
 
-func GetMultiple(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Get Multiple Photo"))
+// GetMultiple lists the photo library, see ParseListQuery for the parameters.
+func GetMultiple(w http.ResponseWriter, r *http.Request) error {
+	q, err := ParseListQuery(r.URL.Query())
+	if err != nil {
+		return err
+	}
+
+	page, err := List(r.Context(), q)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, page)
+	return nil
 }
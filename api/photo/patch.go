@@ -0,0 +1,75 @@
+package photo
+
+import (
+	"LocalDex/types"
+	"LocalDex/util"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// photoDetails is the editable part of a photo. Fields left out of a PATCH
+// body keep their value; `null` clears the nullable ones.
+type photoDetails struct {
+	Title   string `json:"title"`
+	Caption string `json:"caption"`
+	types.PhotoMetadata
+}
+
+func (d *photoDetails) validate() error {
+	var details []types.FieldError
+
+	if len(strings.TrimSpace(d.Title)) == 0 {
+		details = append(details, types.FieldError{Field: "title", Code: "required", Message: "must not be empty"})
+	}
+	if d.Orientation < 1 || d.Orientation > 8 {
+		details = append(details, types.FieldError{Field: "orientation", Code: "out_of_range", Message: "must be an EXIF orientation between 1 and 8"})
+	}
+	if (d.Latitude == nil) != (d.Longitude == nil) {
+		details = append(details, types.FieldError{Field: "latitude", Code: "invalid", Message: "latitude and longitude must be set or cleared together"})
+	}
+	if d.Latitude != nil && (*d.Latitude < -90 || *d.Latitude > 90) {
+		details = append(details, types.FieldError{Field: "latitude", Code: "out_of_range", Message: "must be between -90 and 90"})
+	}
+	if d.Longitude != nil && (*d.Longitude < -180 || *d.Longitude > 180) {
+		details = append(details, types.FieldError{Field: "longitude", Code: "out_of_range", Message: "must be between -180 and 180"})
+	}
+
+	if len(details) != 0 {
+		return types.ErrValidation("Invalid photo details!", details...)
+	}
+	return nil
+}
+
+// PatchMetadata edits the title, caption and capture metadata of a photo.
+func PatchMetadata(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	p, err := Find(r.Context(), id, true)
+	if err != nil {
+		return err
+	}
+
+	// Decoding over the current values only changes what the body mentions
+	edit := photoDetails{Title: p.Title, Caption: p.Caption, PhotoMetadata: p.PhotoMetadata}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&edit); err != nil {
+		return types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+	edit.Title = strings.TrimSpace(edit.Title)
+	if err := edit.validate(); err != nil {
+		return err
+	}
+
+	p.Title, p.Caption, p.PhotoMetadata = edit.Title, edit.Caption, edit.PhotoMetadata
+	if err := UpdateDetails(r.Context(), p); err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, p)
+	return nil
+}
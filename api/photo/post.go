@@ -1,7 +1,87 @@
 package photo
 
-import "net/http"
+import (
+	"LocalDex/types"
+	"LocalDex/util"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
 
-func Post(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Post Photo"))
+// Largest photo or video accepted in one request
+const maxUploadSize = 8 << 30
+
+// Longest title or caption accepted from the upload form
+const maxFieldSize = 4 << 10
+
+// Post adds a photo or video to the library from a multipart form: the `file`
+// part, with optional `title` and `caption` fields.
+func Post(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return types.ErrBadRequest("Expected a multipart/form-data upload!")
+	}
+
+	var (
+		p              *types.Photo
+		title, caption string
+	)
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return types.ErrBadRequest("Malformed multipart body!").WithCause(err)
+		}
+
+		switch part.FormName() {
+		case "file":
+			if p != nil {
+				return types.ErrValidation("Only one file can be uploaded at a time!")
+			}
+			// Title and caption usually come before the file, the photo is
+			// updated below if they don't
+			p, err = Import(r.Context(), part, part.FileName(), title, caption)
+			if err != nil {
+				return err
+			}
+
+		case "title", "caption":
+			value, err := io.ReadAll(io.LimitReader(part, maxFieldSize))
+			if err != nil {
+				return types.ErrBadRequest("Malformed multipart body!").WithCause(err)
+			}
+			if part.FormName() == "title" {
+				title = strings.TrimSpace(string(value))
+			} else {
+				caption = strings.TrimSpace(string(value))
+			}
+		}
+		part.Close()
+	}
+
+	if p == nil {
+		return types.ErrValidation("No file was uploaded!", types.FieldError{
+			Field:   "file",
+			Code:    "required",
+			Message: "must contain the photo or video",
+		})
+	}
+
+	if (len(title) != 0 && title != p.Title) || caption != p.Caption {
+		if len(title) != 0 {
+			p.Title = title
+		}
+		p.Caption = caption
+		if err := UpdateDetails(r.Context(), p); err != nil {
+			return err
+		}
+	}
+
+	util.WriteJSON(w, http.StatusCreated, p)
+	return nil
 }
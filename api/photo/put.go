@@ -1,7 +1,23 @@
 package photo
 
-import "net/http"
+import (
+	"LocalDex/util"
+	"net/http"
+)
 
-func PutMultiple(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("Put Multiple Photo"))
+// PutMultiple recovers the photos listed in `ids` from the trash. IDs that
+// aren't in the trash are skipped; the response lists the rest.
+func PutMultiple(w http.ResponseWriter, r *http.Request) error {
+	ids, err := util.ParseIDs(r.URL.Query().Get("ids"), "ids")
+	if err != nil {
+		return err
+	}
+
+	restored, err := Recover(r.Context(), ids)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"restored": restored})
+	return nil
 }
@@ -0,0 +1,404 @@
+package photo
+
+import (
+	"LocalDex/db"
+	"LocalDex/logger"
+	"LocalDex/mediainfo"
+	"LocalDex/thumb"
+	"LocalDex/trash"
+	"LocalDex/types"
+	"LocalDex/util"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// INFO: Service calls shared by the JSON API and the SSR loaders, so a page
+// preloads exactly what the client would otherwise fetch.
+
+// ParseListQuery validates the query string of a photo listing, including
+// the filter expression.
+func ParseListQuery(values url.Values) (types.ListQuery, error) {
+	q, err := util.ParseListQuery(values, db.PhotoSorts.Keys())
+	if err != nil {
+		return q, err
+	}
+	return q, CheckFilter(q.Filter)
+}
+
+// CheckFilter validates a photo filter expression.
+func CheckFilter(expr string) error {
+	return util.FilterError(db.CheckFilter(types.MediaPhoto, expr))
+}
+
+// List returns one page of the photo library.
+func List(ctx context.Context, q types.ListQuery) (*types.Page[types.Photo], error) {
+	items, total, err := db.ListPhotos(ctx, q)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to list photos!").WithCause(err)
+	}
+	return types.NewPage(items, q, total), nil
+}
+
+// Find returns a live photo. The photo library is private, so photos are only
+// handed out to signed-in users.
+func Find(ctx context.Context, id int64, authenticated bool) (*types.Photo, error) {
+	if !authenticated {
+		return nil, types.ErrUnauthorized(types.ErrCodeUnauthorized, "Sign in to view this photo.")
+	}
+
+	p, err := db.GetPhoto(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Photo not found!")
+	}
+	if errors.Is(err, db.ErrDeleted) {
+		return nil, types.ErrGone("Photo was deleted!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to load photo!").WithCause(err)
+	}
+	return p, nil
+}
+
+// storeDir is where uploaded photos live, named after their SHA-256 so the
+// same file is only stored once.
+func storeDir() string {
+	return filepath.Join(os.Getenv("APP_ROOT"), "library", "photo")
+}
+
+// Import stores an uploaded photo or video, reads its metadata and adds it to
+// the library. Thumbnails are generated in the background.
+func Import(ctx context.Context, src io.Reader, filename string, title string, caption string) (*types.Photo, error) {
+	if err := os.MkdirAll(storeDir(), 0755); err != nil {
+		return nil, types.ErrInternal("Failed to prepare photo storage!").WithCause(err)
+	}
+
+	tmp, err := os.CreateTemp(storeDir(), ".upload-*")
+	if err != nil {
+		return nil, types.ErrInternal("Failed to store upload!").WithCause(err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), src)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, types.NewAPIError(http.StatusRequestEntityTooLarge, types.ErrCodePayloadTooLarge, "Upload is too large!")
+		}
+		return nil, types.ErrBadRequest("Failed to read upload!").WithCause(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, types.ErrInternal("Failed to store upload!").WithCause(err)
+	}
+
+	return store(ctx, tmp.Name(), size, hex.EncodeToString(hash.Sum(nil)), filename, title, caption)
+}
+
+// ImportFile adds a file that is already on disk, such as a finished resumable
+// upload, to the library. sum is its hex SHA-256 when the caller already
+// verified it, or empty. The file is moved into the photo store; it stays
+// where it is when the import fails.
+func ImportFile(ctx context.Context, path string, sum string, filename string, title string, caption string) (*types.Photo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to open upload!").WithCause(err)
+	}
+	if err := os.MkdirAll(storeDir(), 0755); err != nil {
+		return nil, types.ErrInternal("Failed to prepare photo storage!").WithCause(err)
+	}
+
+	if len(sum) == 0 {
+		if sum, _, err = hashFile(path, ""); err != nil {
+			return nil, types.ErrInternal("Failed to hash upload!").WithCause(err)
+		}
+	}
+
+	return store(ctx, path, info.Size(), sum, filename, title, caption)
+}
+
+// describe reads the type, dimensions and capture metadata of a photo or
+// video on disk.
+func describe(path string, size int64) (*types.Photo, error) {
+	if size == 0 {
+		return nil, types.ErrValidation("Upload is empty!")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to open upload!").WithCause(err)
+	}
+	defer f.Close()
+
+	info, err := mediainfo.Read(f, size)
+	if err != nil {
+		// Unknown containers are still fine as long as they sniff as media
+		head := make([]byte, 512)
+		n, _ := f.ReadAt(head, 0)
+		mime := http.DetectContentType(head[:n])
+		if !strings.HasPrefix(mime, "image/") && !strings.HasPrefix(mime, "video/") {
+			return nil, types.NewAPIError(http.StatusUnsupportedMediaType, types.ErrCodeUnsupportedMedia, "Only images and videos can be added to the photo library!")
+		}
+		info = &mediainfo.Info{MimeType: mime}
+		info.Orientation = 1
+	}
+
+	p := &types.Photo{
+		FilePath:      path,
+		MimeType:      info.MimeType,
+		Size:          size,
+		Width:         info.Width,
+		Height:        info.Height,
+		Duration:      info.Duration,
+		PhotoMetadata: info.PhotoMetadata,
+	}
+	if strings.HasPrefix(p.MimeType, "image/") {
+		if dhash, err := thumb.DHash(path); err == nil {
+			p.DHash = &dhash
+		}
+	}
+	return p, nil
+}
+
+// titleOf is the title a photo gets when none is given: its filename.
+func titleOf(filename string) string {
+	return strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+}
+
+// duplicateOf is the error for uploading the file of an existing photo,
+// which may be in the trash.
+func duplicateOf(existing *types.Photo) error {
+	if existing.DeletedAt != nil {
+		return types.ErrConflict("This file is in the trash!").WithDetails(types.FieldError{
+			Field:   "file",
+			Code:    "duplicate",
+			Message: "same file as photo " + strconv.FormatInt(existing.ID, 10) + ", restore it instead",
+		})
+	}
+	return types.ErrConflict("This file is already in the library!").WithDetails(types.FieldError{
+		Field:   "file",
+		Code:    "duplicate",
+		Message: "same file as photo " + strconv.FormatInt(existing.ID, 10),
+	})
+}
+
+// store moves a fully received file into the content-addressed photo store
+// and creates its library entry.
+func store(ctx context.Context, path string, size int64, sum string, filename string, title string, caption string) (*types.Photo, error) {
+	p, err := describe(path, size)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing, err := db.PhotoBySHA256(ctx, sum); err == nil {
+		return nil, duplicateOf(existing)
+	} else if !errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrInternal("Failed to check for duplicates!").WithCause(err)
+	}
+
+	dest := filepath.Join(storeDir(), sum[:2], sum+strings.ToLower(filepath.Ext(filename)))
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, types.ErrInternal("Failed to prepare photo storage!").WithCause(err)
+	}
+	// INFO: The store may already hold the file, left by a concurrent upload
+	// of it or a legacy row. The bytes are the same, so the upload is only
+	// dropped once the photo is saved, and that file is never moved.
+	_, statErr := os.Stat(dest)
+	moved := errors.Is(statErr, os.ErrNotExist)
+	if moved {
+		if err := os.Rename(path, dest); err != nil {
+			return nil, types.ErrInternal("Failed to store upload!").WithCause(err)
+		}
+	}
+
+	if len(title) == 0 {
+		title = titleOf(filename)
+	}
+	p.Title, p.Caption, p.FilePath, p.SHA256, p.Stored = title, caption, dest, sum, true
+
+	if err := db.CreatePhoto(ctx, p); err != nil {
+		if moved {
+			os.Rename(dest, path)
+		}
+		if errors.Is(err, db.ErrConflict) {
+			if existing, err := db.PhotoBySHA256(ctx, sum); err == nil {
+				return nil, duplicateOf(existing)
+			}
+			return nil, types.ErrConflict("This file is already in the library!")
+		}
+		return nil, types.ErrInternal("Failed to save photo!").WithCause(err)
+	}
+	if !moved {
+		os.Remove(path)
+	}
+
+	if strings.HasPrefix(p.MimeType, "image/") {
+		thumb.Enqueue(p.FilePath, p.Orientation)
+	}
+	return p, nil
+}
+
+// IndexFile adds a photo or video from a library root without moving it.
+// Duplicates are indexed as well; the duplicate finder sorts them out.
+func IndexFile(ctx context.Context, path string) (*types.Photo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to open file!").WithCause(err)
+	}
+
+	p, err := describe(path, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	if p.SHA256, _, err = hashFile(path, ""); err != nil {
+		return nil, types.ErrInternal("Failed to hash file!").WithCause(err)
+	}
+	p.Title = titleOf(path)
+
+	if err := db.CreatePhoto(ctx, p); err != nil {
+		return nil, types.ErrInternal("Failed to save photo!").WithCause(err)
+	}
+
+	if strings.HasPrefix(p.MimeType, "image/") {
+		thumb.Enqueue(p.FilePath, p.Orientation)
+	}
+	return p, nil
+}
+
+// RefreshFile rereads the file of an indexed photo that changed on disk.
+func RefreshFile(ctx context.Context, id int64, path string) (*types.Photo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to open file!").WithCause(err)
+	}
+
+	p, err := describe(path, stat.Size())
+	if err != nil {
+		return nil, err
+	}
+	if p.SHA256, _, err = hashFile(path, ""); err != nil {
+		return nil, types.ErrInternal("Failed to hash file!").WithCause(err)
+	}
+	p.ID = id
+
+	err = db.UpdatePhotoFile(ctx, p)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Photo not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to save photo!").WithCause(err)
+	}
+
+	if strings.HasPrefix(p.MimeType, "image/") {
+		thumb.Enqueue(p.FilePath, p.Orientation)
+	}
+	return p, nil
+}
+
+// UpdateDetails saves the edited title, caption and metadata of a photo.
+func UpdateDetails(ctx context.Context, p *types.Photo) error {
+	err := db.UpdatePhotoDetails(ctx, p)
+	if errors.Is(err, db.ErrNotFound) {
+		return types.ErrNotFound("Photo not found!")
+	}
+	if err != nil {
+		return types.ErrInternal("Failed to update photo!").WithCause(err)
+	}
+	return nil
+}
+
+// Delete moves photos to the trash and returns the IDs that were deleted.
+func Delete(ctx context.Context, ids []int64) ([]int64, error) {
+	deleted, err := db.SoftDeletePhotos(ctx, ids)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to delete photos!").WithCause(err)
+	}
+	if deleted == nil {
+		deleted = []int64{}
+	}
+	return deleted, nil
+}
+
+// Recover takes photos out of the trash and returns the IDs that were
+// restored.
+func Recover(ctx context.Context, ids []int64) ([]int64, error) {
+	restored, err := trash.Restore(ctx, types.MediaPhoto, ids)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to recover photos!").WithCause(err)
+	}
+	return restored, nil
+}
+
+// hashFile computes the content hash of a file and, for images, its
+// perceptual hash.
+func hashFile(path string, mimeType string) (string, *uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", nil, err
+	}
+
+	var dhash *uint64
+	if strings.HasPrefix(mimeType, "image/") {
+		if h, err := thumb.DHash(path); err == nil {
+			dhash = &h
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), dhash, nil
+}
+
+// BackfillHashes hashes the photos added before duplicate detection existed.
+// It runs once at startup; photos whose file is missing are skipped and
+// retried on the next start.
+func BackfillHashes() {
+	const batch = 100
+
+	var (
+		ctx    = context.Background()
+		lastID int64
+		hashed int
+	)
+	for {
+		photos, err := db.UnhashedPhotos(ctx, lastID, batch)
+		if err != nil {
+			logger.TimedError("failed to load photos to hash:", err.Error())
+			return
+		}
+
+		for _, p := range photos {
+			lastID = p.ID
+
+			sum, dhash, err := hashFile(p.FilePath, p.MimeType)
+			if err != nil {
+				continue
+			}
+			if err := db.SetPhotoHashes(ctx, p.ID, sum, dhash); err != nil {
+				logger.TimedError("failed to store hashes of photo", p.ID, ":", err.Error())
+				return
+			}
+			hashed++
+		}
+
+		if len(photos) < batch {
+			break
+		}
+	}
+
+	if hashed > 0 {
+		logger.TimedOkay("Hashed", hashed, "photos for duplicate detection.")
+	}
+}
@@ -0,0 +1,24 @@
+package photo
+
+import (
+	"LocalDex/api/auth"
+	"LocalDex/util"
+	"net/http"
+)
+
+// GetThumb streams a downscaled JPEG or WebP of the photo, see thumb.Sizes and
+// thumb.Formats for the `size` and `format` values.
+func GetThumb(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	p, err := Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=604800")
+	return util.ServeThumbnail(w, r, p.FilePath, p.Orientation)
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	vars "LocalDex"
 	"LocalDex/logger"
 	"LocalDex/types"
 	"LocalDex/util"
@@ -9,18 +8,46 @@ import (
 	"os"
 	"runtime"
 	"strings"
-
-	"io/fs"
-	"mime"
-	"path/filepath"
 )
 
 var getOnlyRoute = util.AddrOf("Only Request with GET Method are allowed!")
 
+// matchApiRoute resolves API routes with path parameters (e.g. `GET /photo/{id}`),
+// for lookups that found no exact entry in ApiRoutes.
+// When several patterns match, the one with the most literal segments wins.
+func matchApiRoute(method string, path string) (types.APIHandler, map[string]string, bool) {
+	var (
+		best       types.APIHandler
+		bestParams map[string]string
+		bestScore  = -1
+	)
+
+	for key, handler := range ApiRoutes {
+		routeMethod, pattern, ok := strings.Cut(key, " ")
+		if !ok || routeMethod != method || !strings.ContainsAny(pattern, "{:*") {
+			continue
+		}
+
+		params, ok := util.MatchPath(pattern, path)
+		if !ok {
+			continue
+		}
+
+		score := strings.Count(pattern, "/") - len(params)
+		if score > bestScore {
+			best, bestParams, bestScore = handler, params, score
+		}
+	}
+
+	return best, bestParams, best != nil
+}
+
 func HandleRouting() *http.ServeMux {
 	router := http.NewServeMux()
 
 	router.HandleFunc("/", ServePages)
+	router.HandleFunc("/robots.txt", RobotsHandler)
+	router.HandleFunc("/sitemap.xml", SitemapHandler)
 
 	router.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
 		if !strings.HasPrefix(r.URL.Path, "/api/") {
@@ -39,11 +66,19 @@ func HandleRouting() *http.ServeMux {
 		lookupKey := method + " /" + path
 
 		if handler, exists := ApiRoutes[lookupKey]; exists {
-			NoCache(handler)(w, r)
+			NoCache(util.Handle(handler))(w, r)
 			return
 		}
 
-		NotFoundAPI(w, r, util.AddrOf("API Route Not Found!"))
+		if handler, params, exists := matchApiRoute(method, "/"+path); exists {
+			for name, value := range params {
+				r.SetPathValue(name, value)
+			}
+			NoCache(util.Handle(handler))(w, r)
+			return
+		}
+
+		util.WriteProblem(w, r, types.NewAPIError(http.StatusNotFound, types.ErrCodeRouteNotFound, "API Route Not Found!"))
 	})
 
 	router.HandleFunc("/assets/", func(w http.ResponseWriter, r *http.Request) {
@@ -53,14 +88,13 @@ func HandleRouting() *http.ServeMux {
 		}
 
 		path := strings.TrimPrefix(r.URL.Path, "/")
-		content, err := fs.ReadFile(vars.AssetsFS, path)
-		if err != nil {
+		asset, ok := lookupEmbeddedAsset(assetsFSKey, path)
+		if !ok {
 			NotFoundAPI(w, r, util.AddrOf("Requested Asset was not found"))
 			return
 		}
 
-		ext := filepath.Ext(path)
-		mimeType := mime.TypeByExtension(ext)
+		var mimeType string
 
 		switch path {
 		case "assets/sw.js":
@@ -71,17 +105,9 @@ func HandleRouting() *http.ServeMux {
 			mimeType = "application/manifest+json"
 			w.Header().Set("Service-Worker-Allowed", "/")
 			break
-
-		default:
-			if len(mimeType) == 0 {
-				mimeType = "application/octet-stream"
-			}
-			break
 		}
 
-		w.Header().Set("Content-Type", mimeType)
-		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-		w.Write(content)
+		serveEmbeddedAsset(w, r, asset, mimeType)
 	})
 
 	router.HandleFunc("/src/", func(w http.ResponseWriter, r *http.Request) {
@@ -95,21 +121,13 @@ func HandleRouting() *http.ServeMux {
 		}
 
 		path := strings.TrimPrefix(r.URL.Path, "/")
-		content, err := fs.ReadFile(vars.ViteFS, "client/dist/"+path)
-		if err != nil {
+		asset, ok := lookupEmbeddedAsset(viteFSKey, viteDistPrefix+path)
+		if !ok {
 			NotFoundAPI(w, r, util.AddrOf("Requested Source file was not found!"))
 			return
 		}
 
-		ext := filepath.Ext(path)
-		mimeType := mime.TypeByExtension(ext)
-		if len(mimeType) == 0 {
-			mimeType = "application/octet-stream"
-		}
-
-		w.Header().Set("Content-Type", mimeType)
-		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
-		w.Write(content)
+		serveEmbeddedAsset(w, r, asset, "")
 	})
 
 	return router
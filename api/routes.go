@@ -1,12 +1,89 @@
 package api
 
 import (
+	"LocalDex/api/album"
+	"LocalDex/api/anime"
 	"LocalDex/api/auth"
-	"net/http"
+	"LocalDex/api/manga"
+	"LocalDex/api/photo"
+	"LocalDex/api/tag"
+	"LocalDex/api/upload"
+	"LocalDex/types"
 )
 
-var ApiRoutes = map[string]http.HandlerFunc{
+var ApiRoutes = map[string]types.APIHandler{
 	"POST /auth/login":      auth.SendOTPHandler,
 	"POST /auth/verify_otp": auth.VerifyOTPHandler,
 	"GET /auth/status":      auth.VerifyAuthStatus,
+	"GET /auth/csrf":        auth.CSRFTokenHandler,
+	"POST /csp-report":      CSPReportHandler,
+	"GET /metrics":          auth.Protected(MetricsHandler),
+
+	"GET /admin/backup":                 auth.Protected(ListBackupsHandler),
+	"POST /admin/backup":                auth.Protected(CreateBackupHandler),
+	"POST /admin/backup/{name}/restore": auth.Protected(RestoreBackupHandler),
+	"GET /admin/integrity":              auth.Protected(IntegrityCheckHandler),
+	"GET /admin/library/scan":           auth.Protected(LibraryScanStatusHandler),
+	"POST /admin/library/scan":          auth.Protected(StartLibraryScanHandler),
+	"GET /admin/library/offline":        auth.Protected(OfflineLibraryFilesHandler),
+	"GET /trash":                        auth.Protected(ListTrashHandler),
+	"POST /trash/restore":               auth.Protected(RestoreTrashHandler),
+	"DELETE /trash":                     auth.Protected(PurgeTrashHandler),
+	"GET /search":                       auth.Protected(SearchHandler),
+
+	"GET /photo":                                      auth.Protected(photo.GetMultiple),
+	"POST /photo":                                     auth.Protected(photo.Post),
+	"DELETE /photo":                                   auth.Protected(photo.DeleteMultiple),
+	"PUT /photo/recover":                              auth.Protected(photo.PutMultiple),
+	"GET /photo/duplicates":                           auth.Protected(photo.GetDuplicates),
+	"POST /photo/duplicates/resolve":                  auth.Protected(photo.ResolveDuplicates),
+	"GET /photo/{id}":                                 auth.Protected(photo.Get),
+	"GET /photo/{id}/file":                            auth.Protected(photo.GetFile),
+	"GET /photo/{id}/thumb":                           auth.Protected(photo.GetThumb),
+	"PATCH /photo/{id}/metadata":                      auth.Protected(photo.PatchMetadata),
+	"GET /photo/{id}/tags":                            auth.Protected(photo.GetTags),
+	"PUT /photo/{id}/tags":                            auth.Protected(photo.PutTags),
+	"GET /album":                                      auth.Protected(album.GetMultiple),
+	"POST /album":                                     auth.Protected(album.Post),
+	"GET /album/{id}":                                 auth.Protected(album.Get),
+	"PATCH /album/{id}":                               auth.Protected(album.Patch),
+	"DELETE /album/{id}":                              auth.Protected(album.Delete),
+	"GET /album/{id}/photos":                          auth.Protected(album.GetPhotos),
+	"POST /album/{id}/photos":                         auth.Protected(album.PostPhotos),
+	"DELETE /album/{id}/photos":                       auth.Protected(album.DeletePhotos),
+	"PUT /album/{id}/photos/order":                    auth.Protected(album.PutOrder),
+	"GET /anime":                                      auth.Protected(anime.GetMultiple),
+	"GET /anime/{id}":                                 anime.Get,
+	"POST /anime":                                     auth.Protected(anime.Post),
+	"DELETE /anime/{id}":                              auth.Protected(anime.Delete),
+	"GET /anime/{id}/cover":                           anime.GetCover,
+	"GET /anime/{id}/episodes":                        auth.Protected(anime.GetEpisodes),
+	"GET /anime/{id}/tags":                            auth.Protected(anime.GetTags),
+	"PUT /anime/{id}/tags":                            auth.Protected(anime.PutTags),
+	"GET /manga":                                      auth.Protected(manga.GetMultiple),
+	"GET /manga/{id}":                                 manga.Get,
+	"POST /manga":                                     auth.Protected(manga.Post),
+	"DELETE /manga/{id}":                              auth.Protected(manga.Delete),
+	"GET /manga/{id}/cover":                           manga.GetCover,
+	"GET /manga/{id}/chapters":                        auth.Protected(manga.GetChapters),
+	"GET /manga/{id}/chapters/{chapter}/pages":        auth.Protected(manga.GetPages),
+	"GET /manga/{id}/chapters/{chapter}/pages/{page}": auth.Protected(manga.GetPage),
+	"GET /manga/{id}/tags":                            auth.Protected(manga.GetTags),
+	"PUT /manga/{id}/tags":                            auth.Protected(manga.PutTags),
+
+	"GET /tags":                                auth.Protected(tag.GetMultiple),
+	"POST /tags":                               auth.Protected(tag.Post),
+	"POST /tags/bulk":                          auth.Protected(tag.PostBulk),
+	"GET /tags/{id}":                           auth.Protected(tag.Get),
+	"DELETE /tags/{id}":                        auth.Protected(tag.Delete),
+	"POST /tags/{id}/aliases":                  auth.Protected(tag.PostAlias),
+	"POST /tags/{id}/implications":             auth.Protected(tag.PostImplication),
+	"DELETE /tags/{id}/implications/{implied}": auth.Protected(tag.DeleteImplication),
+
+	"OPTIONS /upload":     auth.Protected(upload.Options),
+	"POST /upload":        auth.Protected(upload.Post),
+	"HEAD /upload/{id}":   auth.Protected(upload.Head),
+	"GET /upload/{id}":    auth.Protected(upload.Get),
+	"PATCH /upload/{id}":  auth.Protected(upload.Patch),
+	"DELETE /upload/{id}": auth.Protected(upload.Delete),
 }
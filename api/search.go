@@ -0,0 +1,61 @@
+package api
+
+import (
+	"LocalDex/db"
+	"LocalDex/types"
+	"LocalDex/util"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxSearchQuery = 200
+
+// SearchHandler searches photos, anime and manga, or only those of `kind`,
+// for every word of `q`. Hits come best first with the matches wrapped in
+// <mark>, along with the number of hits of each kind.
+func SearchHandler(w http.ResponseWriter, r *http.Request) error {
+	values := r.URL.Query()
+
+	text := strings.TrimSpace(values.Get("q"))
+	if len(text) == 0 || utf8.RuneCountInString(text) > maxSearchQuery {
+		return types.ErrValidation("Invalid search query!", types.FieldError{
+			Field:   "q",
+			Code:    "invalid",
+			Message: "must be between 1 and 200 characters",
+		})
+	}
+
+	kind := values.Get("kind")
+	switch kind {
+	case "", types.MediaPhoto, types.MediaAnime, types.MediaManga:
+	default:
+		return types.ErrValidation("Invalid search query!", types.FieldError{
+			Field:   "kind",
+			Code:    "invalid",
+			Message: "must be one of photo, anime or manga",
+		})
+	}
+
+	q, err := util.ParseListQuery(values, []string{"relevance"})
+	if err != nil {
+		return err
+	}
+
+	results, facets, err := db.Search(r.Context(), text, kind, q)
+	if err != nil {
+		return types.ErrInternal("Failed to search the library!").WithCause(err)
+	}
+
+	total := facets[kind]
+	if len(kind) == 0 {
+		total = facets[types.MediaPhoto] + facets[types.MediaAnime] + facets[types.MediaManga]
+	}
+
+	util.WriteJSON(w, http.StatusOK, types.SearchResults{
+		Page:   types.NewPage(results, q, total),
+		Query:  text,
+		Facets: facets,
+	})
+	return nil
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"LocalDex/logger"
+	"LocalDex/settings"
+	"LocalDex/types"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+type contextKey string
+
+const nonceContextKey contextKey = "csp_nonce"
+
+// Largest CSP report body the collector is willing to read.
+const maxCSPReportSize = 64 << 10
+
+// CSPNonce returns the per-request nonce generated by SecurityHeadersMiddleware,
+// or an empty string when the request didn't pass through it.
+func CSPNonce(r *http.Request) string {
+	if nonce, ok := r.Context().Value(nonceContextKey).(string); ok {
+		return nonce
+	}
+	return ""
+}
+
+func generateNonce() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+// cspDirectivesFor resolves the directives for a path: the configured defaults,
+// overlaid (or replaced) by the longest matching per-route override.
+func cspDirectivesFor(cfg types.CSPConfig, path string) map[string][]string {
+	var route *types.CSPRoute
+	for i := range cfg.Routes {
+		if strings.HasPrefix(path, cfg.Routes[i].Prefix) && (route == nil || len(cfg.Routes[i].Prefix) > len(route.Prefix)) {
+			route = &cfg.Routes[i]
+		}
+	}
+
+	directives := make(map[string][]string)
+	if route == nil || !route.Replace {
+		for name, values := range cfg.Directives {
+			directives[name] = values
+		}
+	}
+	if route != nil {
+		for name, values := range route.Directives {
+			directives[name] = values
+		}
+	}
+	return directives
+}
+
+// buildCSP serialises the directives in a stable order, adding the request
+// nonce to script-src so inline scripts don't need 'unsafe-inline'.
+func buildCSP(cfg types.CSPConfig, path string, nonce string) string {
+	directives := cspDirectivesFor(cfg, path)
+
+	names := make([]string, 0, len(directives))
+	for name := range directives {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		// default-src first purely for readability
+		if names[i] == "default-src" || names[j] == "default-src" {
+			return names[i] == "default-src"
+		}
+		return names[i] < names[j]
+	})
+
+	parts := make([]string, 0, len(names)+1)
+	for _, name := range names {
+		values := directives[name]
+		if name == "script-src" && len(nonce) != 0 {
+			filtered := make([]string, 0, len(values)+1)
+			for _, v := range values {
+				// A nonce makes browsers ignore 'unsafe-inline' anyway; drop it so the policy reads honestly.
+				if v != "'unsafe-inline'" {
+					filtered = append(filtered, v)
+				}
+			}
+			values = append(filtered, "'nonce-"+nonce+"'")
+		}
+
+		if len(values) == 0 {
+			parts = append(parts, name)
+		} else {
+			parts = append(parts, name+" "+strings.Join(values, " "))
+		}
+	}
+
+	if len(cfg.ReportURI) != 0 {
+		parts = append(parts, "report-uri "+cfg.ReportURI)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// SecurityHeadersMiddleware applies the configured security headers to every
+// response, including API errors and embedded assets. In production it also
+// sends the Content-Security-Policy (or its report-only variant) and HSTS; the
+// Vite dev server injects inline scripts and websockets that a strict policy
+// would block, so those two are left out during development.
+func SecurityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := settings.Get().Security
+		h := w.Header()
+
+		nonce, err := generateNonce()
+		if err != nil {
+			logger.TimedError("failed to generate CSP nonce:\n    " + err.Error())
+			InternalErrorAPI(w, r, nil)
+			return
+		}
+		r = r.WithContext(context.WithValue(r.Context(), nonceContextKey, nonce))
+
+		h.Set("X-Content-Type-Options", "nosniff")
+		if len(cfg.FrameOptions) != 0 {
+			h.Set("X-Frame-Options", cfg.FrameOptions)
+		}
+		if len(cfg.ReferrerPolicy) != 0 {
+			h.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		if len(cfg.PermissionsPolicy) != 0 {
+			h.Set("Permissions-Policy", cfg.PermissionsPolicy)
+		}
+		if len(cfg.CrossOriginOpenerPolicy) != 0 {
+			h.Set("Cross-Origin-Opener-Policy", cfg.CrossOriginOpenerPolicy)
+		}
+
+		if os.Getenv("ENV") == types.ENV.Prod {
+			if len(cfg.HSTS) != 0 {
+				h.Set("Strict-Transport-Security", cfg.HSTS)
+			}
+
+			if len(cfg.CSP.Directives) != 0 || len(cfg.CSP.Routes) != 0 {
+				header := "Content-Security-Policy"
+				if cfg.CSP.ReportOnly {
+					header = "Content-Security-Policy-Report-Only"
+				}
+				h.Set(header, buildCSP(cfg.CSP, r.URL.Path, nonce))
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CSPReportHandler collects violation reports sent by browsers, both the legacy
+// `application/csp-report` body and the Reporting API's `application/reports+json`.
+func CSPReportHandler(w http.ResponseWriter, r *http.Request) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxCSPReportSize))
+	if err != nil {
+		return types.ErrBadRequest("Failed to read CSP report!")
+	}
+
+	var report any
+	if err := json.Unmarshal(body, &report); err != nil {
+		return types.ErrBadRequest("CSP report is not valid JSON!")
+	}
+
+	formatted, _ := json.Marshal(report)
+	logger.TimedWarning("CSP violation reported by", r.RemoteAddr+":\n    ", string(formatted))
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"LocalDex/db"
+	"LocalDex/logger"
+	"LocalDex/parser"
+	"LocalDex/settings"
+	"LocalDex/types"
+	"LocalDex/util"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Crawlers don't need these to be fresher than an hour.
+const seoCacheControl = "public, max-age=3600"
+
+// Sitemaps are capped at 50,000 URLs by the protocol.
+const maxSitemapURLs = 50000
+
+func absoluteURL(path string) string {
+	return strings.TrimSuffix(os.Getenv("HOST"), "/") + path
+}
+
+// BuildRobots renders robots.txt from the configuration. When the sitemap is
+// enabled but no sitemap is listed, the built-in one is advertised.
+func BuildRobots(cfg types.ServerConfig) string {
+	var b strings.Builder
+
+	for i, rule := range cfg.Robots.Rules {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		userAgent := rule.UserAgent
+		if len(userAgent) == 0 {
+			userAgent = "*"
+		}
+		b.WriteString("User-agent: " + userAgent + "\n")
+
+		for _, path := range rule.Allow {
+			b.WriteString("Allow: " + path + "\n")
+		}
+		for _, path := range rule.Disallow {
+			b.WriteString("Disallow: " + path + "\n")
+		}
+		// An empty group is invalid; spell out that everything is allowed
+		if len(rule.Allow) == 0 && len(rule.Disallow) == 0 {
+			b.WriteString("Disallow:\n")
+		}
+		if rule.CrawlDelay != nil {
+			b.WriteString("Crawl-delay: " + strconv.Itoa(*rule.CrawlDelay) + "\n")
+		}
+	}
+
+	if len(cfg.Robots.Host) != 0 {
+		b.WriteString("\nHost: " + cfg.Robots.Host + "\n")
+	}
+
+	sitemaps := cfg.Robots.Sitemaps
+	if len(sitemaps) == 0 && cfg.Sitemap.Enabled {
+		sitemaps = []string{absoluteURL("/sitemap.xml")}
+	}
+	if len(sitemaps) != 0 {
+		b.WriteString("\n")
+		for _, sitemap := range sitemaps {
+			b.WriteString("Sitemap: " + sitemap + "\n")
+		}
+	}
+
+	return b.String()
+}
+
+func RobotsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		MethodNotAllowed(w, r, getOnlyRoute)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", seoCacheControl)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write([]byte(BuildRobots(settings.Get())))
+	}
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+// SitemapHandler lists the static pages and, for the configured media kinds,
+// every public library item. It answers 404 unless the sitemap is enabled.
+func SitemapHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		MethodNotAllowed(w, r, getOnlyRoute)
+		return
+	}
+
+	cfg := settings.Get().Sitemap
+	if !cfg.Enabled {
+		NotFoundAPI(w, r, util.AddrOf("Sitemap is disabled!"))
+		return
+	}
+
+	set := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+
+	paths, err := parser.StaticPagePaths()
+	if err != nil {
+		InternalErrorAPI(w, r, util.AddrOf("Failed to build the sitemap!"))
+		logger.TimedError("failed to list static routes for sitemap:\n    " + err.Error())
+		return
+	}
+	for _, path := range paths {
+		set.URLs = append(set.URLs, sitemapURL{Loc: absoluteURL(path)})
+	}
+
+	for _, kind := range cfg.Dynamic {
+		stamps, err := db.ItemStamps(r.Context(), kind)
+		if err != nil {
+			InternalErrorAPI(w, r, util.AddrOf("Failed to build the sitemap!"))
+			logger.TimedError("failed to list", kind, "items for sitemap:\n    "+err.Error())
+			return
+		}
+
+		for _, stamp := range stamps {
+			set.URLs = append(set.URLs, sitemapURL{
+				Loc:     absoluteURL(fmt.Sprintf("/%s/%d", kind, stamp.ID)),
+				LastMod: stamp.UpdatedAt.Format(time.DateOnly),
+			})
+		}
+	}
+
+	if len(set.URLs) > maxSitemapURLs {
+		logger.TimedWarning("sitemap truncated to", maxSitemapURLs, "of", len(set.URLs), "URLs")
+		set.URLs = set.URLs[:maxSitemapURLs]
+	}
+
+	body, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		InternalErrorAPI(w, r, util.AddrOf("Failed to build the sitemap!"))
+		logger.TimedError("failed to encode sitemap:\n    " + err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", seoCacheControl)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write([]byte(xml.Header))
+		w.Write(body)
+	}
+}
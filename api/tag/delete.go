@@ -0,0 +1,42 @@
+package tag
+
+import (
+	"LocalDex/util"
+	"net/http"
+)
+
+// Delete removes the tag in the path along with its aliases and
+// implications, untagging every item carrying it.
+func Delete(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	if err := Remove(r.Context(), id); err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"deleted": id})
+	return nil
+}
+
+// DeleteImplication stops the tag in the path from implying `implied`. Items
+// keep the tags they already have.
+func DeleteImplication(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+	implied, err := util.PathID(r, "implied")
+	if err != nil {
+		return err
+	}
+
+	if err := Unimply(r.Context(), id, implied); err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"removed": implied})
+	return nil
+}
@@ -0,0 +1,57 @@
+package tag
+
+import (
+	"LocalDex/types"
+	"LocalDex/util"
+	"net/http"
+	"strconv"
+)
+
+// INFO: Bounds of the `limit` parameter of tag autocomplete
+const (
+	defaultSuggestions = 10
+	maxSuggestions     = 50
+)
+
+// GetMultiple autocompletes tags: it lists the tags whose name, or
+// `namespace:name`, starts with `prefix`, most used first.
+func GetMultiple(w http.ResponseWriter, r *http.Request) error {
+	values := r.URL.Query()
+
+	limit := defaultSuggestions
+	if v := values.Get("limit"); len(v) != 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSuggestions {
+			return types.ErrValidation("Invalid tag query!", types.FieldError{
+				Field:   "limit",
+				Code:    "out_of_range",
+				Message: "must be a number between 1 and " + strconv.Itoa(maxSuggestions),
+			})
+		}
+		limit = n
+	}
+
+	tags, err := Search(r.Context(), values.Get("prefix"), limit)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, tags)
+	return nil
+}
+
+// Get returns a single tag with its aliases and implications.
+func Get(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	t, err := Find(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, t)
+	return nil
+}
@@ -0,0 +1,136 @@
+package tag
+
+import (
+	"LocalDex/types"
+	"LocalDex/util"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// decodeTag reads a body holding a single tag under field.
+func decodeTag(w http.ResponseWriter, r *http.Request, field string) (types.Tag, error) {
+	var req map[string]string
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err := decoder.Decode(&req); err != nil {
+		return types.Tag{}, types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+
+	raw, ok := req[field]
+	if !ok || len(req) != 1 {
+		return types.Tag{}, types.ErrBadRequest("invalid request body: expected only `" + field + "`")
+	}
+	return ParseTag(raw, field)
+}
+
+// Post creates a tag. Tags are also created when they are first used.
+func Post(w http.ResponseWriter, r *http.Request) error {
+	t, err := decodeTag(w, r, "tag")
+	if err != nil {
+		return err
+	}
+
+	if err := Create(r.Context(), &t); err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusCreated, t)
+	return nil
+}
+
+// PostAlias makes the tag in the body an alias of the tag in the path. If it
+// already exists, its items, aliases and implications are merged over.
+func PostAlias(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	alias, err := decodeTag(w, r, "alias")
+	if err != nil {
+		return err
+	}
+
+	t, err := Alias(r.Context(), id, alias)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, t)
+	return nil
+}
+
+// PostImplication makes the tag in the path imply the tag in the body. Items
+// carrying the first are tagged with the second right away.
+func PostImplication(w http.ResponseWriter, r *http.Request) error {
+	id, err := util.PathID(r, "id")
+	if err != nil {
+		return err
+	}
+
+	implied, err := decodeTag(w, r, "implies")
+	if err != nil {
+		return err
+	}
+
+	if err := Imply(r.Context(), id, implied); err != nil {
+		return err
+	}
+
+	t, err := Find(r.Context(), id)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, t)
+	return nil
+}
+
+// PostBulk adds and removes tags on many photos, anime or manga at once.
+// Unknown and deleted items are skipped; the response lists the rest.
+func PostBulk(w http.ResponseWriter, r *http.Request) error {
+	var req struct {
+		Kind   string   `json:"kind"`
+		IDs    []int64  `json:"ids"`
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 256<<10))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		return types.ErrBadRequest("invalid request body: " + err.Error())
+	}
+
+	var details []types.FieldError
+	switch req.Kind {
+	case types.MediaPhoto, types.MediaAnime, types.MediaManga:
+	default:
+		details = append(details, types.FieldError{Field: "kind", Code: "invalid", Message: "must be one of photo, anime or manga"})
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > util.MaxBulkIDs {
+		details = append(details, types.FieldError{Field: "ids", Code: "invalid", Message: "must list between 1 and " + strconv.Itoa(util.MaxBulkIDs) + " IDs"})
+	}
+	if len(req.Add)+len(req.Remove) == 0 {
+		details = append(details, types.FieldError{Field: "add", Code: "required", Message: "must list tags to add or remove"})
+	}
+	if len(details) != 0 {
+		return types.ErrValidation("Invalid tag edit!", details...)
+	}
+
+	add, err := ParseTags(req.Add, "add")
+	if err != nil {
+		return err
+	}
+	remove, err := ParseTags(req.Remove, "remove")
+	if err != nil {
+		return err
+	}
+
+	edited, err := Edit(r.Context(), req.Kind, req.IDs, add, remove)
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"edited": edited})
+	return nil
+}
@@ -0,0 +1,181 @@
+package tag
+
+import (
+	"LocalDex/db"
+	"LocalDex/types"
+	"context"
+	"errors"
+	"strconv"
+)
+
+// Most tags a request may list
+const maxTags = 100
+
+// ParseTags validates tags written as `namespace:name` or `name`, see
+// db.ParseTag. Duplicates are dropped.
+func ParseTags(raw []string, field string) ([]types.Tag, error) {
+	if len(raw) > maxTags {
+		return nil, types.ErrValidation("Invalid tags!", types.FieldError{
+			Field:   field,
+			Code:    "invalid",
+			Message: "must not list more than " + strconv.Itoa(maxTags) + " tags",
+		})
+	}
+
+	var (
+		tags    []types.Tag
+		details []types.FieldError
+	)
+	for i, r := range raw {
+		t, err := db.ParseTag(r)
+		if err != nil {
+			details = append(details, types.FieldError{Field: field + "[" + strconv.Itoa(i) + "]", Code: "invalid", Message: err.Error()})
+			continue
+		}
+		if !containsTag(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+
+	if len(details) != 0 {
+		return nil, types.ErrValidation("Invalid tags!", details...)
+	}
+	return tags, nil
+}
+
+// ParseTag validates a single tag.
+func ParseTag(raw string, field string) (types.Tag, error) {
+	t, err := db.ParseTag(raw)
+	if err != nil {
+		return t, types.ErrValidation("Invalid tag!", types.FieldError{Field: field, Code: "invalid", Message: err.Error()})
+	}
+	return t, nil
+}
+
+func containsTag(tags []types.Tag, t types.Tag) bool {
+	for _, other := range tags {
+		if other.Tag == t.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns up to limit tags starting with prefix, most used first.
+func Search(ctx context.Context, prefix string, limit int) ([]types.Tag, error) {
+	tags, err := db.SearchTags(ctx, prefix, limit)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to search tags!").WithCause(err)
+	}
+	return tags, nil
+}
+
+// Find returns a tag with its aliases and implications.
+func Find(ctx context.Context, id int64) (*types.TagDetails, error) {
+	t, err := db.GetTag(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Tag not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to load tag!").WithCause(err)
+	}
+	return t, nil
+}
+
+// Create adds a new tag.
+func Create(ctx context.Context, t *types.Tag) error {
+	err := db.CreateTag(ctx, t)
+	if errors.Is(err, db.ErrConflict) {
+		return types.ErrConflict("Tag `" + t.Tag + "` already exists!")
+	}
+	if err != nil {
+		return types.ErrInternal("Failed to save tag!").WithCause(err)
+	}
+	return nil
+}
+
+// Remove deletes a tag and its aliases, untagging every item.
+func Remove(ctx context.Context, id int64) error {
+	err := db.DeleteTag(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return types.ErrNotFound("Tag not found!")
+	}
+	if err != nil {
+		return types.ErrInternal("Failed to delete tag!").WithCause(err)
+	}
+	return nil
+}
+
+// Alias makes alias stand for a tag, merging an existing tag of that name
+// into it.
+func Alias(ctx context.Context, id int64, alias types.Tag) (*types.Tag, error) {
+	t, err := db.AliasTag(ctx, id, alias)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Tag not found!")
+	}
+	if errors.Is(err, db.ErrConflict) {
+		return nil, types.ErrConflict("A tag can't be an alias of itself!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to alias tag!").WithCause(err)
+	}
+	return t, nil
+}
+
+// Imply makes a tag imply another and tags its items accordingly.
+func Imply(ctx context.Context, id int64, implied types.Tag) error {
+	err := db.AddImplication(ctx, id, implied)
+	if errors.Is(err, db.ErrNotFound) {
+		return types.ErrNotFound("Tag not found!")
+	}
+	if errors.Is(err, db.ErrConflict) {
+		return types.ErrConflict("Tag `" + implied.Tag + "` already implies this tag!")
+	}
+	if err != nil {
+		return types.ErrInternal("Failed to add implication!").WithCause(err)
+	}
+	return nil
+}
+
+// Unimply stops a tag from implying another.
+func Unimply(ctx context.Context, id int64, impliedID int64) error {
+	err := db.RemoveImplication(ctx, id, impliedID)
+	if errors.Is(err, db.ErrNotFound) {
+		return types.ErrNotFound("Implication not found!")
+	}
+	if err != nil {
+		return types.ErrInternal("Failed to remove implication!").WithCause(err)
+	}
+	return nil
+}
+
+// ItemTags returns the tags of an item. The caller makes sure it exists.
+func ItemTags(ctx context.Context, kind string, id int64) ([]types.Tag, error) {
+	tags, err := db.ItemTags(ctx, kind, id)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to load tags!").WithCause(err)
+	}
+	return tags, nil
+}
+
+// SetItemTags replaces the tags of an item and returns them along with the
+// ones they imply. The caller makes sure it exists.
+func SetItemTags(ctx context.Context, kind string, id int64, tags []types.Tag) ([]types.Tag, error) {
+	if err := db.SetItemTags(ctx, kind, id, tags); err != nil {
+		return nil, types.ErrInternal("Failed to save tags!").WithCause(err)
+	}
+	return ItemTags(ctx, kind, id)
+}
+
+// Edit adds and removes tags on many items of a kind and returns the IDs of
+// the live items that were edited.
+func Edit(ctx context.Context, kind string, ids []int64, add []types.Tag, remove []types.Tag) ([]int64, error) {
+	edited, err := db.EditItemTags(ctx, kind, ids, add, remove)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to edit tags!").WithCause(err)
+	}
+	if edited == nil {
+		edited = []int64{}
+	}
+	return edited, nil
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"LocalDex/logger"
+	"LocalDex/trash"
+	"LocalDex/types"
+	"LocalDex/util"
+	"net/http"
+	"net/url"
+)
+
+// trashKind reads the optional `kind` parameter, which limits a trash
+// endpoint to photos, anime or manga.
+func trashKind(values url.Values, required bool) (string, error) {
+	kind := values.Get("kind")
+	switch kind {
+	case types.MediaPhoto, types.MediaAnime, types.MediaManga:
+		return kind, nil
+	case "":
+		if !required {
+			return kind, nil
+		}
+	}
+	return "", types.ErrValidation("Invalid trash query!", types.FieldError{
+		Field:   "kind",
+		Code:    "invalid",
+		Message: "must be one of photo, anime or manga",
+	})
+}
+
+// ListTrashHandler returns one page of deleted items, most recently deleted
+// first, each with the time it will be purged when a retention is set.
+func ListTrashHandler(w http.ResponseWriter, r *http.Request) error {
+	values := r.URL.Query()
+
+	kind, err := trashKind(values, false)
+	if err != nil {
+		return err
+	}
+	q, err := util.ParseListQuery(values, []string{"deleted_desc"})
+	if err != nil {
+		return err
+	}
+
+	page, err := trash.List(r.Context(), kind, q)
+	if err != nil {
+		return types.ErrInternal("Failed to list the trash!").WithCause(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, page)
+	return nil
+}
+
+// RestoreTrashHandler takes the items of `kind` listed in `ids` out of the
+// trash. IDs that aren't in the trash are skipped; the response lists the
+// rest.
+func RestoreTrashHandler(w http.ResponseWriter, r *http.Request) error {
+	values := r.URL.Query()
+
+	kind, err := trashKind(values, true)
+	if err != nil {
+		return err
+	}
+	ids, err := util.ParseIDs(values.Get("ids"), "ids")
+	if err != nil {
+		return err
+	}
+
+	restored, err := trash.Restore(r.Context(), kind, ids)
+	if err != nil {
+		return types.ErrInternal("Failed to restore items!").WithCause(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"restored": restored})
+	return nil
+}
+
+// PurgeTrashHandler permanently deletes the items of `kind` listed in `ids`,
+// or everything in the trash with `all=true`, along with their files.
+func PurgeTrashHandler(w http.ResponseWriter, r *http.Request) error {
+	values := r.URL.Query()
+
+	if values.Get("all") == "true" {
+		count, err := trash.Empty(r.Context())
+		if err != nil {
+			return types.ErrInternal("Failed to empty the trash!").WithCause(err)
+		}
+
+		logger.TimedOkay("Emptied the trash, purging", count, "items.")
+		util.WriteJSON(w, http.StatusOK, map[string]any{"purged": count})
+		return nil
+	}
+
+	kind, err := trashKind(values, true)
+	if err != nil {
+		return err
+	}
+	ids, err := util.ParseIDs(values.Get("ids"), "ids")
+	if err != nil {
+		return err
+	}
+
+	purged, err := trash.Purge(r.Context(), kind, ids)
+	if err != nil {
+		return types.ErrInternal("Failed to purge items!").WithCause(err)
+	}
+
+	util.WriteJSON(w, http.StatusOK, map[string]any{"purged": purged})
+	return nil
+}
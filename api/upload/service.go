@@ -0,0 +1,326 @@
+package upload
+
+import (
+	"LocalDex/api/anime"
+	"LocalDex/api/photo"
+	"LocalDex/db"
+	"LocalDex/logger"
+	"LocalDex/types"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// INFO: Resumable uploads following tus 1.0 (https://tus.io/protocols/resumable-upload).
+// Offsets live in the `uploads` table and the bytes in `APP_ROOT/uploads/<id>`,
+// so an upload survives restarts. Once complete, the file is handed to the
+// photo or anime library in the background, as hashing and moving a file of
+// several gigabytes can outlast the request. A failed ingestion keeps the file
+// so it can be retried, unless the file itself was rejected.
+
+const (
+	// Largest upload accepted, reported as Tus-Max-Size
+	maxUploadSize = 64 << 30
+	// Uploads that see no progress for this long are removed
+	uploadTTL = 24 * time.Hour
+	// How often expired uploads are looked for
+	expireInterval = time.Hour
+)
+
+// Dir returns the directory partial uploads are written to.
+func Dir() string {
+	return filepath.Join(os.Getenv("APP_ROOT"), "uploads")
+}
+
+// Uploads being handed to their library, which must not be removed meanwhile
+var ingesting sync.Map
+
+func filePath(id string) string {
+	return filepath.Join(Dir(), id)
+}
+
+// newID returns a random upload ID; it ends up in URLs, so it must not be
+// guessable.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validateMetadata checks the Upload-Metadata pairs a library needs:
+//   - photo: optional `title` and `caption`
+//   - anime: `anime_id` and `episode` number, optional `title`
+//
+// Every upload may carry `filename` and a hex `sha256` of the whole file,
+// which is verified before ingestion.
+func validateMetadata(kind string, metadata map[string]string) error {
+	var details []types.FieldError
+	invalid := func(field string, message string) {
+		details = append(details, types.FieldError{Field: field, Code: "invalid", Message: message})
+	}
+
+	switch kind {
+	case types.MediaPhoto:
+	case types.MediaAnime:
+		if id, err := strconv.ParseInt(metadata["anime_id"], 10, 64); err != nil || id <= 0 {
+			invalid("anime_id", "must be the ID of an anime")
+		}
+		if n, err := strconv.Atoi(metadata["episode"]); err != nil || n <= 0 {
+			invalid("episode", "must be a positive episode number")
+		}
+	default:
+		invalid("kind", "must be "+types.MediaPhoto+" or "+types.MediaAnime)
+	}
+
+	if sum, ok := metadata["sha256"]; ok {
+		if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+			invalid("sha256", "must be a hex encoded SHA-256 digest")
+		}
+	}
+
+	if len(details) != 0 {
+		return types.ErrValidation("Invalid upload metadata!", details...)
+	}
+	return nil
+}
+
+// Create starts a new upload of length bytes.
+func Create(ctx context.Context, length int64, metadata map[string]string) (*types.Upload, error) {
+	kind := metadata["kind"]
+	if err := validateMetadata(kind, metadata); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(Dir(), 0755); err != nil {
+		return nil, types.ErrInternal("Failed to prepare upload storage!").WithCause(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	u := &types.Upload{
+		ID:        newID(),
+		Kind:      kind,
+		Filename:  filepath.Base(metadata["filename"]),
+		Metadata:  metadata,
+		Length:    length,
+		Status:    types.UploadReceiving,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(uploadTTL),
+	}
+	if u.Filename == "." || u.Filename == "/" {
+		u.Filename = ""
+	}
+
+	f, err := os.OpenFile(filePath(u.ID), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, types.ErrInternal("Failed to create upload!").WithCause(err)
+	}
+	f.Close()
+
+	if err := db.CreateUpload(ctx, u); err != nil {
+		os.Remove(filePath(u.ID))
+		return nil, types.ErrInternal("Failed to create upload!").WithCause(err)
+	}
+	return u, nil
+}
+
+// Find returns an upload that hasn't expired.
+func Find(ctx context.Context, id string) (*types.Upload, error) {
+	u, err := db.GetUpload(ctx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, types.ErrNotFound("Upload not found!")
+	}
+	if err != nil {
+		return nil, types.ErrInternal("Failed to load upload!").WithCause(err)
+	}
+	if time.Now().After(u.ExpiresAt) {
+		return nil, types.ErrGone("Upload has expired!")
+	}
+
+	_, processing := ingesting.Load(id)
+	switch {
+	case u.ItemID != nil:
+		u.Status = types.UploadDone
+	case processing:
+		u.Status = types.UploadProcessing
+	case !u.Complete():
+		u.Status = types.UploadReceiving
+	default:
+		u.Status = types.UploadFailed
+	}
+	return u, nil
+}
+
+// Remove deletes an upload and whatever was received of it.
+func Remove(ctx context.Context, id string) error {
+	if _, processing := ingesting.Load(id); processing {
+		return types.ErrConflict("This upload is still being added to the library!")
+	}
+
+	if err := db.DeleteUpload(ctx, id); err != nil {
+		return types.ErrInternal("Failed to delete upload!").WithCause(err)
+	}
+	if err := os.Remove(filePath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return types.ErrInternal("Failed to delete upload!").WithCause(err)
+	}
+	return nil
+}
+
+// verifyFile compares the finished file with the `sha256` the client
+// announced, if any, and returns the digest it checked.
+func verifyFile(u *types.Upload) (string, error) {
+	want, ok := u.Metadata["sha256"]
+	if !ok {
+		return "", nil
+	}
+
+	f, err := os.Open(filePath(u.ID))
+	if err != nil {
+		return "", types.ErrInternal("Failed to open upload!").WithCause(err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", types.ErrInternal("Failed to hash upload!").WithCause(err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(sum, want) {
+		return "", types.NewAPIError(StatusChecksumMismatch, types.ErrCodeChecksumMismatch, "Uploaded file doesn't match its SHA-256!")
+	}
+	return sum, nil
+}
+
+// ingest hands a complete upload to its library and returns the ID of the
+// photo or episode it became.
+func ingest(ctx context.Context, u *types.Upload) (int64, error) {
+	sum, err := verifyFile(u)
+	if err != nil {
+		return 0, err
+	}
+
+	switch u.Kind {
+	case types.MediaPhoto:
+		p, err := photo.ImportFile(ctx, filePath(u.ID), sum, u.Filename, u.Metadata["title"], u.Metadata["caption"])
+		if err != nil {
+			return 0, err
+		}
+		return p.ID, nil
+
+	case types.MediaAnime:
+		// Both were validated when the upload was created
+		animeID, _ := strconv.ParseInt(u.Metadata["anime_id"], 10, 64)
+		number, _ := strconv.Atoi(u.Metadata["episode"])
+
+		e, err := anime.ImportEpisode(ctx, animeID, number, u.Metadata["title"], filePath(u.ID), u.Filename)
+		if err != nil {
+			return 0, err
+		}
+		return e.ID, nil
+	}
+
+	return 0, types.ErrInternal("Unknown upload kind!")
+}
+
+// rejected reports whether ingestion failed because of the file itself: a
+// checksum mismatch, or a file the library doesn't accept. Retrying can't
+// help those, unlike a conflict that can be cleared up first.
+func rejected(err error) bool {
+	var apiErr *types.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.Status {
+	case StatusChecksumMismatch, http.StatusUnprocessableEntity, http.StatusUnsupportedMediaType:
+		return true
+	}
+	return false
+}
+
+// Ingest hands a complete upload to its library in the background. The
+// outcome is recorded on the upload: the item it became, or why it failed.
+// Rejected files are discarded right away, others are kept for a retry.
+func Ingest(u *types.Upload) error {
+	if _, busy := ingesting.LoadOrStore(u.ID, struct{}{}); busy {
+		return types.ErrConflict("This upload is already being added to the library!")
+	}
+	if _, err := os.Stat(filePath(u.ID)); err != nil {
+		ingesting.Delete(u.ID)
+		if errors.Is(err, os.ErrNotExist) {
+			return types.ErrGone("This upload was discarded, start a new one!")
+		}
+		return types.ErrInternal("Failed to open upload!").WithCause(err)
+	}
+	if err := db.SetUploadError(context.Background(), u.ID, ""); err != nil {
+		ingesting.Delete(u.ID)
+		return types.ErrInternal("Failed to save upload!").WithCause(err)
+	}
+
+	go func() {
+		defer ingesting.Delete(u.ID)
+
+		// The request that completed the upload may be long gone
+		ctx := context.Background()
+		itemID, err := ingest(ctx, u)
+		if err == nil {
+			if err := db.SetUploadItem(ctx, u.ID, itemID); err != nil {
+				logger.TimedError("failed to save upload", u.ID, ":", err.Error())
+			}
+			return
+		}
+
+		message := "Failed to add the upload to the library!"
+		var apiErr *types.APIError
+		if errors.As(err, &apiErr) && apiErr.Status < http.StatusInternalServerError {
+			message = apiErr.Message
+		} else {
+			logger.TimedError("failed to ingest upload", u.ID, ":", err.Error())
+		}
+		if rejected(err) {
+			if err := os.Remove(filePath(u.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.TimedError("failed to discard upload", u.ID, ":", err.Error())
+			}
+		}
+		if err := db.SetUploadError(ctx, u.ID, message); err != nil {
+			logger.TimedError("failed to save upload", u.ID, ":", err.Error())
+		}
+	}()
+	return nil
+}
+
+// ExpireStale removes uploads that stopped making progress, on a schedule.
+// Finished uploads are kept until they expire too, so clients can look up
+// what their upload became.
+func ExpireStale() {
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		ctx := context.Background()
+		ids, err := db.ExpiredUploads(ctx, time.Now())
+		if err != nil {
+			logger.TimedError("failed to look up expired uploads:", err.Error())
+			continue
+		}
+
+		for _, id := range ids {
+			if err := Remove(ctx, id); err != nil {
+				logger.TimedError("failed to remove expired upload", id, ":", err.Error())
+			}
+		}
+		if len(ids) > 0 {
+			logger.TimedOkay("Removed", len(ids), "expired uploads.")
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package upload
+
+import (
+	"LocalDex/db"
+	"LocalDex/logger"
+	"LocalDex/types"
+	"LocalDex/util"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,checksum,termination"
+	tusChecksums  = "sha1,sha256,md5"
+	// Content-Type every PATCH must carry
+	offsetContentType = "application/offset+octet-stream"
+	// Status the checksum extension uses for a chunk that doesn't match
+	StatusChecksumMismatch = 460
+)
+
+// Uploads currently receiving a PATCH; tus forbids concurrent writes to one upload.
+var writing sync.Map
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"md5":    md5.New,
+}
+
+// tusHeaders sets the headers every tus response carries and rejects
+// requests speaking another protocol version.
+func tusHeaders(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Method != http.MethodOptions && r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		return types.NewAPIError(http.StatusPreconditionFailed, types.ErrCodeTusVersion, "Only tus "+tusVersion+" is supported!")
+	}
+	return nil
+}
+
+func expiresHeader(u *types.Upload) string {
+	return u.ExpiresAt.UTC().Format(http.TimeFormat)
+}
+
+// parseMetadata decodes Upload-Metadata: comma separated `key base64(value)`
+// pairs, where the value may be left out.
+func parseMetadata(raw string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if len(strings.TrimSpace(raw)) == 0 {
+		return metadata, nil
+	}
+
+	for pair := range strings.SplitSeq(raw, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if len(key) == 0 {
+			return nil, types.ErrBadRequest("Malformed Upload-Metadata header!")
+		}
+		if _, exists := metadata[key]; exists {
+			return nil, types.ErrBadRequest("Duplicate Upload-Metadata key `" + key + "`!")
+		}
+
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, types.ErrBadRequest("Upload-Metadata values must be base64 encoded!").WithCause(err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// parseChecksum reads Upload-Checksum (`<algorithm> base64(digest)`).
+func parseChecksum(raw string) (hash.Hash, []byte, error) {
+	if len(raw) == 0 {
+		return nil, nil, nil
+	}
+
+	name, encoded, _ := strings.Cut(raw, " ")
+	newHash, ok := checksumAlgorithms[name]
+	if !ok {
+		return nil, nil, types.ErrBadRequest("Unsupported checksum algorithm, use one of: " + tusChecksums + "!")
+	}
+	sum, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, types.ErrBadRequest("Upload-Checksum must be base64 encoded!").WithCause(err)
+	}
+	return newHash(), sum, nil
+}
+
+// Options advertises the supported tus version and extensions.
+func Options(w http.ResponseWriter, r *http.Request) error {
+	tusHeaders(w, r)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(maxUploadSize, 10))
+	w.Header().Set("Tus-Checksum-Algorithm", tusChecksums)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Post creates an upload of Upload-Length bytes described by Upload-Metadata.
+func Post(w http.ResponseWriter, r *http.Request) error {
+	if err := tusHeaders(w, r); err != nil {
+		return err
+	}
+
+	if len(r.Header.Get("Upload-Defer-Length")) != 0 {
+		return types.ErrBadRequest("Deferred upload lengths are not supported!")
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return types.ErrBadRequest("Upload-Length must be a non-negative integer!")
+	}
+	if length > maxUploadSize {
+		return types.NewAPIError(http.StatusRequestEntityTooLarge, types.ErrCodePayloadTooLarge, "Upload is larger than "+strconv.FormatInt(maxUploadSize, 10)+" bytes!")
+	}
+
+	metadata, err := parseMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		return err
+	}
+
+	u, err := Create(r.Context(), length, metadata)
+	if err != nil {
+		return err
+	}
+
+	// An empty file is complete as soon as it exists
+	if u.Complete() {
+		if err := Ingest(u); err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Location", "/api/upload/"+u.ID)
+	w.Header().Set("Upload-Offset", "0")
+	w.Header().Set("Upload-Expires", expiresHeader(u))
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// Head reports how much of an upload has been received.
+func Head(w http.ResponseWriter, r *http.Request) error {
+	if err := tusHeaders(w, r); err != nil {
+		return err
+	}
+
+	u, err := Find(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	w.Header().Set("Upload-Expires", expiresHeader(u))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// Get returns an upload as JSON, including the item it became once complete.
+func Get(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	u, err := Find(r.Context(), r.PathValue("id"))
+	if err != nil {
+		return err
+	}
+
+	util.WriteJSON(w, http.StatusOK, u)
+	return nil
+}
+
+// Patch appends the request body at Upload-Offset. When the last byte
+// arrives the file is handed to its library, see Ingest; GET reports how that
+// went.
+func Patch(w http.ResponseWriter, r *http.Request) error {
+	if err := tusHeaders(w, r); err != nil {
+		return err
+	}
+
+	if r.Header.Get("Content-Type") != offsetContentType {
+		return types.NewAPIError(http.StatusUnsupportedMediaType, types.ErrCodeUnsupportedMedia, "Content-Type must be "+offsetContentType+"!")
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return types.ErrBadRequest("Upload-Offset must be a non-negative integer!")
+	}
+	checksum, want, err := parseChecksum(r.Header.Get("Upload-Checksum"))
+	if err != nil {
+		return err
+	}
+
+	id := r.PathValue("id")
+	if _, busy := writing.LoadOrStore(id, struct{}{}); busy {
+		return types.ErrConflict("This upload is already receiving data!")
+	}
+	defer writing.Delete(id)
+
+	u, err := Find(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	if offset != u.Offset {
+		return types.NewAPIError(http.StatusConflict, types.ErrCodeOffsetMismatch, "Upload-Offset doesn't match the received "+strconv.FormatInt(u.Offset, 10)+" bytes!")
+	}
+	if u.Complete() {
+		if u.Status != types.UploadFailed {
+			return types.ErrConflict("This upload is already complete!")
+		}
+
+		// An empty PATCH at the end of a failed upload retries the ingestion
+		if err := Ingest(u); err != nil {
+			return err
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		w.Header().Set("Upload-Expires", expiresHeader(u))
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	f, err := os.OpenFile(filePath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return types.ErrInternal("Failed to open upload!").WithCause(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(u.Offset, io.SeekStart); err != nil {
+		return types.ErrInternal("Failed to open upload!").WithCause(err)
+	}
+
+	// One byte past what's left, so oversized chunks are noticed
+	var body io.Reader = io.LimitReader(r.Body, u.Length-u.Offset+1)
+	if checksum != nil {
+		body = io.TeeReader(body, checksum)
+	}
+
+	// A dropped connection keeps what arrived, that's the point of resuming.
+	// Chunks with a checksum are all or nothing.
+	written, copyErr := io.Copy(f, body)
+	rollback := func() {
+		if err := f.Truncate(u.Offset); err != nil {
+			logger.TimedError("failed to roll back upload", id, ":", err.Error())
+		}
+	}
+
+	switch {
+	case u.Offset+written > u.Length:
+		rollback()
+		return types.NewAPIError(http.StatusRequestEntityTooLarge, types.ErrCodePayloadTooLarge, "Chunk goes past Upload-Length!")
+
+	case checksum != nil && copyErr != nil:
+		rollback()
+		return types.ErrBadRequest("Upload was interrupted!").WithCause(copyErr)
+
+	case checksum != nil && !bytes.Equal(checksum.Sum(nil), want):
+		rollback()
+		return types.NewAPIError(StatusChecksumMismatch, types.ErrCodeChecksumMismatch, "Chunk doesn't match its Upload-Checksum!")
+	}
+
+	if err := f.Sync(); err != nil {
+		rollback()
+		return types.ErrInternal("Failed to write upload!").WithCause(err)
+	}
+
+	u.Offset += written
+	u.ExpiresAt = time.Now().UTC().Truncate(time.Second).Add(uploadTTL)
+	// net/http cancels the request context once reading the body fails, which
+	// must not cost a dropped connection what it already sent. WithTx still
+	// bounds the write with its own timeout.
+	ctx := r.Context()
+	if checksum == nil {
+		ctx = context.WithoutCancel(ctx)
+	}
+	if err := db.SetUploadOffset(ctx, id, u.Offset, u.ExpiresAt); err != nil {
+		rollback()
+		return types.ErrInternal("Failed to save upload progress!").WithCause(err)
+	}
+	if copyErr != nil {
+		return types.ErrBadRequest("Upload was interrupted!").WithCause(copyErr)
+	}
+
+	if u.Complete() {
+		f.Close()
+		if err := Ingest(u); err != nil {
+			return err
+		}
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Expires", expiresHeader(u))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Delete terminates an upload and discards its data.
+func Delete(w http.ResponseWriter, r *http.Request) error {
+	if err := tusHeaders(w, r); err != nil {
+		return err
+	}
+
+	id := r.PathValue("id")
+	if _, busy := writing.LoadOrStore(id, struct{}{}); busy {
+		return types.ErrConflict("This upload is still receiving data!")
+	}
+	defer writing.Delete(id)
+
+	if _, err := db.GetUpload(r.Context(), id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			return types.ErrNotFound("Upload not found!")
+		}
+		return types.ErrInternal("Failed to load upload!").WithCause(err)
+	}
+	if err := Remove(r.Context(), id); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
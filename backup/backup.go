@@ -0,0 +1,225 @@
+package backup
+
+import (
+	"LocalDex/db"
+	"LocalDex/logger"
+	"LocalDex/settings"
+	"LocalDex/types"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshots are named after the time they were taken, so sorting by name
+// sorts by age.
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".db"
+	snapshotLayout = "20060102T150405Z"
+)
+
+// ErrUnknownSnapshot is returned when a snapshot name doesn't match a file in
+// the backup directory.
+var ErrUnknownSnapshot = errors.New("unknown snapshot")
+
+var (
+	// Serializes snapshots, pruning and restores
+	mu sync.Mutex
+	// Set while a restore swaps the database file
+	maintenance atomic.Bool
+)
+
+// Dir returns the directory snapshots are stored in.
+func Dir() string {
+	return filepath.Join(os.Getenv("APP_ROOT"), "backups")
+}
+
+// Interval returns the configured time between scheduled snapshots, zero when
+// the schedule is off.
+func Interval() (time.Duration, error) {
+	raw := settings.Get().Backup.Interval
+	if len(raw) == 0 {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid backup interval %q: %w", raw, err)
+	}
+	if interval < 0 {
+		return 0, fmt.Errorf("invalid backup interval %q: must not be negative", raw)
+	}
+	return interval, nil
+}
+
+// Prepare creates the backup directory and validates the backup settings.
+func Prepare() error {
+	if _, err := Interval(); err != nil {
+		return err
+	}
+	if keep := settings.Get().Backup.Keep; keep < 1 {
+		return fmt.Errorf("invalid backup keep count %d: at least one snapshot must be kept", keep)
+	}
+	return os.MkdirAll(Dir(), 0755)
+}
+
+// InMaintenance reports whether a restore is in progress. The server answers
+// every request with 503 while it is.
+func InMaintenance() bool {
+	return maintenance.Load()
+}
+
+func parseName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, snapshotPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	stamp, ok = strings.CutSuffix(stamp, snapshotSuffix)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(snapshotLayout, stamp)
+	return t, err == nil
+}
+
+// List returns the snapshots in the backup directory, newest first.
+func List() ([]types.BackupSnapshot, error) {
+	entries, err := os.ReadDir(Dir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	snapshots := []types.BackupSnapshot{}
+	for _, entry := range entries {
+		createdAt, ok := parseName(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, types.BackupSnapshot{
+			Name:      entry.Name(),
+			Size:      info.Size(),
+			CreatedAt: createdAt,
+		})
+	}
+
+	slices.SortFunc(snapshots, func(a, b types.BackupSnapshot) int {
+		return strings.Compare(b.Name, a.Name)
+	})
+	return snapshots, nil
+}
+
+// Create takes a hot snapshot of the database and then removes snapshots
+// beyond the configured keep count.
+func Create(ctx context.Context) (*types.BackupSnapshot, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	createdAt := time.Now().UTC().Truncate(time.Second)
+	name := snapshotPrefix + createdAt.Format(snapshotLayout) + snapshotSuffix
+	dest := filepath.Join(Dir(), name)
+
+	if _, err := os.Stat(dest); err == nil {
+		return nil, fmt.Errorf("snapshot %q already exists", name)
+	}
+
+	// Write to a temporary name, so a crash never leaves a partial snapshot
+	// that looks like a real one
+	partial := dest + ".partial"
+	os.Remove(partial)
+	if err := db.Snapshot(ctx, partial); err != nil {
+		os.Remove(partial)
+		return nil, err
+	}
+	if err := os.Rename(partial, dest); err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("failed to finish snapshot: %w", err)
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := prune(settings.Get().Backup.Keep); err != nil {
+		logger.TimedWarning("failed to remove old snapshots:", err.Error())
+	}
+
+	return &types.BackupSnapshot{Name: name, Size: info.Size(), CreatedAt: createdAt}, nil
+}
+
+// prune removes the oldest snapshots until at most keep remain.
+func prune(keep int) error {
+	snapshots, err := List()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) <= keep {
+		return nil
+	}
+
+	var errs []error
+	for _, snapshot := range snapshots[keep:] {
+		errs = append(errs, os.Remove(filepath.Join(Dir(), snapshot.Name)))
+	}
+	return errors.Join(errs...)
+}
+
+// Restore replaces the live database with the named snapshot. The server is in
+// maintenance mode until the restored database is open again.
+func Restore(ctx context.Context, name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	snapshots, err := List()
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(snapshots, func(s types.BackupSnapshot) bool { return s.Name == name }) {
+		return fmt.Errorf("%w %q", ErrUnknownSnapshot, name)
+	}
+
+	maintenance.Store(true)
+	defer maintenance.Store(false)
+
+	return db.Restore(ctx, filepath.Join(Dir(), name))
+}
+
+// Schedule takes a snapshot every configured interval. The first one is due
+// one interval after the newest existing snapshot, so restarts don't reset the
+// schedule.
+func Schedule() {
+	for {
+		interval, err := Interval()
+		if err != nil || interval == 0 {
+			return
+		}
+
+		next := time.Now()
+		if snapshots, err := List(); err == nil && len(snapshots) > 0 {
+			next = snapshots[0].CreatedAt.Add(interval)
+		}
+		time.Sleep(time.Until(next))
+
+		snapshot, err := Create(context.Background())
+		if err != nil {
+			logger.TimedError("scheduled backup failed:", err.Error())
+			// Try again later instead of spinning on a persistent failure
+			time.Sleep(interval)
+			continue
+		}
+		logger.TimedOkay("Created database snapshot `" + snapshot.Name + "`.")
+	}
+}
@@ -1,4 +1,6 @@
 import { useState } from 'react';
+import { csrfFetch, setCSRFToken } from '@/lib/csrf';
+import { readProblem } from '@/types';
 
 export default function AuthFlow({ onSuccess }: { onSuccess: () => void }) {
   const [step, setStep] = useState('login');     // 'login' or 'otp'
@@ -10,14 +12,14 @@ export default function AuthFlow({ onSuccess }: { onSuccess: () => void }) {
   const sendLogin = async () => {
     setMessage('');
     try {
-      const res = await fetch('/api/auth/login', {
+      const res = await csrfFetch('/api/auth/login', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ email, password })
       });
       if (!res.ok) {
-        const text = await res.text();
-        throw new Error(text || res.statusText);
+        const problem = await readProblem(res);
+        throw new Error(problem?.detail || res.statusText);
       }
       setStep('otp');
     } catch (err) {
@@ -28,16 +30,18 @@ export default function AuthFlow({ onSuccess }: { onSuccess: () => void }) {
   const verifyOtp = async () => {
     setMessage('');
     try {
-      const res = await fetch('/api/auth/verify_otp', {
+      const res = await csrfFetch('/api/auth/verify_otp', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ email, otp })
       });
       if (!res.ok) {
-        const text = await res.text();
-        throw new Error(text || res.statusText);
+        const problem = await readProblem(res);
+        throw new Error(problem?.detail || res.statusText);
       }
-      // cookie is set by server; notify parent
+      // cookie is set by server, the CSRF token was rotated along with the session
+      const data: { csrf_token?: string } = await res.json();
+      setCSRFToken(data.csrf_token ?? null);
       onSuccess?.();
     } catch (err) {
       setMessage(err instanceof Error && err.message || 'OTP verification failed');
@@ -3,8 +3,11 @@ import { PathBasedMetadata } from "@/contexts/metadata"
 import { Button } from "@/components/ui/button"
 import { Link } from "react-router-dom"
 
-export default function GenericHTTPError({ error, message, status }: { error: string, message: string, status: 404 | 500 }) {
-  const metadataId = status === 404 ? "#not_found" : "#internal_server_error"
+export type HTTPErrorStatus = 401 | 403 | 404 | 410 | 500 | 503
+
+export default function GenericHTTPError({ error, message, status }: { error: string, message: string, status: HTTPErrorStatus }) {
+  // INFO: Error metadata lives under `#<status>` in static.route.json
+  const metadataId = `#${status}`
 
   return (
     <Fragment>
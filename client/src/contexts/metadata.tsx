@@ -9,6 +9,7 @@ import React, {
 import type { MetaTag, LinkTag, ScriptTag, StaticRoute } from "@/types/static.route";
 import { useConfig } from "@/contexts/config";
 import { useLocation } from "react-router-dom";
+import { matchStaticRoute } from "@/lib/routes";
 
 const MetadataContext = createContext<boolean | undefined>(undefined);
 
@@ -108,8 +109,8 @@ export const StaticMetadata = () => {
 
   const defaultMeta = staticRoute.find(route => route.path === "*");
   const currentMeta =
-    staticRoute.find(route => route.path === location.pathname) ??
-    staticRoute.find(route => route.path === "#not_found");
+    matchStaticRoute(staticRoute, location.pathname) ??
+    staticRoute.find(route => route.path === "#404");
 
   const mergedMeta = {
     title: currentMeta?.title,
@@ -0,0 +1,31 @@
+let csrfToken: string | null = null
+
+async function getCSRFToken(): Promise<string> {
+    if (csrfToken) return csrfToken
+
+    const res = await fetch("/api/auth/csrf", { credentials: "include" })
+    if (!res.ok) throw new Error("Failed to fetch CSRF token")
+
+    const data: { token: string } = await res.json()
+    csrfToken = data.token
+    return csrfToken
+}
+
+// INFO: Drop the cached token, e.g. after login rotated it.
+export function setCSRFToken(token: string | null) {
+    csrfToken = token
+}
+
+// INFO: fetch() wrapper for state-changing API calls, attaches the CSRF token
+//       and retries once with a fresh token if the server rejected it.
+export async function csrfFetch(input: RequestInfo | URL, init: RequestInit = {}, retried = false): Promise<Response> {
+    const headers = new Headers(init.headers)
+    headers.set("X-CSRF-Token", await getCSRFToken())
+
+    const res = await fetch(input, { credentials: "include", ...init, headers })
+    if (res.status === 403 && !retried) {
+        csrfToken = null
+        return csrfFetch(input, init, true)
+    }
+    return res
+}
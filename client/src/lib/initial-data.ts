@@ -0,0 +1,41 @@
+import type { QueryClient } from "@tanstack/react-query"
+
+declare global {
+    interface Window {
+        // INFO: API responses preloaded by the server, keyed by API URL
+        __INITIAL_DATA__?: Record<string, unknown>
+    }
+}
+
+// INFO: Query keys are the API URL itself, e.g. `["/api/photo?limit=50&page=1&sort=created_desc"]`,
+//       which is also how the server keys `window.__INITIAL_DATA__`.
+export function apiKey(path: string, params?: Record<string, string | number | undefined>): [string] {
+    if (!params) return [path]
+
+    const search = new URLSearchParams()
+    Object.keys(params).sort().forEach((name) => {
+        const value = params[name]
+        if (value !== undefined && value !== "") search.set(name, String(value))
+    })
+    return [`${path}?${search.toString()}`]
+}
+
+export async function fetchAPI<T>({ queryKey }: { queryKey: readonly unknown[] }): Promise<T> {
+    const res = await fetch(queryKey[0] as string, { credentials: "include" })
+    if (!res.ok) throw res
+    return res.json()
+}
+
+// INFO: Moves the preloaded responses into the query cache, so the first render
+//       doesn't wait on a request the server already answered.
+export function seedInitialData(queryClient: QueryClient) {
+    const data = window.__INITIAL_DATA__
+    if (!data) return
+
+    for (const [key, value] of Object.entries(data)) {
+        queryClient.setQueryData([key], value)
+    }
+
+    delete window.__INITIAL_DATA__
+    document.getElementById("__INITIAL_DATA__")?.remove()
+}
@@ -0,0 +1,79 @@
+import type { StaticRoute } from "@/types/static.route"
+
+// INFO: Mirrors the server-side matching of `static.route.json` (parser/routes.go),
+//       so client-side navigation resolves the same metadata as the first render.
+
+const trim = (path: string) => path.replace(/^\/+|\/+$/g, "").split("/")
+
+function isPattern(path: string) {
+    return path.startsWith("/") && trim(path).some(seg =>
+        seg === "*" || seg.startsWith(":") || (seg.startsWith("{") && seg.endsWith("}")))
+}
+
+function segmentRank(seg: string) {
+    if (seg === "*" || seg.endsWith("...}")) return 0
+    if (seg.startsWith(":") || seg.startsWith("{")) return 1
+    return 2
+}
+
+function comparePatterns(a: string, b: string) {
+    const segsA = trim(a), segsB = trim(b)
+    for (let i = 0; i < segsA.length && i < segsB.length; i++) {
+        const diff = segmentRank(segsB[i]) - segmentRank(segsA[i])
+        if (diff !== 0) return diff
+    }
+    if (segsA.length !== segsB.length) return segsB.length - segsA.length
+    return a < b ? -1 : a > b ? 1 : 0
+}
+
+export function matchPath(pattern: string, path: string): Record<string, string> | null {
+    const patternSegs = trim(pattern), pathSegs = trim(path)
+    const params: Record<string, string> = {}
+
+    for (let i = 0; i < patternSegs.length; i++) {
+        const seg = patternSegs[i]
+
+        if (i === patternSegs.length - 1 && (seg === "*" || (seg.startsWith("{") && seg.endsWith("...}")))) {
+            if (i >= pathSegs.length) return null
+            params[seg === "*" ? "*" : seg.slice(1, -4)] = pathSegs.slice(i).join("/")
+            return params
+        }
+
+        if (i >= pathSegs.length) return null
+
+        if (seg.startsWith("{") && seg.endsWith("}")) {
+            if (!pathSegs[i]) return null
+            params[seg.slice(1, -1)] = pathSegs[i]
+        } else if (seg.startsWith(":")) {
+            if (!pathSegs[i]) return null
+            params[seg.slice(1)] = pathSegs[i]
+        } else if (seg !== pathSegs[i]) {
+            return null
+        }
+    }
+
+    return pathSegs.length === patternSegs.length ? params : null
+}
+
+const interpolate = (value: string, params: Record<string, string>) =>
+    value.replace(/\{\{\s*([A-Za-z0-9_*]+)\s*\}\}/g, (_, name: string) => params[name] ?? "")
+
+// INFO: Exact entries win, then the most specific pattern, with its params
+//       filled into the title and meta content.
+export function matchStaticRoute(routes: StaticRoute[], pathname: string): StaticRoute | undefined {
+    const exact = routes.find(route => route.path === pathname)
+    if (exact) return exact
+
+    const patterns = routes.filter(route => isPattern(route.path)).sort((a, b) => comparePatterns(a.path, b.path))
+    for (const route of patterns) {
+        const params = matchPath(route.path, pathname)
+        if (!params) continue
+
+        return {
+            ...route,
+            title: route.title && interpolate(route.title, params),
+            meta: route.meta?.map(meta => "content" in meta ? { ...meta, content: interpolate(meta.content, params) } : meta),
+        }
+    }
+    return undefined
+}
@@ -11,8 +11,12 @@ import { QueryClientProvider, QueryClient } from '@tanstack/react-query'
 import Loading from "@/components/layout/loading"
 import { ErrorBoundary } from "@/error-boundary"
 import { LoadingBoundary } from "@/loading-boundary"
+import { readProblem } from "@/types"
+import { seedInitialData } from "@/lib/initial-data"
+import type { HTTPErrorStatus } from "@/components/layout/http-error"
 
 const queryClient = new QueryClient()
+seedInitialData(queryClient)
 
 const Home = lazy(() => import("@/pages/home"))
 const GenericHTTPError = lazy(() => import("@/components/layout/http-error"))
@@ -65,8 +69,23 @@ const App = () => {
   )
 }
 
+const errorTitles: Record<HTTPErrorStatus, string> = {
+  401: "401 - Unauthorized",
+  403: "403 - Forbidden",
+  404: "404 - Page Not Found",
+  410: "410 - Gone",
+  500: "500 - Internal Server Error",
+  503: "503 - Service Unavailable",
+}
+
+interface ServerError {
+  status: HTTPErrorStatus
+  message: string
+}
+
 const ServerErrorWrapper = ({ comp }: { comp: ReactNode }) => {
   const [errorPath, setErrorPath] = useState<string | null>(null)
+  const [serverError, setServerError] = useState<ServerError | null>(null)
   const { pathname } = useLocation()
   const { setSSRData } = useConfig()
   // INFO: The following state is to avoid race condition
@@ -79,8 +98,9 @@ const ServerErrorWrapper = ({ comp }: { comp: ReactNode }) => {
         const data = JSON.parse(script.textContent)
         setSSRData(data)
 
-        // Identify if it's error data (you can refine this signature check)
-        if ("status" in data && data.status === 500) {
+        // INFO: Error pages carry `{ status, message, path }`
+        if ("status" in data && data.status in errorTitles) {
+          setServerError({ status: data.status, message: data.message })
           setErrorPath(pathname)
         }
 
@@ -99,7 +119,12 @@ const ServerErrorWrapper = ({ comp }: { comp: ReactNode }) => {
     }
   }, [pathname, errorPath])
 
-  return !isSSRLoaded ? <Loading /> : errorPath === pathname ? <GenericHTTPError error={"500 - Internal Server Error"} message={"Something broke on my end. If you’re me, fix it now. ⚡"} status={500} /> : comp
+  if (!isSSRLoaded) return <Loading />
+  if (errorPath === pathname && serverError) {
+    const message = serverError.status === 500 ? "Something broke on my end. If you’re me, fix it now. ⚡" : serverError.message
+    return <GenericHTTPError error={errorTitles[serverError.status]} message={message} status={serverError.status} />
+  }
+  return comp
 }
 
 export const Authenticate = ({ page }: { page: React.ReactNode }) => {
@@ -110,10 +135,14 @@ export const Authenticate = ({ page }: { page: React.ReactNode }) => {
       method: "GET",
       credentials: "include",
     })
-      .then((res) => {
+      .then(async (res) => {
         if (res.status === 200) {
           setStatus("success")
-        } else if (res.status === 498) {
+          return
+        }
+
+        const problem = await readProblem(res)
+        if (problem?.code === "session_expired") {
           // INFO: Expired token
           setStatus("error")
         } else {
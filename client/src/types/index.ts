@@ -14,3 +14,76 @@ export interface Healthz {
         api: ComponentStatus;
     };
 }
+
+// INFO: RFC 7807 error body returned by every API route (`application/problem+json`)
+export interface Problem {
+    type: string;
+    title: string;
+    status: number;
+    detail: string;
+    instance?: string;
+    code: string;
+    errors?: Array<{ field: string; code: string; message: string }>;
+}
+
+export async function readProblem(res: Response): Promise<Problem | null> {
+    if (!res.headers.get("Content-Type")?.includes("application/problem+json")) return null
+    try {
+        return await res.json() as Problem
+    } catch {
+        return null
+    }
+}
+
+// INFO: One page of a library listing (`GET /api/photo`, `/api/anime`, `/api/manga`)
+export interface Page<T> {
+    items: T[];
+    page: number;
+    limit: number;
+    total: number;
+    has_more: boolean;
+}
+
+export interface Photo {
+    id: number;
+    title: string;
+    caption: string;
+    mime_type: string;
+    size: number;
+    width: number;
+    height: number;
+    // Seconds, only set for videos
+    duration?: number;
+    favorite: boolean;
+    taken_at: string | null;
+    camera_make: string;
+    camera_model: string;
+    lens_model: string;
+    latitude: number | null;
+    longitude: number | null;
+    // EXIF orientation, 1 is upright
+    orientation: number;
+    created_at: string;
+    updated_at: string;
+}
+
+export interface Anime {
+    id: number;
+    title: string;
+    type: "anime" | "hentai";
+    description: string;
+    status: string;
+    view_count: number;
+    created_at: string;
+    updated_at: string;
+}
+
+export interface Manga {
+    id: number;
+    title: string;
+    type: "manga" | "doujin";
+    description: string;
+    read_count: number;
+    created_at: string;
+    updated_at: string;
+}
@@ -47,4 +47,6 @@ export interface StaticRoute {
     meta?: MetaTag[];
     link?: LinkTag[];
     script?: ScriptTag[];
+    // INFO: schema.org JSON-LD objects, only rendered by the server
+    structured_data?: Record<string, unknown>[];
 }
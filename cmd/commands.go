@@ -0,0 +1,94 @@
+package main
+
+import (
+	"LocalDex/backup"
+	"LocalDex/db"
+	"LocalDex/logger"
+	"LocalDex/scanner"
+	"context"
+	"fmt"
+	"os"
+)
+
+const commandUsage = `Usage: LocalDex [command]
+
+Without a command the server is started.
+
+Commands:
+  backup            take a snapshot of the database
+  backups           list snapshots, newest first
+  restore <name>    replace the database with a snapshot (stop the server first)
+  check             run an integrity check on the database
+  scan              index new and changed files in the library roots`
+
+// runCommand handles the CLI subcommands and returns the process exit code.
+func runCommand(args []string) int {
+	defer db.Close()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "backup":
+		snapshot, err := backup.Create(ctx)
+		if err != nil {
+			logger.Error("backup failed:", err)
+			return 1
+		}
+		logger.Okay("Created snapshot", snapshot.Name, "in", backup.Dir())
+
+	case "backups":
+		snapshots, err := backup.List()
+		if err != nil {
+			logger.Error(err)
+			return 1
+		}
+		for _, s := range snapshots {
+			fmt.Printf("%s\t%d\t%s\n", s.Name, s.Size, s.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+
+	case "restore":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, commandUsage)
+			return 2
+		}
+		if err := backup.Restore(ctx, args[1]); err != nil {
+			logger.Error("restore failed:", err)
+			return 1
+		}
+		logger.Okay("Restored database from", args[1])
+
+	case "check":
+		problems, err := db.IntegrityCheck(ctx)
+		if err != nil {
+			logger.Error(err)
+			return 1
+		}
+		if len(problems) > 0 {
+			for _, problem := range problems {
+				logger.Error(problem)
+			}
+			return 1
+		}
+		logger.Okay("Database integrity check passed")
+
+	case "scan":
+		results, err := scanner.Scan(ctx)
+		if err != nil {
+			logger.Error("scan failed:", err)
+			return 1
+		}
+		for _, r := range results {
+			if len(r.Error) != 0 {
+				logger.Error(r.Root+":", r.Error)
+				continue
+			}
+			fmt.Printf("%s\t%d added\t%d updated\t%d moved\t%d restored\t%d unchanged\t%d skipped\t%d failed\t%d offline\n",
+				r.Root, r.Added, r.Updated, r.Moved, r.Restored, r.Unchanged, r.Skipped, r.Failed, r.Missing)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+
+	return 0
+}
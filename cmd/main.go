@@ -3,13 +3,20 @@ package main
 import (
 	vars "LocalDex"
 	"LocalDex/api"
+	"LocalDex/api/photo"
+	"LocalDex/api/upload"
+	"LocalDex/backup"
 	"LocalDex/db"
 	"LocalDex/logger"
+	"LocalDex/parser"
+	"LocalDex/scanner"
+	"LocalDex/settings"
+	"LocalDex/thumb"
+	"LocalDex/trash"
 	"LocalDex/types"
 	"LocalDex/util"
 	"errors"
 	"fmt"
-	_ "modernc.org/sqlite"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -103,6 +110,34 @@ func init() {
 
 	// NOTE: Don't move this function call, look at the info on this function for more details
 	createAppRoot()
+
+	if err := settings.Load(); err != nil {
+		logger.Panic("failed to load server configuration:\n    ", err)
+	}
+
+	if err := parser.LoadStaticRoutes(); err != nil {
+		logger.Panic("failed to load route metadata:\n    ", err)
+	}
+
+	if err := parser.LoadShell(); err != nil {
+		logger.Panic("failed to prepare the HTML shell:\n    ", err)
+	}
+
+	if err := db.Open(filepath.Join(AppRoot, Title+".db")); err != nil {
+		logger.Panic("failed to open database:\n    ", err)
+	}
+
+	if err := backup.Prepare(); err != nil {
+		logger.Panic("failed to prepare backups:\n    ", err)
+	}
+
+	if err := scanner.Prepare(); err != nil {
+		logger.Panic("invalid library configuration:\n    ", err)
+	}
+
+	if err := trash.Prepare(); err != nil {
+		logger.Panic("invalid trash configuration:\n    ", err)
+	}
 }
 
 func fileExists(filePath string) bool {
@@ -135,7 +170,22 @@ func dirExists(dirPath string) error {
 }
 
 func main() {
-	defer db.Conn.Close()
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	defer db.Close()
+
+	api.IndexEmbeddedAssets()
+	go api.PrecompressEmbeddedAssets()
+	go parser.WatchStaticRoutes()
+	go backup.Schedule()
+	thumb.Start()
+	go photo.BackfillHashes()
+	go upload.ExpireStale()
+	go scanner.Schedule()
+	go scanner.Watch()
+	go trash.Schedule()
 
 	// INFO:: startServer checks the current environment configuration.
 	//         - In development mode, it starts the server on the DevPort.
@@ -147,8 +197,12 @@ func main() {
 		routeHandler := util.Chain(types.MiddlewareChain{
 			Handler: api.HandleRouting(),
 			Middlewares: []types.Middleware{
+				api.CompressionMiddleware,
 				api.RecoveryMiddleware,
 				api.LoggingMiddleware,
+				api.SecurityHeadersMiddleware,
+				api.MaintenanceMiddleware,
+				api.CSRFMiddleware,
 			},
 		})
 
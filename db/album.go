@@ -0,0 +1,378 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+)
+
+const albumColumns = `id, title, description, smart, filter, cover_photo_id, created_at, updated_at`
+
+func scanAlbum(row rowScanner) (*types.Album, error) {
+	var (
+		a                types.Album
+		cover            sql.NullInt64
+		created, updated int64
+	)
+
+	if err := row.Scan(&a.ID, &a.Title, &a.Description, &a.Smart, &a.Filter, &cover, &created, &updated); err != nil {
+		return nil, err
+	}
+
+	if cover.Valid {
+		a.CoverPhotoID = &cover.Int64
+	}
+	a.CreatedAt = fromUnix(created)
+	a.UpdatedAt = fromUnix(updated)
+	return &a, nil
+}
+
+// albumPhotos returns the tables and conditions that select the live photos
+// of an album.
+func albumPhotos(a *types.Album) (string, listFilter, error) {
+	var f listFilter
+	f.add(`deleted_at IS NULL`)
+
+	if a.Smart {
+		err := applyFilter(&f, types.MediaPhoto, a.Filter)
+		return "photos", f, err
+	}
+	f.add(`album_id = ?`, a.ID)
+	return "photos JOIN album_photos ON photo_id = id", f, nil
+}
+
+func albumOrderBy(a *types.Album, sort string) string {
+	if a.Smart {
+		return PhotoSorts.orderBy(sort)
+	}
+	return AlbumPhotoSorts.orderBy(sort)
+}
+
+// albumStats counts the photos of an album and resolves its cover.
+func albumStats(ctx context.Context, a *types.Album) error {
+	table, f, err := albumPhotos(a)
+	if err != nil {
+		return err
+	}
+
+	a.CoverID = nil
+	if err := Reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+f.where(), f.args...).Scan(&a.PhotoCount); err != nil {
+		return err
+	}
+	if a.PhotoCount == 0 {
+		return nil
+	}
+
+	// The chosen cover sorts first while it is still in the album
+	var chosen int64
+	if a.CoverPhotoID != nil {
+		chosen = *a.CoverPhotoID
+	}
+	args := append(append([]any{}, f.args...), chosen)
+
+	var cover int64
+	err = Reader.QueryRowContext(ctx, `SELECT id FROM `+table+f.where()+` ORDER BY id = ? DESC, `+albumOrderBy(a, "")+` LIMIT 1`, args...).Scan(&cover)
+	if err != nil {
+		return err
+	}
+	a.CoverID = &cover
+	return nil
+}
+
+// GetAlbum returns an album with its photo count and cover. It fails with
+// ErrNotFound for unknown IDs.
+func GetAlbum(ctx context.Context, id int64) (*types.Album, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	a, err := scanAlbum(Reader.QueryRowContext(ctx, `SELECT `+albumColumns+` FROM albums WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, albumStats(ctx, a)
+}
+
+// ListAlbums returns one page of albums and the total number of matches.
+func ListAlbums(ctx context.Context, q types.ListQuery) ([]types.Album, int, error) {
+	var f listFilter
+	if len(q.Filter) != 0 {
+		f.add(`title LIKE ? ESCAPE '\'`, "%"+escapeLike(q.Filter)+"%")
+	}
+
+	albums, total, err := listRows(ctx, "albums", albumColumns, f, AlbumSorts.orderBy(q.Sort), q, scanAlbum)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	for i := range albums {
+		if err := albumStats(ctx, &albums[i]); err != nil {
+			return nil, 0, err
+		}
+	}
+	return albums, total, nil
+}
+
+// ListAlbumPhotos returns one page of the live photos of an album, narrowed
+// down by the query's filter, and the total number of matches.
+func ListAlbumPhotos(ctx context.Context, a *types.Album, q types.ListQuery) ([]types.Photo, int, error) {
+	table, f, err := albumPhotos(a)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := applyFilter(&f, types.MediaPhoto, q.Filter); err != nil {
+		return nil, 0, err
+	}
+
+	return listRows(ctx, table, photoColumns, f, albumOrderBy(a, q.Sort), q, scanPhoto)
+}
+
+// AlbumContains reports whether a live photo belongs to an album.
+func AlbumContains(ctx context.Context, a *types.Album, photoID int64) (bool, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	table, f, err := albumPhotos(a)
+	if err != nil {
+		return false, err
+	}
+	f.add(`id = ?`, photoID)
+
+	var found bool
+	err = Reader.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+table+f.where()+`)`, f.args...).Scan(&found)
+	return found, err
+}
+
+// CreateAlbum inserts a new album and sets its ID and timestamps. Photos are
+// added to manual albums in the given order, skipping those that aren't live.
+func CreateAlbum(ctx context.Context, a *types.Album, photoIDs []int64) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO albums (title, description, smart, filter, cover_photo_id, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			a.Title, a.Description, a.Smart, a.Filter, a.CoverPhotoID, toUnix(now), toUnix(now))
+		if err != nil {
+			return err
+		}
+
+		if a.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		a.CreatedAt, a.UpdatedAt = now, now
+
+		if a.Smart || len(photoIDs) == 0 {
+			return nil
+		}
+		_, err = addAlbumPhotos(ctx, tx, a.ID, photoIDs, -1, now)
+		return err
+	})
+}
+
+// UpdateAlbum saves the title, description, filter and chosen cover of an
+// album. It fails with ErrNotFound for unknown IDs.
+func UpdateAlbum(ctx context.Context, a *types.Album) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE albums SET title = ?, description = ?, filter = ?, cover_photo_id = ?, updated_at = ?
+			WHERE id = ?`,
+			a.Title, a.Description, a.Filter, a.CoverPhotoID, toUnix(now), a.ID)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		a.UpdatedAt = now
+		return nil
+	})
+}
+
+// DeleteAlbum removes an album. Its photos stay in the library.
+func DeleteAlbum(ctx context.Context, id int64) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM albums WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// albumOrder returns the photo IDs of a manual album in order, including
+// photos in the trash.
+func albumOrder(ctx context.Context, tx *sql.Tx, albumID int64) ([]int64, error) {
+	return queryIDs(ctx, tx, `SELECT photo_id FROM album_photos WHERE album_id = ? ORDER BY position, photo_id`, albumID)
+}
+
+// saveAlbumOrder numbers the photos of an album in the order of ids.
+func saveAlbumOrder(ctx context.Context, tx *sql.Tx, albumID int64, ids []int64) error {
+	stmt, err := tx.PrepareContext(ctx, `UPDATE album_photos SET position = ? WHERE album_id = ? AND photo_id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for position, id := range ids {
+		if _, err := stmt.ExecContext(ctx, position, albumID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// touchAlbum bumps the update time of a manual album. It fails with
+// ErrNotFound for unknown IDs and smart albums.
+func touchAlbum(ctx context.Context, tx *sql.Tx, albumID int64, now time.Time) error {
+	res, err := tx.ExecContext(ctx, `UPDATE albums SET updated_at = ? WHERE id = ? AND NOT smart`, toUnix(now), albumID)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func addAlbumPhotos(ctx context.Context, tx *sql.Tx, albumID int64, ids []int64, position int, now time.Time) ([]int64, error) {
+	order, err := albumOrder(ctx, tx, albumID)
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := queryIDs(ctx, tx, `SELECT id FROM photos WHERE deleted_at IS NULL AND id IN (`+placeholders(len(ids))+`)`, idArgs(nil, ids)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the order the photos were listed in
+	var added []int64
+	for _, id := range ids {
+		if slices.Contains(live, id) && !slices.Contains(order, id) {
+			added = append(added, id)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	for _, id := range added {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO album_photos (album_id, photo_id, position, added_at) VALUES (?, ?, 0, ?)`, albumID, id, toUnix(now)); err != nil {
+			return nil, err
+		}
+	}
+
+	if position < 0 || position > len(order) {
+		position = len(order)
+	}
+	return added, saveAlbumOrder(ctx, tx, albumID, slices.Insert(order, position, added...))
+}
+
+// AddAlbumPhotos adds live photos to a manual album at position, or at the
+// end when position is negative, and returns the IDs that were added. Photos
+// already in the album are skipped. It fails with ErrNotFound for unknown IDs
+// and smart albums.
+func AddAlbumPhotos(ctx context.Context, albumID int64, ids []int64, position int) ([]int64, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var added []int64
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		if err := touchAlbum(ctx, tx, albumID, now); err != nil {
+			return err
+		}
+
+		var err error
+		added, err = addAlbumPhotos(ctx, tx, albumID, ids, position, now)
+		return err
+	})
+	return added, err
+}
+
+// RemoveAlbumPhotos takes photos out of a manual album and returns the IDs
+// that were removed. A removed cover is unset.
+func RemoveAlbumPhotos(ctx context.Context, albumID int64, ids []int64) ([]int64, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var removed []int64
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		if err := touchAlbum(ctx, tx, albumID, now); err != nil {
+			return err
+		}
+
+		var err error
+		removed, err = queryIDs(ctx, tx, `
+			DELETE FROM album_photos WHERE album_id = ? AND photo_id IN (`+placeholders(len(ids))+`)
+			RETURNING photo_id`, idArgs([]any{albumID}, ids)...)
+		if err != nil || len(removed) == 0 {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE albums SET cover_photo_id = NULL WHERE id = ? AND cover_photo_id IN (`+placeholders(len(removed))+`)`, idArgs([]any{albumID}, removed)...)
+		if err != nil {
+			return err
+		}
+
+		order, err := albumOrder(ctx, tx, albumID)
+		if err != nil {
+			return err
+		}
+		return saveAlbumOrder(ctx, tx, albumID, order)
+	})
+	return removed, err
+}
+
+// ReorderAlbumPhotos moves the listed photos of a manual album to the front,
+// in the order given. The others follow in their current order. It returns
+// the new order.
+func ReorderAlbumPhotos(ctx context.Context, albumID int64, ids []int64) ([]int64, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var order []int64
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		if err := touchAlbum(ctx, tx, albumID, now); err != nil {
+			return err
+		}
+
+		current, err := albumOrder(ctx, tx, albumID)
+		if err != nil {
+			return err
+		}
+
+		order = order[:0]
+		for _, id := range ids {
+			if slices.Contains(current, id) {
+				order = append(order, id)
+			}
+		}
+		for _, id := range current {
+			if !slices.Contains(ids, id) {
+				order = append(order, id)
+			}
+		}
+		return saveAlbumOrder(ctx, tx, albumID, order)
+	})
+	return order, err
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const animeColumns = `id, title, alt_titles, type, description, cover_path, status, view_count, created_at, updated_at, deleted_at`
+
+func scanAnime(row rowScanner) (*types.Anime, error) {
+	var (
+		a                types.Anime
+		altTitles        string
+		created, updated int64
+		deleted          sql.NullInt64
+	)
+
+	err := row.Scan(&a.ID, &a.Title, &altTitles, &a.Type, &a.Description, &a.CoverPath, &a.Status, &a.ViewCount, &created, &updated, &deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	a.AltTitles = splitTitles(altTitles)
+	a.CreatedAt = fromUnix(created)
+	a.UpdatedAt = fromUnix(updated)
+	a.DeletedAt = fromNullUnix(deleted)
+	return &a, nil
+}
+
+// GetAnime returns an anime that hasn't been deleted. It fails with
+// ErrNotFound for unknown IDs and ErrDeleted for items in the trash.
+func GetAnime(ctx context.Context, id int64) (*types.Anime, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	row := Reader.QueryRowContext(ctx, `SELECT `+animeColumns+` FROM anime WHERE id = ?`, id)
+
+	a, err := scanAnime(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err == nil && a.DeletedAt != nil {
+		return nil, ErrDeleted
+	}
+	return a, err
+}
+
+// AnimeByTitle returns the live anime of a type with the given title,
+// ignoring case. It fails with ErrNotFound when there is none.
+func AnimeByTitle(ctx context.Context, title string, animeType string) (*types.Anime, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	row := Reader.QueryRowContext(ctx, `
+		SELECT `+animeColumns+` FROM anime
+		WHERE title = ? COLLATE NOCASE AND type = ? AND deleted_at IS NULL
+		ORDER BY id LIMIT 1`, title, animeType)
+
+	a, err := scanAnime(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return a, err
+}
+
+// CreateAnime inserts a new anime and sets its ID and timestamps.
+func CreateAnime(ctx context.Context, a *types.Anime) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	if a.AltTitles == nil {
+		a.AltTitles = []string{}
+	}
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO anime (title, alt_titles, type, description, cover_path, status, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			a.Title, joinTitles(a.AltTitles), a.Type, a.Description, a.CoverPath, a.Status, toUnix(now), toUnix(now))
+		if err != nil {
+			return err
+		}
+
+		a.ID, err = res.LastInsertId()
+		a.CreatedAt, a.UpdatedAt = now, now
+		return err
+	})
+}
+
+const episodeColumns = `id, anime_id, number, title, file_path, mime_type, size, duration, created_at`
+
+func scanEpisode(row rowScanner) (*types.AnimeEpisode, error) {
+	var (
+		e       types.AnimeEpisode
+		created int64
+	)
+
+	err := row.Scan(&e.ID, &e.AnimeID, &e.Number, &e.Title, &e.FilePath, &e.MimeType, &e.Size, &e.Duration, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	e.CreatedAt = fromUnix(created)
+	return &e, nil
+}
+
+// CreateEpisode inserts an episode and sets its ID. It fails with ErrConflict
+// when the anime already has an episode with that number.
+func CreateEpisode(ctx context.Context, e *types.AnimeEpisode) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM anime_episodes WHERE anime_id = ? AND number = ?)`, e.AnimeID, e.Number).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrConflict
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO anime_episodes (anime_id, number, title, file_path, mime_type, size, duration, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.AnimeID, e.Number, e.Title, e.FilePath, e.MimeType, e.Size, e.Duration, toUnix(now))
+		if err != nil {
+			return err
+		}
+
+		e.ID, err = res.LastInsertId()
+		e.CreatedAt = now
+		return err
+	})
+}
+
+// UpdateEpisodeFile saves what was read from an episode's file after it
+// changed on disk. It fails with ErrNotFound for unknown episodes.
+func UpdateEpisodeFile(ctx context.Context, e *types.AnimeEpisode) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE anime_episodes SET file_path = ?, mime_type = ?, size = ?, duration = ?
+			WHERE id = ?`,
+			e.FilePath, e.MimeType, e.Size, e.Duration, e.ID)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// ListEpisodes returns the episodes of an anime in order.
+func ListEpisodes(ctx context.Context, animeID int64) ([]types.AnimeEpisode, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	rows, err := Reader.QueryContext(ctx, `SELECT `+episodeColumns+` FROM anime_episodes WHERE anime_id = ? ORDER BY number`, animeID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	episodes := []types.AnimeEpisode{}
+	for rows.Next() {
+		e, err := scanEpisode(rows)
+		if err != nil {
+			return nil, err
+		}
+		episodes = append(episodes, *e)
+	}
+	return episodes, rows.Err()
+}
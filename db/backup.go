@@ -0,0 +1,177 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+)
+
+// path of the live database, remembered by Open so Restore can swap it out
+var dbPath string
+
+// Snapshot writes a consistent copy of the live database to dest with
+// `VACUUM INTO`. The read pool is query-only, which SQLite treats as forbidding
+// VACUUM, so a separate connection is opened; in WAL mode it reads alongside
+// the writer without blocking it. dest must not exist yet.
+func Snapshot(ctx context.Context, dest string) error {
+	// Keep Restore from swapping the file underneath
+	poolsMu.RLock()
+	defer poolsMu.RUnlock()
+
+	conn, err := sql.Open("sqlite", dsn(dbPath))
+	if err != nil {
+		return fmt.Errorf("failed to open database for snapshot: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `VACUUM INTO ?`, dest); err != nil {
+		return fmt.Errorf("failed to snapshot database to %q: %w", dest, err)
+	}
+	return nil
+}
+
+// IntegrityCheck runs `PRAGMA integrity_check` on the live database and
+// returns the problems it found; an empty result means the database is sound.
+func IntegrityCheck(ctx context.Context) ([]string, error) {
+	poolsMu.RLock()
+	defer poolsMu.RUnlock()
+
+	return integrityCheck(ctx, Reader)
+}
+
+// CheckFile runs `PRAGMA integrity_check` on a database file that isn't open,
+// such as a snapshot about to be restored.
+func CheckFile(ctx context.Context, path string) ([]string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer conn.Close()
+
+	return integrityCheck(ctx, conn)
+}
+
+func integrityCheck(ctx context.Context, conn *sql.DB) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, `PRAGMA integrity_check;`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	problems := []string{}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+// Restore replaces the live database with the snapshot at src. Both pools are
+// closed while the file is swapped: queries and transactions already running
+// finish first, later ones wait until the restored database is open. The
+// previous database is kept as `<name>.pre-restore` and put back if the
+// snapshot fails to open.
+func Restore(ctx context.Context, src string) error {
+	problems, err := CheckFile(ctx, src)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("snapshot %q failed the integrity check: %s", src, problems[0])
+	}
+
+	// Copy first, so the swap below is a rename on the same filesystem
+	staged := dbPath + ".restore"
+	if err := copyFile(src, staged); err != nil {
+		return fmt.Errorf("failed to stage snapshot: %w", err)
+	}
+	defer os.Remove(staged)
+
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
+
+	// Moving the file aside without its WAL would lose the last transactions,
+	// so every frame must be in the main file before the pools are closed
+	if err := checkpoint(ctx); err != nil {
+		return err
+	}
+	if err := closePools(); err != nil {
+		return reopen(fmt.Errorf("failed to close database: %w", err))
+	}
+	if stat, err := os.Stat(dbPath + "-wal"); err == nil && stat.Size() > 0 {
+		return reopen(fmt.Errorf("database still has a write-ahead log after closing, not moving it aside"))
+	}
+
+	previous := dbPath + ".pre-restore"
+	if err := os.Rename(dbPath, previous); err != nil {
+		return reopen(fmt.Errorf("failed to move current database aside: %w", err))
+	}
+	os.Remove(dbPath + "-wal")
+	os.Remove(dbPath + "-shm")
+
+	if err := os.Rename(staged, dbPath); err != nil {
+		os.Rename(previous, dbPath)
+		return reopen(fmt.Errorf("failed to move snapshot into place: %w", err))
+	}
+
+	if err := Open(dbPath); err != nil {
+		os.Rename(previous, dbPath)
+		return reopen(fmt.Errorf("failed to open restored database: %w", err))
+	}
+	return nil
+}
+
+// checkpoint copies the whole write-ahead log into the main database file and
+// empties it. It fails when a reader kept part of the log from being copied.
+func checkpoint(ctx context.Context) error {
+	var busy, frames, copied int
+	if err := Writer.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE);`).Scan(&busy, &frames, &copied); err != nil {
+		return fmt.Errorf("failed to checkpoint the database: %w", err)
+	}
+	if busy != 0 || frames != copied {
+		return fmt.Errorf("failed to checkpoint the database: %d of %d log frames copied", copied, frames)
+	}
+	return nil
+}
+
+// reopen brings the database back after a failed restore and returns cause.
+func reopen(cause error) error {
+	if err := Open(dbPath); err != nil {
+		return fmt.Errorf("%w; reopening the previous database also failed: %w", cause, err)
+	}
+	return cause
+}
+
+func copyFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -1,49 +1,188 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"strings"
+	"net/url"
+	"runtime"
+	"sync"
 	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
-var Conn *sql.DB
+// INFO: SQLite allows many readers but only one writer at a time. Instead of
+// letting writes fight reads on one pool (and retrying on "database is
+// locked"), the database is opened twice:
+//   - Reader is a pool of query-only connections, which never block each
+//     other and in WAL mode never block the writer either.
+//   - Writer is a single connection, so writes queue up in database/sql
+//     rather than inside SQLite. Its transactions start with BEGIN IMMEDIATE
+//     and take the write lock up front instead of failing halfway through.
+var (
+	Reader *sql.DB
+	Writer *sql.DB
+)
 
-// Initialize all tables and triggers
-func InitializeSchema(db *sql.DB) error {
-	// Set PRAGMA settings to improve concurrency and reliability
-	pragmas := []string{
-		`PRAGMA journal_mode = WAL;`,  // concurrent read/write
-		`PRAGMA foreign_keys = ON;`,   // enforce FKs
-		`PRAGMA busy_timeout = 3000;`, // wait 3s if db is locked
-	}
+// INFO: Restore closes and replaces both pools while background jobs (scans,
+// trash purges, upload expiry) keep running. Every use of Reader or Writer
+// holds a read lock on poolsMu, taken by readContext, poolContext or WithTx,
+// and Restore waits for them with the write lock. The lock isn't reentrant:
+// code holding it must not call another function that takes it.
+var poolsMu sync.RWMutex
+
+// INFO: Upper bounds for a single statement or transaction, applied on top of
+// whatever deadline the request context already carries.
+const (
+	readTimeout  = 5 * time.Second
+	writeTimeout = 10 * time.Second
+	// How long SQLite itself waits for a lock before reporting SQLITE_BUSY
+	busyTimeout = 5 * time.Second
+)
 
+// ErrNotFound is returned by lookups when no row matches.
+var ErrNotFound = errors.New("record not found")
+
+// ErrDeleted is returned by lookups when the row exists but was soft-deleted.
+var ErrDeleted = errors.New("record was deleted")
+
+// ErrConflict is returned by inserts that would duplicate a unique record.
+var ErrConflict = errors.New("record already exists")
+
+// dsn builds a connection string that sets busy_timeout, then the given pragmas
+// on every new connection.
+func dsn(path string, pragmas ...string) string {
+	q := url.Values{}
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
 	for _, pragma := range pragmas {
-		if _, err := db.Exec(pragma); err != nil {
-			return fmt.Errorf("failed to set pragma %q: %w", pragma, err)
-		}
+		q.Add("_pragma", pragma)
+	}
+	return path + "?" + q.Encode()
+}
+
+// Open connects to the SQLite database at path and brings its schema up to date.
+func Open(path string) error {
+	writer, err := sql.Open("sqlite", dsn(path, "foreign_keys(1)", "journal_mode(WAL)", "synchronous(NORMAL)")+"&_txlock=immediate")
+	if err != nil {
+		return fmt.Errorf("failed to open database %q: %w", path, err)
+	}
+	writer.SetMaxOpenConns(1)
+
+	if err := InitializeSchema(writer); err != nil {
+		writer.Close()
+		return err
+	}
+
+	reader, err := sql.Open("sqlite", dsn(path, "foreign_keys(1)", "query_only(1)"))
+	if err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to open database %q: %w", path, err)
+	}
+	reader.SetMaxOpenConns(max(4, runtime.NumCPU()))
+
+	if err := reader.Ping(); err != nil {
+		reader.Close()
+		writer.Close()
+		return fmt.Errorf("failed to open read pool for %q: %w", path, err)
 	}
+
+	Reader, Writer = reader, writer
+	dbPath = path
 	return nil
 }
 
-func WithRetryWrite(execFunc func() error) error {
-	const maxAttempts = 5
-	const retryDelay = 200 * time.Millisecond
+// Close shuts down both pools.
+func Close() error {
+	poolsMu.Lock()
+	defer poolsMu.Unlock()
 
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		err := execFunc()
-		if err == nil {
-			return nil
-		}
+	return closePools()
+}
+
+func closePools() error {
+	return errors.Join(Reader.Close(), Writer.Close())
+}
 
-		// Only retry if it's a SQLITE_BUSY error
-		if !strings.Contains(err.Error(), "database is locked") {
+// InitializeSchema verifies the connection settings and runs pending migrations.
+func InitializeSchema(db *sql.DB) error {
+	var mode string
+	if err := db.QueryRow(`PRAGMA journal_mode;`).Scan(&mode); err != nil {
+		return fmt.Errorf("failed to read journal mode: %w", err)
+	}
+	if mode != "wal" {
+		return fmt.Errorf("database is in %q journal mode, WAL is required", mode)
+	}
+
+	return migrate(db)
+}
+
+// IsBusy reports whether err is SQLite giving up on a lock (SQLITE_BUSY or
+// SQLITE_LOCKED, including their extended codes).
+func IsBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	}
+	return false
+}
+
+func readContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return poolContext(ctx, readTimeout)
+}
+
+// poolContext locks the pools in place until the returned cancel function is
+// called, and applies timeout to ctx.
+func poolContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	poolsMu.RLock()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+
+	var once sync.Once
+	return ctx, func() {
+		cancel()
+		once.Do(poolsMu.RUnlock)
+	}
+}
+
+// WithTx runs fn inside a write transaction and commits it when fn succeeds.
+// If the lock can't be taken within busy_timeout, the whole transaction is
+// retried with backoff until the write timeout runs out.
+func WithTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	ctx, cancel := poolContext(ctx, writeTimeout)
+	defer cancel()
+
+	backoff := 50 * time.Millisecond
+	for {
+		err := runTx(ctx, fn)
+		if err == nil || !IsBusy(err) {
 			return err
 		}
 
-		time.Sleep(retryDelay)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("database stayed busy: %w", err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Second)
 	}
+}
 
-	return errors.New("write failed after retries")
+func runTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := Writer.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"LocalDex/types"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// INFO: Filter expressions, as in `tags:vacation+taken:2024`. Terms are joined
+// by `+`, or spaces since that is what `+` turns into in a query string, and
+// all of them must match. A term is either `key:value` or plain text matched
+// against titles; commas separate alternatives of a key, as in
+// `taken:2023,2024`.
+
+// FilterError describes what is wrong with a filter expression.
+type FilterError struct {
+	Message string
+}
+
+func (e *FilterError) Error() string {
+	return e.Message
+}
+
+func filterErrorf(format string, args ...any) error {
+	return &FilterError{Message: fmt.Sprintf(format, args...)}
+}
+
+type filterTerm struct {
+	key    string
+	values []string
+}
+
+func parseFilter(expr string) []filterTerm {
+	var terms []filterTerm
+	for _, word := range strings.FieldsFunc(expr, func(r rune) bool { return r == '+' || r == ' ' || r == '\t' }) {
+		key, value, ok := strings.Cut(word, ":")
+		if !ok {
+			terms = append(terms, filterTerm{values: []string{word}})
+			continue
+		}
+		terms = append(terms, filterTerm{key: strings.ToLower(key), values: strings.Split(value, ",")})
+	}
+	return terms
+}
+
+// filterKey turns one value of a term into a condition.
+type filterKey func(value string) (string, []any, error)
+
+// filterSet holds the keys accepted in the filters of a library, and how
+// plain words are matched.
+type filterSet struct {
+	keys map[string]filterKey
+	text filterKey
+}
+
+var filterSets = map[string]filterSet{
+	types.MediaPhoto: {
+		keys: map[string]filterKey{
+			"tags":     tagCond(types.MediaPhoto),
+			"favorite": boolCond("favorite"),
+			"type": func(value string) (string, []any, error) {
+				switch value {
+				case "image", "video":
+					return `mime_type LIKE ?`, []any{value + "/%"}, nil
+				}
+				return "", nil, filterErrorf("type must be image or video")
+			},
+			// Photos without a capture time count as taken when they were added
+			"taken":  dateCond("COALESCE(taken_at, created_at)"),
+			"added":  dateCond("created_at"),
+			"camera": textCond("camera_make || ' ' || camera_model"),
+			"title":  textCond("title"),
+		},
+		text: func(value string) (string, []any, error) {
+			like := "%" + escapeLike(value) + "%"
+			return `title LIKE ? ESCAPE '\' OR caption LIKE ? ESCAPE '\'`, []any{like, like}, nil
+		},
+	},
+	types.MediaAnime: {
+		keys: map[string]filterKey{
+			"tags":   tagCond(types.MediaAnime),
+			"type":   oneOfCond("type", types.AnimeTypeAnime, types.AnimeTypeHentai),
+			"status": equalCond("status"),
+			"added":  dateCond("created_at"),
+			"title":  textCond("title"),
+		},
+		text: textCond("title"),
+	},
+	types.MediaManga: {
+		keys: map[string]filterKey{
+			"tags":  tagCond(types.MediaManga),
+			"type":  oneOfCond("type", types.MangaTypeManga, types.MangaTypeDoujin),
+			"added": dateCond("created_at"),
+			"title": textCond("title"),
+		},
+		text: textCond("title"),
+	},
+}
+
+func boolCond(column string) filterKey {
+	return func(value string) (string, []any, error) {
+		switch value {
+		case "true":
+			return column + ` = 1`, nil, nil
+		case "false":
+			return column + ` = 0`, nil, nil
+		}
+		return "", nil, filterErrorf("%s must be true or false", column)
+	}
+}
+
+func equalCond(column string) filterKey {
+	return func(value string) (string, []any, error) {
+		return column + ` = ? COLLATE NOCASE`, []any{value}, nil
+	}
+}
+
+func oneOfCond(column string, allowed ...string) filterKey {
+	return func(value string) (string, []any, error) {
+		for _, a := range allowed {
+			if value == a {
+				return column + ` = ?`, []any{value}, nil
+			}
+		}
+		return "", nil, filterErrorf("%s must be one of %s", column, strings.Join(allowed, ", "))
+	}
+}
+
+func textCond(column string) filterKey {
+	return func(value string) (string, []any, error) {
+		return column + ` LIKE ? ESCAPE '\'`, []any{"%" + escapeLike(value) + "%"}, nil
+	}
+}
+
+// dateCond matches a year, month or day: `2024`, `2024-05` or `2024-05-06`.
+func dateCond(column string) filterKey {
+	return func(value string) (string, []any, error) {
+		for _, layout := range []struct {
+			format string
+			next   func(time.Time) time.Time
+		}{
+			{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+			{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+			{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		} {
+			if len(value) != len(layout.format) {
+				continue
+			}
+			if start, err := time.Parse(layout.format, value); err == nil {
+				return column + ` >= ? AND ` + column + ` < ?`, []any{toUnix(start), toUnix(layout.next(start))}, nil
+			}
+		}
+		return "", nil, filterErrorf("%q is not a date like 2024, 2024-05 or 2024-05-06", value)
+	}
+}
+
+// tagCond matches items carrying a tag or one of its aliases. A tag without
+// a namespace matches the name in any namespace.
+func tagCond(kind string) filterKey {
+	return func(value string) (string, []any, error) {
+		tag, err := ParseTag(value)
+		if err != nil {
+			return "", nil, filterErrorf("%s", err.Error())
+		}
+
+		tags := `SELECT COALESCE(alias_of, id) FROM tags WHERE name = ?`
+		args := []any{kind, tag.Name}
+		if len(tag.Namespace) != 0 {
+			tags += ` AND namespace = ?`
+			args = append(args, tag.Namespace)
+		}
+		return `id IN (SELECT item_id FROM item_tags WHERE kind = ? AND tag_id IN (` + tags + `))`, args, nil
+	}
+}
+
+// applyFilter adds the conditions of a filter expression over items of a
+// kind to f.
+func applyFilter(f *listFilter, kind string, expr string) error {
+	set := filterSets[kind]
+
+	for _, term := range parseFilter(expr) {
+		cond := set.text
+		if len(term.key) != 0 {
+			var ok bool
+			if cond, ok = set.keys[term.key]; !ok {
+				return filterErrorf("unknown key %q", term.key)
+			}
+		}
+
+		var (
+			alternatives []string
+			args         []any
+		)
+		for _, value := range term.values {
+			if len(value) == 0 {
+				return filterErrorf("%q needs a value", term.key)
+			}
+			c, a, err := cond(value)
+			if err != nil {
+				return err
+			}
+			alternatives = append(alternatives, "("+c+")")
+			args = append(args, a...)
+		}
+		f.add("("+strings.Join(alternatives, " OR ")+")", args...)
+	}
+	return nil
+}
+
+// CheckFilter validates a filter expression over items of a kind. Problems
+// are reported as a *FilterError.
+func CheckFilter(kind string, expr string) error {
+	return applyFilter(&listFilter{}, kind, expr)
+}
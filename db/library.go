@@ -0,0 +1,174 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// INFO: Files indexed in place from the library roots. The modification time
+// is kept in nanoseconds, so rewriting a file within the same second still
+// counts as a change. Device and inode numbers are stored bit for bit.
+
+const libraryFileColumns = `id, root, path, kind, item_id, size, mtime, device, inode, quick_hash, indexed_at, offline_at`
+
+func scanLibraryFile(row rowScanner) (*types.LibraryFile, error) {
+	var (
+		f              types.LibraryFile
+		mtime, indexed int64
+		device, inode  int64
+		offline        sql.NullInt64
+	)
+
+	err := row.Scan(&f.ID, &f.Root, &f.Path, &f.Kind, &f.ItemID, &f.Size, &mtime, &device, &inode, &f.QuickHash, &indexed, &offline)
+	if err != nil {
+		return nil, err
+	}
+
+	f.ModTime = time.Unix(0, mtime).UTC()
+	f.Device, f.Inode = uint64(device), uint64(inode)
+	f.IndexedAt = fromUnix(indexed)
+	f.OfflineAt = fromNullUnix(offline)
+	return &f, nil
+}
+
+// libraryItemTables maps the kind of a library file to the table of its items.
+var libraryItemTables = map[string]string{
+	types.MediaPhoto: "photos",
+	types.MediaAnime: "anime_episodes",
+	types.MediaManga: "manga_chapters",
+}
+
+// LibraryFiles returns the files indexed under a root, keyed by path.
+func LibraryFiles(ctx context.Context, root string) (map[string]types.LibraryFile, error) {
+	// A root can hold hundreds of thousands of files
+	ctx, cancel := poolContext(ctx, time.Minute)
+	defer cancel()
+
+	rows, err := Reader.QueryContext(ctx, `SELECT `+libraryFileColumns+` FROM library_files WHERE root = ?`, root)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make(map[string]types.LibraryFile)
+	for rows.Next() {
+		f, err := scanLibraryFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files[f.Path] = *f
+	}
+	return files, rows.Err()
+}
+
+// OfflineLibraryFiles returns the indexed files that are missing from disk,
+// the most recently gone first.
+func OfflineLibraryFiles(ctx context.Context) ([]types.LibraryFile, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	rows, err := Reader.QueryContext(ctx, `SELECT `+libraryFileColumns+` FROM library_files WHERE offline_at IS NOT NULL ORDER BY offline_at DESC, path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []types.LibraryFile{}
+	for rows.Next() {
+		f, err := scanLibraryFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, *f)
+	}
+	return files, rows.Err()
+}
+
+// SaveLibraryFile records a file as indexed and online, replacing an earlier
+// entry for the same path, and sets its ID.
+func SaveLibraryFile(ctx context.Context, f *types.LibraryFile) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO library_files (root, path, kind, item_id, size, mtime, device, inode, quick_hash, indexed_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (path) DO UPDATE SET
+				root = excluded.root, kind = excluded.kind, item_id = excluded.item_id,
+				size = excluded.size, mtime = excluded.mtime,
+				device = excluded.device, inode = excluded.inode, quick_hash = excluded.quick_hash,
+				indexed_at = excluded.indexed_at, offline_at = NULL
+			RETURNING id`,
+			f.Root, f.Path, f.Kind, f.ItemID, f.Size, f.ModTime.UnixNano(), int64(f.Device), int64(f.Inode), f.QuickHash, toUnix(now)).Scan(&f.ID)
+		if err != nil {
+			return err
+		}
+
+		f.IndexedAt, f.OfflineAt = now, nil
+		return nil
+	})
+}
+
+// MoveLibraryFile points an indexed file and its item at the path the file
+// was renamed to, so the item keeps its ID and everything attached to it.
+// f carries the new path and what was read from the file there.
+func MoveLibraryFile(ctx context.Context, f *types.LibraryFile) error {
+	table, ok := libraryItemTables[f.Kind]
+	if !ok {
+		return fmt.Errorf("unknown library kind %q", f.Kind)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE library_files SET root = ?, path = ?, size = ?, mtime = ?, device = ?, inode = ?, quick_hash = ?,
+				indexed_at = ?, offline_at = NULL
+			WHERE id = ?`,
+			f.Root, f.Path, f.Size, f.ModTime.UnixNano(), int64(f.Device), int64(f.Inode), f.QuickHash,
+			toUnix(now), f.ID)
+		if err != nil {
+			return err
+		}
+
+		// The table name comes from libraryItemTables, never from input
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET file_path = ? WHERE id = ?`, f.Path, f.ItemID); err != nil {
+			return err
+		}
+
+		f.IndexedAt, f.OfflineAt = now, nil
+		return nil
+	})
+}
+
+// SetLibraryFilesOffline marks indexed files as missing from disk. Their
+// items stay in the library.
+func SetLibraryFilesOffline(ctx context.Context, ids []int64, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		// Chunked to stay below SQLite's limit on bound parameters
+		for start := 0; start < len(ids); start += 500 {
+			chunk := ids[start:min(start+500, len(ids))]
+
+			args := make([]any, 0, len(chunk)+1)
+			args = append(args, toUnix(at))
+			for _, id := range chunk {
+				args = append(args, id)
+			}
+
+			_, err := tx.ExecContext(ctx, `
+				UPDATE library_files SET offline_at = ?
+				WHERE offline_at IS NULL AND id IN (?`+strings.Repeat(", ?", len(chunk)-1)+`)`, args...)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"strings"
+)
+
+// INFO: Accepted sort keys per library, mapped to their ORDER BY clause. The
+// first key is the default. `id` breaks ties so paging is stable.
+var (
+	PhotoSorts = sortSet{
+		{"created_desc", "created_at DESC, id DESC"},
+		{"created_asc", "created_at ASC, id ASC"},
+		// Photos without a capture time fall back to when they were added
+		{"taken_desc", "COALESCE(taken_at, created_at) DESC, id DESC"},
+		{"taken_asc", "COALESCE(taken_at, created_at) ASC, id ASC"},
+		{"updated_desc", "updated_at DESC, id DESC"},
+		{"title_asc", "title COLLATE NOCASE ASC, id ASC"},
+		{"title_desc", "title COLLATE NOCASE DESC, id DESC"},
+	}
+	AnimeSorts = sortSet{
+		{"created_desc", "created_at DESC, id DESC"},
+		{"created_asc", "created_at ASC, id ASC"},
+		{"updated_desc", "updated_at DESC, id DESC"},
+		{"title_asc", "title COLLATE NOCASE ASC, id ASC"},
+		{"title_desc", "title COLLATE NOCASE DESC, id DESC"},
+		{"views_desc", "view_count DESC, id DESC"},
+	}
+	MangaSorts = sortSet{
+		{"created_desc", "created_at DESC, id DESC"},
+		{"created_asc", "created_at ASC, id ASC"},
+		{"updated_desc", "updated_at DESC, id DESC"},
+		{"title_asc", "title COLLATE NOCASE ASC, id ASC"},
+		{"title_desc", "title COLLATE NOCASE DESC, id DESC"},
+		{"reads_desc", "read_count DESC, id DESC"},
+	}
+	AlbumSorts = sortSet{
+		{"updated_desc", "updated_at DESC, id DESC"},
+		{"created_desc", "created_at DESC, id DESC"},
+		{"created_asc", "created_at ASC, id ASC"},
+		{"title_asc", "title COLLATE NOCASE ASC, id ASC"},
+		{"title_desc", "title COLLATE NOCASE DESC, id DESC"},
+	}
+	// Photos of manual albums also sort by the album's own order
+	AlbumPhotoSorts = append(sortSet{{"position", "position ASC, id ASC"}}, PhotoSorts...)
+)
+
+type sortKey struct {
+	name    string
+	orderBy string
+}
+
+type sortSet []sortKey
+
+// Keys lists the accepted sort names, default first.
+func (s sortSet) Keys() []string {
+	keys := make([]string, len(s))
+	for i, k := range s {
+		keys[i] = k.name
+	}
+	return keys
+}
+
+func (s sortSet) orderBy(name string) string {
+	for _, k := range s {
+		if k.name == name {
+			return k.orderBy
+		}
+	}
+	return s[0].orderBy
+}
+
+// escapeLike escapes the LIKE wildcards of user input; use with `ESCAPE '\'`.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// listFilter is the WHERE clause of a listing, built up condition by condition.
+type listFilter struct {
+	conds []string
+	args  []any
+}
+
+func (f *listFilter) add(cond string, args ...any) {
+	f.conds = append(f.conds, cond)
+	f.args = append(f.args, args...)
+}
+
+func (f *listFilter) where() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+// listRows counts the matching rows of a table and scans the requested page.
+func listRows[T any](ctx context.Context, table string, columns string, f listFilter, orderBy string, q types.ListQuery, scan func(rowScanner) (*T, error)) ([]T, int, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	var total int
+	if err := Reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table+f.where(), f.args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	if total == 0 || q.Offset() >= total {
+		return nil, total, nil
+	}
+
+	args := append(append([]any{}, f.args...), q.Limit, q.Offset())
+	rows, err := Reader.QueryContext(ctx, `SELECT `+columns+` FROM `+table+f.where()+` ORDER BY `+orderBy+` LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		items = append(items, *item)
+	}
+	return items, total, rows.Err()
+}
+
+// ListPhotos returns one page of live photos and the total number of matches.
+func ListPhotos(ctx context.Context, q types.ListQuery) ([]types.Photo, int, error) {
+	var f listFilter
+	f.add(`deleted_at IS NULL`)
+	if err := applyFilter(&f, types.MediaPhoto, q.Filter); err != nil {
+		return nil, 0, err
+	}
+
+	return listRows(ctx, "photos", photoColumns, f, PhotoSorts.orderBy(q.Sort), q, scanPhoto)
+}
+
+// ListAnime returns one page of live anime and the total number of matches.
+func ListAnime(ctx context.Context, q types.ListQuery) ([]types.Anime, int, error) {
+	var f listFilter
+	f.add(`deleted_at IS NULL`)
+	if len(q.Type) != 0 {
+		f.add(`type = ?`, q.Type)
+	}
+	if err := applyFilter(&f, types.MediaAnime, q.Filter); err != nil {
+		return nil, 0, err
+	}
+
+	return listRows(ctx, "anime", animeColumns, f, AnimeSorts.orderBy(q.Sort), q, scanAnime)
+}
+
+// ListManga returns one page of live manga and the total number of matches.
+func ListManga(ctx context.Context, q types.ListQuery) ([]types.Manga, int, error) {
+	var f listFilter
+	f.add(`deleted_at IS NULL`)
+	if len(q.Type) != 0 {
+		f.add(`type = ?`, q.Type)
+	}
+	if err := applyFilter(&f, types.MediaManga, q.Filter); err != nil {
+		return nil, 0, err
+	}
+
+	return listRows(ctx, "manga", mangaColumns, f, MangaSorts.orderBy(q.Sort), q, scanManga)
+}
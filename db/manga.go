@@ -0,0 +1,194 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const mangaColumns = `id, title, alt_titles, type, description, cover_path, read_count, created_at, updated_at, deleted_at`
+
+func scanManga(row rowScanner) (*types.Manga, error) {
+	var (
+		m                types.Manga
+		altTitles        string
+		created, updated int64
+		deleted          sql.NullInt64
+	)
+
+	err := row.Scan(&m.ID, &m.Title, &altTitles, &m.Type, &m.Description, &m.CoverPath, &m.ReadCount, &created, &updated, &deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	m.AltTitles = splitTitles(altTitles)
+	m.CreatedAt = fromUnix(created)
+	m.UpdatedAt = fromUnix(updated)
+	m.DeletedAt = fromNullUnix(deleted)
+	return &m, nil
+}
+
+// GetManga returns a manga that hasn't been deleted. It fails with
+// ErrNotFound for unknown IDs and ErrDeleted for items in the trash.
+func GetManga(ctx context.Context, id int64) (*types.Manga, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	row := Reader.QueryRowContext(ctx, `SELECT `+mangaColumns+` FROM manga WHERE id = ?`, id)
+
+	m, err := scanManga(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err == nil && m.DeletedAt != nil {
+		return nil, ErrDeleted
+	}
+	return m, err
+}
+
+// MangaByTitle returns the live manga of a type with the given title,
+// ignoring case. It fails with ErrNotFound when there is none.
+func MangaByTitle(ctx context.Context, title string, mangaType string) (*types.Manga, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	row := Reader.QueryRowContext(ctx, `
+		SELECT `+mangaColumns+` FROM manga
+		WHERE title = ? COLLATE NOCASE AND type = ? AND deleted_at IS NULL
+		ORDER BY id LIMIT 1`, title, mangaType)
+
+	m, err := scanManga(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return m, err
+}
+
+// CreateManga inserts a new manga and sets its ID and timestamps.
+func CreateManga(ctx context.Context, m *types.Manga) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	if m.AltTitles == nil {
+		m.AltTitles = []string{}
+	}
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO manga (title, alt_titles, type, description, cover_path, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			m.Title, joinTitles(m.AltTitles), m.Type, m.Description, m.CoverPath, toUnix(now), toUnix(now))
+		if err != nil {
+			return err
+		}
+
+		m.ID, err = res.LastInsertId()
+		m.CreatedAt, m.UpdatedAt = now, now
+		return err
+	})
+}
+
+const chapterColumns = `id, manga_id, volume, chapter, title, file_path, mime_type, size, created_at`
+
+func scanChapter(row rowScanner) (*types.MangaChapter, error) {
+	var (
+		c       types.MangaChapter
+		created int64
+	)
+
+	err := row.Scan(&c.ID, &c.MangaID, &c.Volume, &c.Chapter, &c.Title, &c.FilePath, &c.MimeType, &c.Size, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	c.CreatedAt = fromUnix(created)
+	return &c, nil
+}
+
+// GetChapter returns a chapter of a manga. It fails with ErrNotFound when the
+// manga has no chapter with that ID.
+func GetChapter(ctx context.Context, mangaID int64, id int64) (*types.MangaChapter, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	row := Reader.QueryRowContext(ctx, `SELECT `+chapterColumns+` FROM manga_chapters WHERE id = ? AND manga_id = ?`, id, mangaID)
+
+	c, err := scanChapter(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return c, err
+}
+
+// CreateChapter inserts a chapter and sets its ID. It fails with ErrConflict
+// when the manga already has that volume and chapter.
+func CreateChapter(ctx context.Context, c *types.MangaChapter) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM manga_chapters WHERE manga_id = ? AND volume = ? AND chapter = ?)`, c.MangaID, c.Volume, c.Chapter).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrConflict
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO manga_chapters (manga_id, volume, chapter, title, file_path, mime_type, size, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			c.MangaID, c.Volume, c.Chapter, c.Title, c.FilePath, c.MimeType, c.Size, toUnix(now))
+		if err != nil {
+			return err
+		}
+
+		c.ID, err = res.LastInsertId()
+		c.CreatedAt = now
+		return err
+	})
+}
+
+// UpdateChapterFile saves what was read from a chapter's file after it
+// changed on disk. It fails with ErrNotFound for unknown chapters.
+func UpdateChapterFile(ctx context.Context, c *types.MangaChapter) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE manga_chapters SET file_path = ?, mime_type = ?, size = ?
+			WHERE id = ?`,
+			c.FilePath, c.MimeType, c.Size, c.ID)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// ListChapters returns the chapters of a manga in reading order.
+func ListChapters(ctx context.Context, mangaID int64) ([]types.MangaChapter, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	rows, err := Reader.QueryContext(ctx, `SELECT `+chapterColumns+` FROM manga_chapters WHERE manga_id = ? ORDER BY volume, chapter`, mangaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chapters := []types.MangaChapter{}
+	for rows.Next() {
+		c, err := scanChapter(rows)
+		if err != nil {
+			return nil, err
+		}
+		chapters = append(chapters, *c)
+	}
+	return chapters, rows.Err()
+}
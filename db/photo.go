@@ -0,0 +1,224 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const photoColumns = `id, title, caption, file_path, mime_type, size, width, height, duration, favorite, sha256, dhash, stored,
+	taken_at, camera_make, camera_model, lens_model, latitude, longitude, orientation,
+	created_at, updated_at, deleted_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPhoto(row rowScanner) (*types.Photo, error) {
+	var (
+		p                types.Photo
+		created, updated int64
+		taken, deleted   sql.NullInt64
+		dhash            sql.NullInt64
+		lat, lon         sql.NullFloat64
+	)
+
+	err := row.Scan(&p.ID, &p.Title, &p.Caption, &p.FilePath, &p.MimeType, &p.Size, &p.Width, &p.Height, &p.Duration, &p.Favorite, &p.SHA256, &dhash, &p.Stored,
+		&taken, &p.CameraMake, &p.CameraModel, &p.LensModel, &lat, &lon, &p.Orientation,
+		&created, &updated, &deleted)
+	if err != nil {
+		return nil, err
+	}
+
+	if dhash.Valid {
+		// SQLite integers are signed, the hash is stored bit for bit
+		h := uint64(dhash.Int64)
+		p.DHash = &h
+	}
+	p.TakenAt = fromNullUnix(taken)
+	p.Latitude = fromNullFloat(lat)
+	p.Longitude = fromNullFloat(lon)
+	p.CreatedAt = fromUnix(created)
+	p.UpdatedAt = fromUnix(updated)
+	p.DeletedAt = fromNullUnix(deleted)
+	return &p, nil
+}
+
+// GetPhoto returns a photo that hasn't been deleted. It fails with
+// ErrNotFound for unknown IDs and ErrDeleted for items in the trash.
+func GetPhoto(ctx context.Context, id int64) (*types.Photo, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	row := Reader.QueryRowContext(ctx, `SELECT `+photoColumns+` FROM photos WHERE id = ?`, id)
+
+	p, err := scanPhoto(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err == nil && p.DeletedAt != nil {
+		return nil, ErrDeleted
+	}
+	return p, err
+}
+
+// CreatePhoto inserts a new photo and sets its ID and timestamps. It fails
+// with ErrConflict when the file of a stored photo already belongs to another
+// one, live or in the trash.
+func CreatePhoto(ctx context.Context, p *types.Photo) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		if p.Stored {
+			var exists bool
+			err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM photos WHERE stored = 1 AND sha256 = ?)`, p.SHA256).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return ErrConflict
+			}
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO photos (title, caption, file_path, mime_type, size, width, height, duration, favorite, sha256, dhash, stored,
+				taken_at, camera_make, camera_model, lens_model, latitude, longitude, orientation,
+				created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.Title, p.Caption, p.FilePath, p.MimeType, p.Size, p.Width, p.Height, p.Duration, p.Favorite, p.SHA256, toNullHash(p.DHash), p.Stored,
+			toNullUnix(p.TakenAt), p.CameraMake, p.CameraModel, p.LensModel, p.Latitude, p.Longitude, p.Orientation,
+			toUnix(now), toUnix(now))
+		if err != nil {
+			return err
+		}
+
+		p.ID, err = res.LastInsertId()
+		p.CreatedAt, p.UpdatedAt = now, now
+		return err
+	})
+}
+
+// UpdatePhotoDetails saves the editable fields of a live photo: title,
+// caption and capture metadata. It fails with ErrNotFound when the photo is
+// gone or in the trash.
+func UpdatePhotoDetails(ctx context.Context, p *types.Photo) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE photos SET title = ?, caption = ?,
+				taken_at = ?, camera_make = ?, camera_model = ?, lens_model = ?, latitude = ?, longitude = ?, orientation = ?,
+				updated_at = ?
+			WHERE id = ? AND deleted_at IS NULL`,
+			p.Title, p.Caption,
+			toNullUnix(p.TakenAt), p.CameraMake, p.CameraModel, p.LensModel, p.Latitude, p.Longitude, p.Orientation,
+			toUnix(now), p.ID)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		p.UpdatedAt = now
+		return nil
+	})
+}
+
+// UpdatePhotoFile saves what was read from a photo's file after it changed on
+// disk: type, size, dimensions and hashes. Edited details are kept.
+func UpdatePhotoFile(ctx context.Context, p *types.Photo) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			UPDATE photos SET file_path = ?, mime_type = ?, size = ?, width = ?, height = ?, duration = ?, sha256 = ?, dhash = ?,
+				updated_at = ?
+			WHERE id = ?`,
+			p.FilePath, p.MimeType, p.Size, p.Width, p.Height, p.Duration, p.SHA256, toNullHash(p.DHash),
+			toUnix(now), p.ID)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		p.UpdatedAt = now
+		return nil
+	})
+}
+
+func toNullHash(h *uint64) sql.NullInt64 {
+	if h == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*h), Valid: true}
+}
+
+// queryPhotos runs a SELECT of photoColumns and scans every row.
+func queryPhotos(ctx context.Context, query string, args ...any) ([]types.Photo, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	rows, err := Reader.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var photos []types.Photo
+	for rows.Next() {
+		p, err := scanPhoto(rows)
+		if err != nil {
+			return nil, err
+		}
+		photos = append(photos, *p)
+	}
+	return photos, rows.Err()
+}
+
+// PhotoBySHA256 returns a photo with the given content hash, live ones first,
+// or ErrNotFound. Photos in the trash count since they still hold their file.
+func PhotoBySHA256(ctx context.Context, sum string) (*types.Photo, error) {
+	photos, err := queryPhotos(ctx, `SELECT `+photoColumns+` FROM photos WHERE sha256 = ? ORDER BY deleted_at IS NOT NULL, id LIMIT 1`, sum)
+	if err != nil {
+		return nil, err
+	}
+	if len(photos) == 0 {
+		return nil, ErrNotFound
+	}
+	return &photos[0], nil
+}
+
+// HashedPhotos returns every live photo that has been hashed, for duplicate
+// detection.
+func HashedPhotos(ctx context.Context) ([]types.Photo, error) {
+	return queryPhotos(ctx, `SELECT `+photoColumns+` FROM photos WHERE sha256 != '' AND deleted_at IS NULL ORDER BY id`)
+}
+
+// UnhashedPhotos returns up to limit live photos with an ID above afterID
+// that have no content hash yet.
+func UnhashedPhotos(ctx context.Context, afterID int64, limit int) ([]types.Photo, error) {
+	return queryPhotos(ctx, `SELECT `+photoColumns+` FROM photos WHERE id > ? AND sha256 = '' AND deleted_at IS NULL ORDER BY id LIMIT ?`, afterID, limit)
+}
+
+// SetPhotoHashes stores the content and perceptual hash of a photo.
+func SetPhotoHashes(ctx context.Context, id int64, sum string, dhash *uint64) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE photos SET sha256 = ?, dhash = ? WHERE id = ?`, sum, toNullHash(dhash), id)
+		return err
+	})
+}
+
+// SoftDeletePhotos moves live photos to the trash and returns the IDs that
+// were actually deleted; unknown and already deleted IDs are skipped.
+func SoftDeletePhotos(ctx context.Context, ids []int64) ([]int64, error) {
+	return SoftDeleteItems(ctx, types.MediaPhoto, ids)
+}
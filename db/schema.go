@@ -0,0 +1,423 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// INFO: Schema migrations, applied in order and tracked through `PRAGMA user_version`.
+// Never edit a migration that has shipped; append a new one instead.
+var migrations = []string{
+	// 1: library tables
+	`
+	CREATE TABLE photos (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		title      TEXT    NOT NULL DEFAULT '',
+		caption    TEXT    NOT NULL DEFAULT '',
+		file_path  TEXT    NOT NULL,
+		mime_type  TEXT    NOT NULL DEFAULT '',
+		size       INTEGER NOT NULL DEFAULT 0,
+		width      INTEGER NOT NULL DEFAULT 0,
+		height     INTEGER NOT NULL DEFAULT 0,
+		favorite   INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL,
+		deleted_at INTEGER
+	);
+	CREATE INDEX idx_photos_created_at ON photos (created_at);
+
+	CREATE TABLE anime (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		title       TEXT    NOT NULL,
+		type        TEXT    NOT NULL DEFAULT 'anime' CHECK (type IN ('anime', 'hentai')),
+		description TEXT    NOT NULL DEFAULT '',
+		cover_path  TEXT    NOT NULL DEFAULT '',
+		status      TEXT    NOT NULL DEFAULT '',
+		view_count  INTEGER NOT NULL DEFAULT 0,
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL,
+		deleted_at  INTEGER
+	);
+	CREATE INDEX idx_anime_created_at ON anime (created_at);
+
+	CREATE TABLE manga (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		title       TEXT    NOT NULL,
+		type        TEXT    NOT NULL DEFAULT 'manga' CHECK (type IN ('manga', 'doujin')),
+		description TEXT    NOT NULL DEFAULT '',
+		cover_path  TEXT    NOT NULL DEFAULT '',
+		read_count  INTEGER NOT NULL DEFAULT 0,
+		created_at  INTEGER NOT NULL,
+		updated_at  INTEGER NOT NULL,
+		deleted_at  INTEGER
+	);
+	CREATE INDEX idx_manga_created_at ON manga (created_at);
+	`,
+	// 2: capture metadata of photos
+	`
+	ALTER TABLE photos ADD COLUMN duration     REAL    NOT NULL DEFAULT 0;
+	ALTER TABLE photos ADD COLUMN taken_at     INTEGER;
+	ALTER TABLE photos ADD COLUMN camera_make  TEXT    NOT NULL DEFAULT '';
+	ALTER TABLE photos ADD COLUMN camera_model TEXT    NOT NULL DEFAULT '';
+	ALTER TABLE photos ADD COLUMN lens_model   TEXT    NOT NULL DEFAULT '';
+	ALTER TABLE photos ADD COLUMN latitude     REAL;
+	ALTER TABLE photos ADD COLUMN longitude    REAL;
+	ALTER TABLE photos ADD COLUMN orientation  INTEGER NOT NULL DEFAULT 1 CHECK (orientation BETWEEN 1 AND 8);
+	CREATE INDEX idx_photos_taken_at ON photos (COALESCE(taken_at, created_at));
+	`,
+	// 3: content and perceptual hashes of photos for duplicate detection
+	`
+	ALTER TABLE photos ADD COLUMN sha256 TEXT NOT NULL DEFAULT '';
+	ALTER TABLE photos ADD COLUMN dhash  INTEGER;
+	CREATE INDEX idx_photos_sha256 ON photos (sha256);
+	`,
+	// 4: anime episodes and resumable uploads
+	`
+	CREATE TABLE anime_episodes (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		anime_id   INTEGER NOT NULL REFERENCES anime (id) ON DELETE CASCADE,
+		number     INTEGER NOT NULL CHECK (number > 0),
+		title      TEXT    NOT NULL DEFAULT '',
+		file_path  TEXT    NOT NULL,
+		mime_type  TEXT    NOT NULL DEFAULT '',
+		size       INTEGER NOT NULL DEFAULT 0,
+		duration   REAL    NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		UNIQUE (anime_id, number)
+	);
+
+	CREATE TABLE uploads (
+		id            TEXT    PRIMARY KEY,
+		kind          TEXT    NOT NULL CHECK (kind IN ('photo', 'anime')),
+		filename      TEXT    NOT NULL DEFAULT '',
+		metadata      TEXT    NOT NULL DEFAULT '{}',
+		upload_length INTEGER NOT NULL,
+		upload_offset INTEGER NOT NULL DEFAULT 0,
+		item_id       INTEGER,
+		created_at    INTEGER NOT NULL,
+		updated_at    INTEGER NOT NULL,
+		expires_at    INTEGER NOT NULL
+	);
+	CREATE INDEX idx_uploads_expires_at ON uploads (expires_at);
+	`,
+	// 5: manga chapters and files indexed in place from library roots
+	`
+	CREATE TABLE manga_chapters (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		manga_id   INTEGER NOT NULL REFERENCES manga (id) ON DELETE CASCADE,
+		volume     INTEGER NOT NULL DEFAULT 0 CHECK (volume >= 0),
+		chapter    REAL    NOT NULL DEFAULT 0 CHECK (chapter >= 0),
+		title      TEXT    NOT NULL DEFAULT '',
+		file_path  TEXT    NOT NULL,
+		mime_type  TEXT    NOT NULL DEFAULT '',
+		size       INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		UNIQUE (manga_id, volume, chapter),
+		CHECK (volume > 0 OR chapter > 0)
+	);
+
+	CREATE INDEX idx_anime_title ON anime (title COLLATE NOCASE);
+	CREATE INDEX idx_manga_title ON manga (title COLLATE NOCASE);
+
+	CREATE TABLE library_files (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		root       TEXT    NOT NULL,
+		path       TEXT    NOT NULL UNIQUE,
+		kind       TEXT    NOT NULL CHECK (kind IN ('photo', 'anime', 'manga')),
+		item_id    INTEGER NOT NULL,
+		size       INTEGER NOT NULL,
+		mtime      INTEGER NOT NULL,
+		indexed_at INTEGER NOT NULL
+	);
+	CREATE INDEX idx_library_files_root ON library_files (root);
+	CREATE INDEX idx_library_files_item ON library_files (kind, item_id);
+	`,
+	// 6: identity of library files for rename detection, offline marking
+	`
+	ALTER TABLE library_files ADD COLUMN device     INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE library_files ADD COLUMN inode      INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE library_files ADD COLUMN quick_hash TEXT    NOT NULL DEFAULT '';
+	ALTER TABLE library_files ADD COLUMN offline_at INTEGER;
+	CREATE INDEX idx_library_files_offline_at ON library_files (offline_at) WHERE offline_at IS NOT NULL;
+	`,
+	// 7: photo albums, hand-picked or defined by a filter
+	`
+	CREATE TABLE albums (
+		id             INTEGER PRIMARY KEY AUTOINCREMENT,
+		title          TEXT    NOT NULL,
+		description    TEXT    NOT NULL DEFAULT '',
+		smart          INTEGER NOT NULL DEFAULT 0,
+		filter         TEXT    NOT NULL DEFAULT '',
+		cover_photo_id INTEGER REFERENCES photos (id) ON DELETE SET NULL,
+		created_at     INTEGER NOT NULL,
+		updated_at     INTEGER NOT NULL,
+		CHECK (smart OR filter = '')
+	);
+
+	CREATE TABLE album_photos (
+		album_id INTEGER NOT NULL REFERENCES albums (id) ON DELETE CASCADE,
+		photo_id INTEGER NOT NULL REFERENCES photos (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		added_at INTEGER NOT NULL,
+		PRIMARY KEY (album_id, photo_id)
+	);
+	CREATE INDEX idx_album_photos_position ON album_photos (album_id, position);
+	CREATE INDEX idx_album_photos_photo ON album_photos (photo_id);
+	`,
+	// 8: tags shared by every library, with aliases and implications
+	`
+	CREATE TABLE tags (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		namespace  TEXT    NOT NULL DEFAULT '',
+		name       TEXT    NOT NULL,
+		alias_of   INTEGER REFERENCES tags (id) ON DELETE CASCADE,
+		created_at INTEGER NOT NULL,
+		UNIQUE (namespace, name)
+	);
+	CREATE INDEX idx_tags_name ON tags (name);
+	CREATE INDEX idx_tags_alias_of ON tags (alias_of) WHERE alias_of IS NOT NULL;
+
+	CREATE TABLE tag_implications (
+		tag_id     INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+		implied_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+		PRIMARY KEY (tag_id, implied_id),
+		CHECK (tag_id <> implied_id)
+	);
+	CREATE INDEX idx_tag_implications_implied ON tag_implications (implied_id);
+
+	CREATE TABLE item_tags (
+		kind    TEXT    NOT NULL CHECK (kind IN ('photo', 'anime', 'manga')),
+		item_id INTEGER NOT NULL,
+		tag_id  INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+		PRIMARY KEY (kind, item_id, tag_id)
+	);
+	CREATE INDEX idx_item_tags_tag ON item_tags (tag_id, kind);
+	`,
+	// 9: full-text search over every library
+	//
+	// One document per item, with rowid = id * 4 + 1 for photos, 2 for anime
+	// and 3 for manga. The trigram tokenizer matches any substring of three or
+	// more characters, so Japanese and Chinese titles work without word
+	// breaking. The views build the documents; triggers rebuild an item's
+	// document whenever something it is made of changes.
+	`
+	ALTER TABLE anime ADD COLUMN alt_titles TEXT NOT NULL DEFAULT '';
+	ALTER TABLE manga ADD COLUMN alt_titles TEXT NOT NULL DEFAULT '';
+
+	CREATE VIRTUAL TABLE search_index USING fts5 (
+		title, alt_titles, description, tags, filenames,
+		tokenize = 'trigram remove_diacritics 1'
+	);
+
+	CREATE VIEW search_photo_documents (id, title, alt_titles, description, tags, filenames) AS
+	SELECT p.id, p.title, '', p.caption,
+		(SELECT group_concat(replace(CASE t.namespace WHEN '' THEN t.name ELSE t.namespace || ':' || t.name END, '_', ' '), ' ')
+			FROM item_tags i JOIN tags t ON t.id = i.tag_id OR t.alias_of = i.tag_id
+			WHERE i.kind = 'photo' AND i.item_id = p.id),
+		replace(p.file_path, rtrim(p.file_path, replace(p.file_path, '/', '')), '')
+	FROM photos p;
+
+	CREATE VIEW search_anime_documents (id, title, alt_titles, description, tags, filenames) AS
+	SELECT a.id, a.title, a.alt_titles, a.description,
+		(SELECT group_concat(replace(CASE t.namespace WHEN '' THEN t.name ELSE t.namespace || ':' || t.name END, '_', ' '), ' ')
+			FROM item_tags i JOIN tags t ON t.id = i.tag_id OR t.alias_of = i.tag_id
+			WHERE i.kind = 'anime' AND i.item_id = a.id),
+		(SELECT group_concat(replace(e.file_path, rtrim(e.file_path, replace(e.file_path, '/', '')), ''), ' ')
+			FROM anime_episodes e WHERE e.anime_id = a.id)
+	FROM anime a;
+
+	CREATE VIEW search_manga_documents (id, title, alt_titles, description, tags, filenames) AS
+	SELECT m.id, m.title, m.alt_titles, m.description,
+		(SELECT group_concat(replace(CASE t.namespace WHEN '' THEN t.name ELSE t.namespace || ':' || t.name END, '_', ' '), ' ')
+			FROM item_tags i JOIN tags t ON t.id = i.tag_id OR t.alias_of = i.tag_id
+			WHERE i.kind = 'manga' AND i.item_id = m.id),
+		(SELECT group_concat(replace(c.file_path, rtrim(c.file_path, replace(c.file_path, '/', '')), ''), ' ')
+			FROM manga_chapters c WHERE c.manga_id = m.id)
+	FROM manga m;
+
+	INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+	SELECT id * 4 + 1, title, alt_titles, description, tags, filenames FROM search_photo_documents;
+	INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+	SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents;
+	INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+	SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents;
+
+	CREATE TRIGGER search_photos_insert AFTER INSERT ON photos BEGIN
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 1, title, alt_titles, description, tags, filenames FROM search_photo_documents WHERE id = NEW.id;
+	END;
+	CREATE TRIGGER search_photos_update AFTER UPDATE OF title, caption, file_path ON photos BEGIN
+		DELETE FROM search_index WHERE rowid = NEW.id * 4 + 1;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 1, title, alt_titles, description, tags, filenames FROM search_photo_documents WHERE id = NEW.id;
+	END;
+	CREATE TRIGGER search_photos_delete AFTER DELETE ON photos BEGIN
+		DELETE FROM search_index WHERE rowid = OLD.id * 4 + 1;
+	END;
+
+	CREATE TRIGGER search_anime_insert AFTER INSERT ON anime BEGIN
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents WHERE id = NEW.id;
+	END;
+	CREATE TRIGGER search_anime_update AFTER UPDATE OF title, alt_titles, description ON anime BEGIN
+		DELETE FROM search_index WHERE rowid = NEW.id * 4 + 2;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents WHERE id = NEW.id;
+	END;
+	CREATE TRIGGER search_anime_delete AFTER DELETE ON anime BEGIN
+		DELETE FROM search_index WHERE rowid = OLD.id * 4 + 2;
+	END;
+
+	CREATE TRIGGER search_manga_insert AFTER INSERT ON manga BEGIN
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents WHERE id = NEW.id;
+	END;
+	CREATE TRIGGER search_manga_update AFTER UPDATE OF title, alt_titles, description ON manga BEGIN
+		DELETE FROM search_index WHERE rowid = NEW.id * 4 + 3;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents WHERE id = NEW.id;
+	END;
+	CREATE TRIGGER search_manga_delete AFTER DELETE ON manga BEGIN
+		DELETE FROM search_index WHERE rowid = OLD.id * 4 + 3;
+	END;
+
+	-- Episodes and chapters contribute their file names
+	CREATE TRIGGER search_episodes_insert AFTER INSERT ON anime_episodes BEGIN
+		DELETE FROM search_index WHERE rowid = NEW.anime_id * 4 + 2;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents WHERE id = NEW.anime_id;
+	END;
+	CREATE TRIGGER search_episodes_update AFTER UPDATE OF file_path ON anime_episodes BEGIN
+		DELETE FROM search_index WHERE rowid = NEW.anime_id * 4 + 2;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents WHERE id = NEW.anime_id;
+	END;
+	CREATE TRIGGER search_episodes_delete AFTER DELETE ON anime_episodes BEGIN
+		DELETE FROM search_index WHERE rowid = OLD.anime_id * 4 + 2;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents WHERE id = OLD.anime_id;
+	END;
+
+	CREATE TRIGGER search_chapters_insert AFTER INSERT ON manga_chapters BEGIN
+		DELETE FROM search_index WHERE rowid = NEW.manga_id * 4 + 3;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents WHERE id = NEW.manga_id;
+	END;
+	CREATE TRIGGER search_chapters_update AFTER UPDATE OF file_path ON manga_chapters BEGIN
+		DELETE FROM search_index WHERE rowid = NEW.manga_id * 4 + 3;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents WHERE id = NEW.manga_id;
+	END;
+	CREATE TRIGGER search_chapters_delete AFTER DELETE ON manga_chapters BEGIN
+		DELETE FROM search_index WHERE rowid = OLD.manga_id * 4 + 3;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents WHERE id = OLD.manga_id;
+	END;
+
+	-- Tagging an item, or renaming what a tag's aliases point at, changes the
+	-- tags of documents. Only one of the inserts matches the item's kind.
+	CREATE TRIGGER search_item_tags_insert AFTER INSERT ON item_tags BEGIN
+		DELETE FROM search_index WHERE rowid = NEW.item_id * 4 + CASE NEW.kind WHEN 'photo' THEN 1 WHEN 'anime' THEN 2 ELSE 3 END;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 1, title, alt_titles, description, tags, filenames FROM search_photo_documents WHERE id = NEW.item_id AND NEW.kind = 'photo';
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents WHERE id = NEW.item_id AND NEW.kind = 'anime';
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents WHERE id = NEW.item_id AND NEW.kind = 'manga';
+	END;
+	CREATE TRIGGER search_item_tags_delete AFTER DELETE ON item_tags BEGIN
+		DELETE FROM search_index WHERE rowid = OLD.item_id * 4 + CASE OLD.kind WHEN 'photo' THEN 1 WHEN 'anime' THEN 2 ELSE 3 END;
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 1, title, alt_titles, description, tags, filenames FROM search_photo_documents WHERE id = OLD.item_id AND OLD.kind = 'photo';
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents WHERE id = OLD.item_id AND OLD.kind = 'anime';
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents WHERE id = OLD.item_id AND OLD.kind = 'manga';
+	END;
+	CREATE TRIGGER search_tags_alias AFTER UPDATE OF alias_of ON tags BEGIN
+		DELETE FROM search_index WHERE rowid IN (
+			SELECT item_id * 4 + CASE kind WHEN 'photo' THEN 1 WHEN 'anime' THEN 2 ELSE 3 END
+			FROM item_tags WHERE tag_id IN (OLD.alias_of, NEW.alias_of));
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 1, title, alt_titles, description, tags, filenames FROM search_photo_documents
+		WHERE id IN (SELECT item_id FROM item_tags WHERE kind = 'photo' AND tag_id IN (OLD.alias_of, NEW.alias_of));
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents
+		WHERE id IN (SELECT item_id FROM item_tags WHERE kind = 'anime' AND tag_id IN (OLD.alias_of, NEW.alias_of));
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents
+		WHERE id IN (SELECT item_id FROM item_tags WHERE kind = 'manga' AND tag_id IN (OLD.alias_of, NEW.alias_of));
+	END;
+	CREATE TRIGGER search_tags_delete AFTER DELETE ON tags WHEN OLD.alias_of IS NOT NULL BEGIN
+		DELETE FROM search_index WHERE rowid IN (
+			SELECT item_id * 4 + CASE kind WHEN 'photo' THEN 1 WHEN 'anime' THEN 2 ELSE 3 END
+			FROM item_tags WHERE tag_id = OLD.alias_of);
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 1, title, alt_titles, description, tags, filenames FROM search_photo_documents
+		WHERE id IN (SELECT item_id FROM item_tags WHERE kind = 'photo' AND tag_id = OLD.alias_of);
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 2, title, alt_titles, description, tags, filenames FROM search_anime_documents
+		WHERE id IN (SELECT item_id FROM item_tags WHERE kind = 'anime' AND tag_id = OLD.alias_of);
+		INSERT INTO search_index (rowid, title, alt_titles, description, tags, filenames)
+		SELECT id * 4 + 3, title, alt_titles, description, tags, filenames FROM search_manga_documents
+		WHERE id IN (SELECT item_id FROM item_tags WHERE kind = 'manga' AND tag_id = OLD.alias_of);
+	END;
+	`,
+	// 10: file paths, so a purge can tell whether a file is still in use
+	`
+	CREATE INDEX idx_photos_file_path ON photos (file_path);
+	CREATE INDEX idx_anime_episodes_file_path ON anime_episodes (file_path);
+	CREATE INDEX idx_manga_chapters_file_path ON manga_chapters (file_path);
+	CREATE INDEX idx_anime_cover_path ON anime (cover_path) WHERE cover_path != '';
+	CREATE INDEX idx_manga_cover_path ON manga (cover_path) WHERE cover_path != '';
+	`,
+	// 11: one row per file of the photo store, which is keyed by content
+	`
+	ALTER TABLE photos ADD COLUMN stored INTEGER NOT NULL DEFAULT 0;
+
+	-- Stored files live at <sha256[:2]>/<sha256><ext>; should a file already
+	-- have several rows, the oldest one owns it
+	UPDATE photos SET stored = 1 WHERE id IN (
+		SELECT MIN(id) FROM photos
+		WHERE sha256 != '' AND instr(file_path, '/' || substr(sha256, 1, 2) || '/' || sha256) > 0
+		GROUP BY sha256);
+	CREATE UNIQUE INDEX idx_photos_stored_sha256 ON photos (sha256) WHERE stored = 1;
+	`,
+	// 12: why the last ingestion of an upload failed
+	`
+	ALTER TABLE uploads ADD COLUMN error TEXT NOT NULL DEFAULT '';
+	`,
+}
+
+// migrate applies every migration newer than the database's user_version,
+// each inside its own transaction.
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version;`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", i+1, err)
+		}
+
+		// PRAGMA doesn't accept bound parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d;`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %d: %w", i+1, err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
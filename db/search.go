@@ -0,0 +1,235 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// INFO: Documents of the search index are keyed by `id * 4 + kind`, see
+// migration 9.
+var searchKinds = map[string]int64{
+	types.MediaPhoto: 1,
+	types.MediaAnime: 2,
+	types.MediaManga: 3,
+}
+
+func searchKind(rowid int64) string {
+	for kind, code := range searchKinds {
+		if rowid%4 == code {
+			return kind
+		}
+	}
+	return ""
+}
+
+// Shortest term the trigram tokenizer can look up; shorter ones, such as
+// two-character Japanese words, are matched with LIKE instead
+const minIndexedTerm = 3
+
+// INFO: Matches are wrapped in these before the text is HTML escaped, then
+// turned into <mark> tags.
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// splitTitles and joinTitles convert alternate titles to and from their
+// column, one title per line.
+func splitTitles(column string) []string {
+	if len(column) == 0 {
+		return []string{}
+	}
+	return strings.Split(column, "\n")
+}
+
+func joinTitles(titles []string) string {
+	return strings.Join(titles, "\n")
+}
+
+// renderMarks HTML escapes text and turns the match delimiters into <mark>
+// tags.
+func renderMarks(text string) string {
+	return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(html.EscapeString(text))
+}
+
+// markTerms delimits every case-insensitive occurrence of terms in text.
+func markTerms(text string, terms []string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		matched := ""
+		for _, term := range terms {
+			if end := i + len(term); end <= len(text) && strings.EqualFold(text[i:end], term) {
+				matched = text[i:end]
+				break
+			}
+		}
+
+		if len(matched) != 0 {
+			b.WriteString(markStart + matched + markEnd)
+			i += len(matched)
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		b.WriteString(text[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+// excerpt returns the part of text around the first of terms it contains, or
+// an empty string.
+func excerpt(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	for _, term := range terms {
+		at := strings.Index(lower, strings.ToLower(term))
+		if at < 0 || len(lower) != len(text) {
+			continue
+		}
+
+		start, end := at, at+len(term)
+		for n := 0; n < 24 && start > 0; n++ {
+			_, size := utf8.DecodeLastRuneInString(text[:start])
+			start -= size
+		}
+		for n := 0; n < 24 && end < len(text); n++ {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			end += size
+		}
+
+		snippet := markTerms(text[start:end], terms)
+		if start > 0 {
+			snippet = "…" + snippet
+		}
+		if end < len(text) {
+			snippet += "…"
+		}
+		return snippet
+	}
+	return ""
+}
+
+// Whether the item behind a document is live
+const liveDocument = `CASE search_index.rowid % 4
+	WHEN 1 THEN EXISTS (SELECT 1 FROM photos WHERE id = search_index.rowid / 4 AND deleted_at IS NULL)
+	WHEN 2 THEN EXISTS (SELECT 1 FROM anime WHERE id = search_index.rowid / 4 AND deleted_at IS NULL)
+	ELSE EXISTS (SELECT 1 FROM manga WHERE id = search_index.rowid / 4 AND deleted_at IS NULL)
+END`
+
+// Search finds live photos, anime and manga whose titles, alternate titles,
+// descriptions, captions, tags or file names contain every word of text. It
+// returns one page of hits for kind, or every kind when it is empty, best
+// first, and the number of hits of each kind.
+func Search(ctx context.Context, text string, kind string, q types.ListQuery) ([]types.SearchResult, map[string]int, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	var phrases, short []string
+	for _, term := range strings.Fields(text) {
+		if utf8.RuneCountInString(term) >= minIndexedTerm {
+			phrases = append(phrases, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+		} else {
+			short = append(short, term)
+		}
+	}
+
+	var f listFilter
+	if len(phrases) != 0 {
+		f.add(`search_index MATCH ?`, strings.Join(phrases, " "))
+	}
+	for _, term := range short {
+		f.add(`concat_ws(' ', title, alt_titles, description, tags, filenames) LIKE ? ESCAPE '\'`, "%"+escapeLike(term)+"%")
+	}
+	f.add(liveDocument)
+
+	facets := map[string]int{types.MediaPhoto: 0, types.MediaAnime: 0, types.MediaManga: 0}
+	rows, err := Reader.QueryContext(ctx, `SELECT rowid % 4, COUNT(*) FROM search_index`+f.where()+` GROUP BY 1`, f.args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	total := 0
+	for rows.Next() {
+		var code int64
+		var count int
+		if err := rows.Scan(&code, &count); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		facets[searchKind(code)] = count
+		if len(kind) == 0 || searchKind(code) == kind {
+			total += count
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if total == 0 || q.Offset() >= total {
+		return nil, facets, nil
+	}
+
+	if len(kind) != 0 {
+		f.add(`rowid % 4 = ?`, searchKinds[kind])
+	}
+
+	// Ranking and highlighting need a full-text match; short terms alone fall
+	// back to titles matching first
+	columns := `rowid, title, alt_titles, description, tags, filenames, '', '', 0`
+	orderBy := `title LIKE ? ESCAPE '\' DESC, rowid DESC`
+	args := f.args
+	if len(phrases) != 0 {
+		columns = `rowid, title, alt_titles, description, tags, filenames,
+			highlight(search_index, 0, '` + markStart + `', '` + markEnd + `'),
+			snippet(search_index, -1, '` + markStart + `', '` + markEnd + `', '…', 24),
+			bm25(search_index, 10.0, 8.0, 2.0, 4.0, 1.0)`
+		orderBy = `9, rowid DESC`
+	} else {
+		args = append(append([]any{}, args...), "%"+escapeLike(short[0])+"%")
+	}
+	args = append(args, q.Limit, q.Offset())
+
+	rows, err = Reader.QueryContext(ctx, `SELECT `+columns+` FROM search_index`+f.where()+` ORDER BY `+orderBy+` LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var results []types.SearchResult
+	for rows.Next() {
+		var (
+			rowid                                                   int64
+			title, altTitles, description, tags, filenames, snippet *string
+			highlight                                               string
+			r                                                       types.SearchResult
+		)
+		if err := rows.Scan(&rowid, &title, &altTitles, &description, &tags, &filenames, &highlight, &snippet, &r.Score); err != nil {
+			return nil, nil, err
+		}
+
+		r.Kind, r.ID = searchKind(rowid), rowid/4
+		if title != nil {
+			r.Title = *title
+		}
+		if len(phrases) == 0 {
+			highlight = markTerms(r.Title, short)
+			for _, column := range []*string{title, altTitles, description, tags, filenames} {
+				if column == nil || len(*column) == 0 {
+					continue
+				}
+				if s := excerpt(*column, short); len(s) != 0 {
+					snippet = &s
+					break
+				}
+			}
+		}
+
+		r.Highlight = renderMarks(highlight)
+		if snippet != nil {
+			r.Snippet = renderMarks(*snippet)
+		}
+		results = append(results, r)
+	}
+	return results, facets, rows.Err()
+}
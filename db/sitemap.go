@@ -0,0 +1,53 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"fmt"
+	"time"
+)
+
+// INFO: Public library items listed in sitemap.xml. NSFW entries (hentai,
+// doujin) are never advertised, whatever the configuration says.
+var sitemapQueries = map[string]string{
+	types.MediaPhoto: `SELECT id, updated_at FROM photos WHERE deleted_at IS NULL ORDER BY id`,
+	types.MediaAnime: `SELECT id, updated_at FROM anime WHERE deleted_at IS NULL AND type = 'anime' ORDER BY id`,
+	types.MediaManga: `SELECT id, updated_at FROM manga WHERE deleted_at IS NULL AND type = 'manga' ORDER BY id`,
+}
+
+// ItemStamp is the ID and last modification time of a library item.
+type ItemStamp struct {
+	ID        int64
+	UpdatedAt time.Time
+}
+
+// ItemStamps lists every live item of a library, oldest ID first.
+func ItemStamps(ctx context.Context, kind string) ([]ItemStamp, error) {
+	query, ok := sitemapQueries[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown media kind %q", kind)
+	}
+
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	rows, err := Reader.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stamps []ItemStamp
+	for rows.Next() {
+		var (
+			stamp   ItemStamp
+			updated int64
+		)
+		if err := rows.Scan(&stamp.ID, &updated); err != nil {
+			return nil, err
+		}
+		stamp.UpdatedAt = fromUnix(updated)
+		stamps = append(stamps, stamp)
+	}
+	return stamps, rows.Err()
+}
@@ -0,0 +1,476 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// INFO: Implied tags are stored like any other: tagging an item also tags it
+// with everything the tag implies, and a new implication is applied to the
+// items that already carry the tag. Removing either later leaves the items
+// as they are.
+
+// Longest tag name, in characters
+const maxTagName = 100
+
+// ParseTag reads a tag written as `namespace:name` or just `name`. Names are
+// lowercased and their spaces become underscores, so `Slice of Life` and
+// `slice_of_life` are the same tag. A prefix that isn't one of
+// types.TagNamespaces is part of the name.
+func ParseTag(raw string) (types.Tag, error) {
+	normalized := strings.Join(strings.Fields(strings.ToLower(raw)), "_")
+
+	var tag types.Tag
+	if namespace, name, ok := strings.Cut(normalized, ":"); ok && slices.Contains(types.TagNamespaces, namespace) {
+		tag.Namespace, tag.Name = namespace, name
+	} else {
+		tag.Name = normalized
+	}
+
+	if len(tag.Name) == 0 {
+		return tag, fmt.Errorf("tag %q has no name", raw)
+	}
+	if strings.ContainsAny(tag.Name, ",+") {
+		return tag, fmt.Errorf("tag %q must not contain commas or plus signs", raw)
+	}
+	if utf8.RuneCountInString(tag.Name) > maxTagName {
+		return tag, fmt.Errorf("tag %q is longer than %d characters", raw, maxTagName)
+	}
+
+	tag.Tag = tagText(tag.Namespace, tag.Name)
+	return tag, nil
+}
+
+func tagText(namespace string, name string) string {
+	if len(namespace) == 0 {
+		return name
+	}
+	return namespace + ":" + name
+}
+
+// Aliases count the items of the tag they stand for
+const tagColumns = `t.id, t.namespace, t.name, t.alias_of, t.created_at,
+	(SELECT COUNT(*) FROM item_tags WHERE tag_id = COALESCE(t.alias_of, t.id))`
+
+func scanTag(row rowScanner) (*types.Tag, error) {
+	var (
+		t       types.Tag
+		aliasOf sql.NullInt64
+		created int64
+	)
+
+	if err := row.Scan(&t.ID, &t.Namespace, &t.Name, &aliasOf, &created, &t.Count); err != nil {
+		return nil, err
+	}
+
+	if aliasOf.Valid {
+		t.AliasOf = &aliasOf.Int64
+	}
+	t.Tag = tagText(t.Namespace, t.Name)
+	t.CreatedAt = fromUnix(created)
+	return &t, nil
+}
+
+func queryTags(ctx context.Context, query string, args ...any) ([]types.Tag, error) {
+	rows, err := Reader.QueryContext(ctx, `SELECT `+tagColumns+` FROM tags t `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []types.Tag{}
+	for rows.Next() {
+		t, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, *t)
+	}
+	return tags, rows.Err()
+}
+
+// GetTag returns a tag with its aliases and implications. It fails with
+// ErrNotFound for unknown IDs.
+func GetTag(ctx context.Context, id int64) (*types.TagDetails, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	t, err := scanTag(Reader.QueryRowContext(ctx, `SELECT `+tagColumns+` FROM tags t WHERE t.id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	details := &types.TagDetails{Tag: *t}
+	if details.Aliases, err = queryTags(ctx, `WHERE t.alias_of = ? ORDER BY t.namespace, t.name`, id); err != nil {
+		return nil, err
+	}
+	if details.Implies, err = queryTags(ctx, `JOIN tag_implications i ON i.implied_id = t.id WHERE i.tag_id = ? ORDER BY t.namespace, t.name`, id); err != nil {
+		return nil, err
+	}
+	if details.ImpliedBy, err = queryTags(ctx, `JOIN tag_implications i ON i.tag_id = t.id WHERE i.implied_id = ? ORDER BY t.namespace, t.name`, id); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// SearchTags returns the tags whose name, or `namespace:name`, starts with
+// prefix, most used first. Aliases are included; an empty prefix lists the
+// most used tags.
+func SearchTags(ctx context.Context, prefix string, limit int) ([]types.Tag, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	prefix = strings.Join(strings.Fields(strings.ToLower(prefix)), "_")
+	like := escapeLike(prefix) + "%"
+
+	return queryTags(ctx, `
+		WHERE t.name LIKE ? ESCAPE '\' OR (t.namespace || ':' || t.name) LIKE ? ESCAPE '\'
+		ORDER BY 6 DESC, t.name, t.namespace
+		LIMIT ?`, like, like, limit)
+}
+
+// findTag returns the ID of a tag, or zero when there is no such tag.
+func findTag(ctx context.Context, tx *sql.Tx, tag types.Tag) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE namespace = ? AND name = ?`, tag.Namespace, tag.Name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+// canonicalTag returns the tag an alias stands for, or the tag itself. It
+// fails with ErrNotFound for unknown IDs.
+func canonicalTag(ctx context.Context, tx *sql.Tx, id int64) (int64, error) {
+	var canonical int64
+	err := tx.QueryRowContext(ctx, `SELECT COALESCE(alias_of, id) FROM tags WHERE id = ?`, id).Scan(&canonical)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return canonical, err
+}
+
+func insertTag(ctx context.Context, tx *sql.Tx, tag *types.Tag, now time.Time) error {
+	res, err := tx.ExecContext(ctx, `INSERT INTO tags (namespace, name, created_at) VALUES (?, ?, ?)`, tag.Namespace, tag.Name, toUnix(now))
+	if err != nil {
+		return err
+	}
+
+	tag.ID, err = res.LastInsertId()
+	tag.CreatedAt = now
+	return err
+}
+
+// resolveTags returns the IDs of tags, creating the missing ones and
+// resolving aliases.
+func resolveTags(ctx context.Context, tx *sql.Tx, tags []types.Tag) ([]int64, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var ids []int64
+	for _, tag := range tags {
+		id, err := findTag(ctx, tx, tag)
+		if err != nil {
+			return nil, err
+		}
+
+		if id == 0 {
+			if err := insertTag(ctx, tx, &tag, now); err != nil {
+				return nil, err
+			}
+			id = tag.ID
+		} else if id, err = canonicalTag(ctx, tx, id); err != nil {
+			return nil, err
+		}
+
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// withImplied returns tag IDs together with every tag they imply.
+func withImplied(ctx context.Context, tx *sql.Tx, ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return queryIDs(ctx, tx, `
+		WITH RECURSIVE implied (id) AS (
+			SELECT id FROM tags WHERE id IN (`+placeholders(len(ids))+`)
+			UNION
+			SELECT i.implied_id FROM tag_implications i JOIN implied ON i.tag_id = implied.id
+		)
+		SELECT id FROM implied`, idArgs(nil, ids)...)
+}
+
+// applyImplied tags the items carrying a tag with everything it implies.
+func applyImplied(ctx context.Context, tx *sql.Tx, id int64) error {
+	implied, err := withImplied(ctx, tx, []int64{id})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT OR IGNORE INTO item_tags (kind, item_id, tag_id)
+		SELECT i.kind, i.item_id, t.id FROM item_tags i, tags t
+		WHERE i.tag_id = ? AND t.id IN (`+placeholders(len(implied))+`)`, idArgs([]any{id}, implied)...)
+	return err
+}
+
+// CreateTag inserts a new tag and sets its ID. It fails with ErrConflict when
+// the tag, or an alias of that name, already exists.
+func CreateTag(ctx context.Context, tag *types.Tag) error {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		id, err := findTag(ctx, tx, *tag)
+		if err != nil {
+			return err
+		}
+		if id != 0 {
+			return ErrConflict
+		}
+		return insertTag(ctx, tx, tag, now)
+	})
+}
+
+// DeleteTag removes a tag, its aliases and its implications, and untags every
+// item carrying it. It fails with ErrNotFound for unknown IDs.
+func DeleteTag(ctx context.Context, id int64) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// AliasTag makes alias stand for the tag with the given ID, or for the tag
+// that one is an alias of, and returns the alias. An existing tag of that name
+// is merged: its items, implications and aliases move over. It fails with
+// ErrNotFound for unknown IDs and ErrConflict when alias is the tag itself.
+func AliasTag(ctx context.Context, id int64, alias types.Tag) (*types.Tag, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		target, err := canonicalTag(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		existing, err := findTag(ctx, tx, alias)
+		if err != nil {
+			return err
+		}
+		if existing == target {
+			return ErrConflict
+		}
+
+		if existing == 0 {
+			if err := insertTag(ctx, tx, &alias, now); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `UPDATE tags SET alias_of = ? WHERE id = ?`, target, alias.ID)
+			return err
+		}
+
+		alias.ID = existing
+		for _, stmt := range []string{
+			`INSERT OR IGNORE INTO item_tags (kind, item_id, tag_id) SELECT kind, item_id, ?1 FROM item_tags WHERE tag_id = ?2`,
+			`DELETE FROM item_tags WHERE tag_id = ?2`,
+			`INSERT OR IGNORE INTO tag_implications (tag_id, implied_id) SELECT ?1, implied_id FROM tag_implications WHERE tag_id = ?2 AND implied_id <> ?1`,
+			`INSERT OR IGNORE INTO tag_implications (tag_id, implied_id) SELECT tag_id, ?1 FROM tag_implications WHERE implied_id = ?2 AND tag_id <> ?1`,
+			`DELETE FROM tag_implications WHERE tag_id = ?2 OR implied_id = ?2`,
+			`UPDATE tags SET alias_of = ?1 WHERE id = ?2 OR alias_of = ?2`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt, target, existing); err != nil {
+				return err
+			}
+		}
+		// The merged tag may have brought implications along
+		return applyImplied(ctx, tx, target)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+	return scanTag(Reader.QueryRowContext(ctx, `SELECT `+tagColumns+` FROM tags t WHERE t.id = ?`, alias.ID))
+}
+
+// AddImplication makes a tag imply another, creating the implied tag when
+// needed, and tags the items carrying the first with it. It fails with
+// ErrNotFound for unknown IDs and ErrConflict when the implied tag already
+// implies the first, directly or not.
+func AddImplication(ctx context.Context, id int64, implied types.Tag) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		tagID, err := canonicalTag(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		resolved, err := resolveTags(ctx, tx, []types.Tag{implied})
+		if err != nil {
+			return err
+		}
+
+		closure, err := withImplied(ctx, tx, resolved)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(closure, tagID) {
+			return ErrConflict
+		}
+
+		if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO tag_implications (tag_id, implied_id) VALUES (?, ?)`, tagID, resolved[0]); err != nil {
+			return err
+		}
+		return applyImplied(ctx, tx, tagID)
+	})
+}
+
+// RemoveImplication stops a tag from implying another. Items keep the tags
+// they already have. It fails with ErrNotFound when there is no such
+// implication.
+func RemoveImplication(ctx context.Context, id int64, impliedID int64) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `DELETE FROM tag_implications WHERE tag_id = ? AND implied_id = ?`, id, impliedID)
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// ItemTags returns the tags of an item, by namespace and name.
+func ItemTags(ctx context.Context, kind string, itemID int64) ([]types.Tag, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	return queryTags(ctx, `
+		JOIN item_tags i ON i.tag_id = t.id
+		WHERE i.kind = ? AND i.item_id = ?
+		ORDER BY t.namespace, t.name`, kind, itemID)
+}
+
+// liveItems returns the IDs of items of a kind that exist and aren't in the
+// trash.
+func liveItems(ctx context.Context, tx *sql.Tx, kind string, ids []int64) ([]int64, error) {
+	table, err := itemTable(kind)
+	if err != nil {
+		return nil, err
+	}
+	return queryIDs(ctx, tx, `SELECT id FROM `+table+` WHERE deleted_at IS NULL AND id IN (`+placeholders(len(ids))+`)`, idArgs(nil, ids)...)
+}
+
+func tagItems(ctx context.Context, tx *sql.Tx, kind string, itemIDs []int64, tagIDs []int64) error {
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO item_tags (kind, item_id, tag_id) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, itemID := range itemIDs {
+		for _, tagID := range tagIDs {
+			if _, err := stmt.ExecContext(ctx, kind, itemID, tagID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SetItemTags replaces the tags of an item, adding everything they imply.
+// Missing tags are created.
+func SetItemTags(ctx context.Context, kind string, itemID int64, tags []types.Tag) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		ids, err := resolveTags(ctx, tx, tags)
+		if err != nil {
+			return err
+		}
+		if ids, err = withImplied(ctx, tx, ids); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM item_tags WHERE kind = ? AND item_id = ?`, kind, itemID); err != nil {
+			return err
+		}
+		return tagItems(ctx, tx, kind, []int64{itemID}, ids)
+	})
+}
+
+// EditItemTags adds tags to and removes tags from many items of a kind at
+// once, and returns the IDs of the items that were edited; unknown and
+// deleted items are skipped. Added tags bring along what they imply and are
+// created when missing.
+func EditItemTags(ctx context.Context, kind string, itemIDs []int64, add []types.Tag, remove []types.Tag) ([]int64, error) {
+	var edited []int64
+	err := WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		if edited, err = liveItems(ctx, tx, kind, itemIDs); err != nil || len(edited) == 0 {
+			return err
+		}
+
+		// Removing a tag that doesn't exist is a no-op, so only look those up
+		var removeIDs []int64
+		for _, tag := range remove {
+			id, err := findTag(ctx, tx, tag)
+			if err != nil {
+				return err
+			}
+			if id == 0 {
+				continue
+			}
+			if id, err = canonicalTag(ctx, tx, id); err != nil {
+				return err
+			}
+			removeIDs = append(removeIDs, id)
+		}
+
+		if len(removeIDs) != 0 {
+			_, err := tx.ExecContext(ctx, `
+				DELETE FROM item_tags WHERE kind = ?
+					AND item_id IN (`+placeholders(len(edited))+`)
+					AND tag_id IN (`+placeholders(len(removeIDs))+`)`,
+				idArgs(idArgs([]any{kind}, edited), removeIDs)...)
+			if err != nil {
+				return err
+			}
+		}
+
+		addIDs, err := resolveTags(ctx, tx, add)
+		if err != nil {
+			return err
+		}
+		if addIDs, err = withImplied(ctx, tx, addIDs); err != nil {
+			return err
+		}
+		return tagItems(ctx, tx, kind, edited, addIDs)
+	})
+	return edited, err
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// INFO: Timestamps are stored as unix seconds (UTC) so they sort and compare
+// as plain integers inside SQLite.
+
+func toUnix(t time.Time) int64 {
+	return t.UTC().Unix()
+}
+
+func fromUnix(sec int64) time.Time {
+	return time.Unix(sec, 0).UTC()
+}
+
+func fromNullUnix(sec sql.NullInt64) *time.Time {
+	if !sec.Valid {
+		return nil
+	}
+	t := fromUnix(sec.Int64)
+	return &t
+}
+
+func toNullUnix(t *time.Time) sql.NullInt64 {
+	if t == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: toUnix(*t), Valid: true}
+}
+
+func fromNullFloat(f sql.NullFloat64) *float64 {
+	if !f.Valid {
+		return nil
+	}
+	return &f.Float64
+}
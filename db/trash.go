@@ -0,0 +1,295 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// INFO: Deleted photos, anime and manga keep their rows with `deleted_at` set
+// until they are purged, by hand or once the retention period is over.
+
+// trashTables maps the kinds of library items to their tables.
+var trashTables = map[string]string{
+	types.MediaPhoto: "photos",
+	types.MediaAnime: "anime",
+	types.MediaManga: "manga",
+}
+
+// trashedItems lists every item in the trash with its kind.
+const trashedItems = `
+	SELECT 'photo' AS kind, id, title, deleted_at FROM photos WHERE deleted_at IS NOT NULL
+	UNION ALL
+	SELECT 'anime' AS kind, id, title, deleted_at FROM anime WHERE deleted_at IS NOT NULL
+	UNION ALL
+	SELECT 'manga' AS kind, id, title, deleted_at FROM manga WHERE deleted_at IS NOT NULL`
+
+func itemTable(kind string) (string, error) {
+	table, ok := trashTables[kind]
+	if !ok {
+		return "", fmt.Errorf("unknown library kind %q", kind)
+	}
+	return table, nil
+}
+
+func idArgs(args []any, ids []int64) []any {
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return args
+}
+
+func placeholders(n int) string {
+	return "?" + strings.Repeat(", ?", n-1)
+}
+
+// numberedPlaceholders returns `?1, ?2, ...`, which lets a query use the same
+// list of IDs more than once.
+func numberedPlaceholders(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			b.WriteString(", ")
+		}
+		b.WriteString("?" + strconv.Itoa(i))
+	}
+	return b.String()
+}
+
+// ListTrash returns one page of the trash, most recently deleted first, and
+// the number of items in it. An empty kind lists every kind.
+func ListTrash(ctx context.Context, kind string, q types.ListQuery) ([]types.TrashItem, int, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	var total int
+	err := Reader.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+trashedItems+`) WHERE ? = '' OR kind = ?`, kind, kind).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := Reader.QueryContext(ctx, `
+		SELECT kind, id, title, deleted_at FROM (`+trashedItems+`)
+		WHERE ? = '' OR kind = ?
+		ORDER BY deleted_at DESC, kind, id DESC
+		LIMIT ? OFFSET ?`,
+		kind, kind, q.Limit, q.Offset())
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var items []types.TrashItem
+	for rows.Next() {
+		var (
+			item    types.TrashItem
+			deleted int64
+		)
+		if err := rows.Scan(&item.Kind, &item.ID, &item.Title, &deleted); err != nil {
+			return nil, 0, err
+		}
+		item.DeletedAt = fromUnix(deleted)
+		items = append(items, item)
+	}
+	return items, total, rows.Err()
+}
+
+// TrashedBefore returns the IDs of the items of each kind deleted before t.
+func TrashedBefore(ctx context.Context, t time.Time) (map[string][]int64, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	rows, err := Reader.QueryContext(ctx, `SELECT kind, id FROM (`+trashedItems+`) WHERE deleted_at < ? ORDER BY kind, id`, toUnix(t))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string][]int64)
+	for rows.Next() {
+		var (
+			kind string
+			id   int64
+		)
+		if err := rows.Scan(&kind, &id); err != nil {
+			return nil, err
+		}
+		ids[kind] = append(ids[kind], id)
+	}
+	return ids, rows.Err()
+}
+
+// queryIDs runs a query that returns IDs, such as UPDATE ... RETURNING id.
+func queryIDs(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SoftDeleteItems moves live items of a kind to the trash and returns the IDs
+// that were actually deleted; unknown and already deleted IDs are skipped.
+func SoftDeleteItems(ctx context.Context, kind string, ids []int64) ([]int64, error) {
+	table, err := itemTable(kind)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	now := toUnix(time.Now())
+	var deleted []int64
+	err = WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		deleted, err = queryIDs(ctx, tx, `
+			UPDATE `+table+` SET deleted_at = ?, updated_at = ?
+			WHERE deleted_at IS NULL AND id IN (`+placeholders(len(ids))+`)
+			RETURNING id`, idArgs([]any{now, now}, ids)...)
+		return err
+	})
+	return deleted, err
+}
+
+// RestoreItems takes items of a kind out of the trash and returns the IDs
+// that were restored; IDs that aren't in the trash are skipped.
+func RestoreItems(ctx context.Context, kind string, ids []int64) ([]int64, error) {
+	table, err := itemTable(kind)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	now := toUnix(time.Now())
+	var restored []int64
+	err = WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		restored, err = queryIDs(ctx, tx, `
+			UPDATE `+table+` SET deleted_at = NULL, updated_at = ?
+			WHERE deleted_at IS NOT NULL AND id IN (`+placeholders(len(ids))+`)
+			RETURNING id`, idArgs([]any{now}, ids)...)
+		return err
+	})
+	return restored, err
+}
+
+// purgeFiles lists the files that belong to items of a kind: the photo
+// itself, or the cover and every episode or chapter.
+var purgeFiles = map[string]string{
+	types.MediaPhoto: `SELECT file_path FROM photos WHERE id IN (%[1]s)`,
+	types.MediaAnime: `SELECT cover_path FROM anime WHERE id IN (%[1]s)
+		UNION ALL SELECT file_path FROM anime_episodes WHERE anime_id IN (%[1]s)`,
+	types.MediaManga: `SELECT cover_path FROM manga WHERE id IN (%[1]s)
+		UNION ALL SELECT file_path FROM manga_chapters WHERE manga_id IN (%[1]s)`,
+}
+
+// purgeLibraryFiles forgets the indexed files of items of a kind, so a scan
+// doesn't bring back what was purged.
+var purgeLibraryFiles = map[string]string{
+	types.MediaPhoto: `DELETE FROM library_files WHERE kind = 'photo' AND item_id IN (%[1]s)`,
+	types.MediaAnime: `DELETE FROM library_files WHERE kind = 'anime' AND item_id IN (SELECT id FROM anime_episodes WHERE anime_id IN (%[1]s))`,
+	types.MediaManga: `DELETE FROM library_files WHERE kind = 'manga' AND item_id IN (SELECT id FROM manga_chapters WHERE manga_id IN (%[1]s))`,
+}
+
+// PurgeItems permanently deletes items of a kind that are in the trash,
+// together with their episodes or chapters. It returns the purged IDs and the
+// paths of the files that belonged to them and nothing else, which the caller
+// removes.
+func PurgeItems(ctx context.Context, kind string, ids []int64) ([]int64, []string, error) {
+	table, err := itemTable(kind)
+	if err != nil || len(ids) == 0 {
+		return nil, nil, err
+	}
+
+	var (
+		purged []int64
+		files  []string
+	)
+	err = WithTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		purged, err = queryIDs(ctx, tx, `SELECT id FROM `+table+` WHERE deleted_at IS NOT NULL AND id IN (`+placeholders(len(ids))+`)`, idArgs(nil, ids)...)
+		if err != nil || len(purged) == 0 {
+			return err
+		}
+		in := numberedPlaceholders(len(purged))
+		args := idArgs(nil, purged)
+
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf(purgeFiles[kind], in), args...)
+		if err != nil {
+			return err
+		}
+		files = files[:0]
+		for rows.Next() {
+			var path string
+			if err := rows.Scan(&path); err != nil {
+				rows.Close()
+				return err
+			}
+			if len(path) != 0 {
+				files = append(files, path)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf(purgeLibraryFiles[kind], in), args...); err != nil {
+			return err
+		}
+		kindArg := "?" + strconv.Itoa(len(args)+1)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM item_tags WHERE kind = `+kindArg+` AND item_id IN (`+in+`)`, append(args, kind)...); err != nil {
+			return err
+		}
+		// Episodes and chapters go with their series through ON DELETE CASCADE
+		if _, err = tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE id IN (`+in+`)`, args...); err != nil {
+			return err
+		}
+
+		files, err = unreferencedFiles(ctx, tx, files)
+		return err
+	})
+	return purged, files, err
+}
+
+// fileReferences tells whether any row still points at a file. Uploads are
+// stored by content, so a purged photo can share its file with a live one.
+const fileReferences = `SELECT EXISTS (
+	SELECT 1 FROM photos WHERE file_path = ?1
+	UNION ALL SELECT 1 FROM anime_episodes WHERE file_path = ?1
+	UNION ALL SELECT 1 FROM manga_chapters WHERE file_path = ?1
+	UNION ALL SELECT 1 FROM anime WHERE cover_path = ?1
+	UNION ALL SELECT 1 FROM manga WHERE cover_path = ?1
+)`
+
+// unreferencedFiles returns the files no row points at anymore, once each.
+func unreferencedFiles(ctx context.Context, tx *sql.Tx, files []string) ([]string, error) {
+	var unreferenced []string
+	seen := make(map[string]bool, len(files))
+	for _, path := range files {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		var referenced bool
+		if err := tx.QueryRowContext(ctx, fileReferences, path).Scan(&referenced); err != nil {
+			return nil, err
+		}
+		if !referenced {
+			unreferenced = append(unreferenced, path)
+		}
+	}
+	return unreferenced, nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"LocalDex/types"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const uploadColumns = `id, kind, filename, metadata, upload_length, upload_offset, item_id, error, created_at, updated_at, expires_at`
+
+func scanUpload(row rowScanner) (*types.Upload, error) {
+	var (
+		u                         types.Upload
+		metadata                  string
+		item                      sql.NullInt64
+		created, updated, expires int64
+	)
+
+	err := row.Scan(&u.ID, &u.Kind, &u.Filename, &metadata, &u.Length, &u.Offset, &item, &u.Error, &created, &updated, &expires)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(metadata), &u.Metadata); err != nil {
+		return nil, err
+	}
+
+	if item.Valid {
+		u.ItemID = &item.Int64
+	}
+	u.CreatedAt = fromUnix(created)
+	u.UpdatedAt = fromUnix(updated)
+	u.ExpiresAt = fromUnix(expires)
+	return &u, nil
+}
+
+// CreateUpload records a new resumable upload.
+func CreateUpload(ctx context.Context, u *types.Upload) error {
+	metadata, err := json.Marshal(u.Metadata)
+	if err != nil {
+		return err
+	}
+
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO uploads (id, kind, filename, metadata, upload_length, upload_offset, created_at, updated_at, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			u.ID, u.Kind, u.Filename, string(metadata), u.Length, u.Offset,
+			toUnix(u.CreatedAt), toUnix(u.UpdatedAt), toUnix(u.ExpiresAt))
+		return err
+	})
+}
+
+// GetUpload returns an upload, or ErrNotFound.
+func GetUpload(ctx context.Context, id string) (*types.Upload, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	u, err := scanUpload(Reader.QueryRowContext(ctx, `SELECT `+uploadColumns+` FROM uploads WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return u, err
+}
+
+// SetUploadOffset records how many bytes of an upload have been received and
+// pushes its expiry back.
+func SetUploadOffset(ctx context.Context, id string, offset int64, expiresAt time.Time) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE uploads SET upload_offset = ?, updated_at = ?, expires_at = ? WHERE id = ?`,
+			offset, toUnix(time.Now()), toUnix(expiresAt), id)
+		return err
+	})
+}
+
+// SetUploadItem links a finished upload to the library item it became.
+func SetUploadItem(ctx context.Context, id string, itemID int64) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE uploads SET item_id = ?, updated_at = ? WHERE id = ?`, itemID, toUnix(time.Now()), id)
+		return err
+	})
+}
+
+// SetUploadError records why ingesting an upload failed; an empty message
+// clears it.
+func SetUploadError(ctx context.Context, id string, message string) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `UPDATE uploads SET error = ?, updated_at = ? WHERE id = ?`, message, toUnix(time.Now()), id)
+		return err
+	})
+}
+
+// DeleteUpload forgets an upload.
+func DeleteUpload(ctx context.Context, id string) error {
+	return WithTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM uploads WHERE id = ?`, id)
+		return err
+	})
+}
+
+// ExpiredUploads returns the IDs of uploads that expired before now.
+func ExpiredUploads(ctx context.Context, now time.Time) ([]string, error) {
+	ctx, cancel := readContext(ctx)
+	defer cancel()
+
+	rows, err := Reader.QueryContext(ctx, `SELECT id FROM uploads WHERE expires_at < ?`, toUnix(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
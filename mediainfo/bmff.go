@@ -0,0 +1,494 @@
+package mediainfo
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// INFO: HEIF, AVIF, MP4 and MOV are all ISO base media files: a tree of
+// size-prefixed boxes. HEIF keeps EXIF as an item located through `iinf` and
+// `iloc`; movies describe themselves in `moov`.
+
+var errBadBox = errors.New("malformed media box")
+
+// Brands of still image containers; every other `ftyp` is treated as a movie
+var imageBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+	"avif": "image/avif",
+	"avis": "image/avif",
+}
+
+// Seconds between the QuickTime epoch (1904) and the Unix epoch
+const quickTimeEpoch = 2082844800
+
+type box struct {
+	typ string
+	// Offset and size of the payload, after the header
+	start int64
+	size  int64
+}
+
+// walkBoxes calls fn for each box between off and end, stopping at the first
+// error fn returns.
+func walkBoxes(r io.ReaderAt, off int64, end int64, fn func(b box) error) error {
+	head := make([]byte, 16)
+	for off+8 <= end {
+		if _, err := r.ReadAt(head[:8], off); err != nil {
+			return err
+		}
+
+		size := int64(be.Uint32(head[0:4]))
+		typ := string(head[4:8])
+		headerSize := int64(8)
+
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			if _, err := r.ReadAt(head[8:16], off+8); err != nil {
+				return err
+			}
+			size = int64(be.Uint64(head[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || off+size > end {
+			return errBadBox
+		}
+
+		if err := fn(box{typ: typ, start: off + headerSize, size: size - headerSize}); err != nil {
+			return err
+		}
+		off += size
+	}
+	return nil
+}
+
+// children walks the boxes inside b; skip is the size of the full-box header
+// (version and flags) in front of them, if any.
+func children(r io.ReaderAt, b box, skip int64, fn func(b box) error) error {
+	return walkBoxes(r, b.start+skip, b.start+b.size, fn)
+}
+
+func readBytes(r io.ReaderAt, b box, max int64) ([]byte, error) {
+	n := min(b.size, max)
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, b.start); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func readBMFF(r io.ReaderAt, size int64, brand string, info *Info) error {
+	if mime, ok := imageBrands[brand]; ok {
+		info.MimeType = mime
+		return readHEIF(r, size, info)
+	}
+
+	info.MimeType = "video/mp4"
+	if brand == "qt  " {
+		info.MimeType = "video/quicktime"
+	}
+	return readMovie(r, size, info)
+}
+
+// cursor reads big-endian fields of a box payload in order.
+type cursor struct {
+	data []byte
+	pos  int
+	err  bool
+}
+
+func (c *cursor) uint(n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	if c.pos+n > len(c.data) {
+		c.err = true
+		return 0
+	}
+	var v uint64
+	for _, b := range c.data[c.pos : c.pos+n] {
+		v = v<<8 | uint64(b)
+	}
+	c.pos += n
+	return v
+}
+
+func (c *cursor) skip(n int) {
+	c.pos += n
+	if c.pos > len(c.data) {
+		c.err = true
+	}
+}
+
+type extent struct {
+	offset int64
+	length int64
+}
+
+func readHEIF(r io.ReaderAt, size int64, info *Info) error {
+	var (
+		exifItem uint64
+		iloc     []byte
+	)
+
+	err := walkBoxes(r, 0, size, func(top box) error {
+		if top.typ != "meta" {
+			return nil
+		}
+
+		return children(r, top, 4, func(b box) error {
+			data, err := readBytes(r, b, 1<<20)
+			if err != nil {
+				return err
+			}
+
+			switch b.typ {
+			case "iinf":
+				exifItem = findExifItem(r, b, data)
+			case "iloc":
+				// Decoded once the Exif item is known, `iinf` may come later
+				iloc = data
+			case "iprp":
+				readImageSize(r, b, info)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if exifItem == 0 {
+		return nil
+	}
+	extents := parseItemLocations(iloc, exifItem)
+	if len(extents) == 0 {
+		return nil
+	}
+
+	// The item starts with the offset of the TIFF header inside it, usually
+	// skipping an "Exif\0\0" prefix
+	e := extents[0]
+	var head [4]byte
+	if _, err := r.ReadAt(head[:], e.offset); err != nil {
+		return nil
+	}
+	skip := 4 + int64(be.Uint32(head[:]))
+	if skip >= e.length {
+		return nil
+	}
+
+	width, height := info.Width, info.Height
+	readTIFF(r, e.offset+skip, e.length-skip, info)
+	if width != 0 {
+		info.Width, info.Height = width, height
+	}
+	return nil
+}
+
+// findExifItem returns the ID of the item of type `Exif` listed in `iinf`.
+func findExifItem(r io.ReaderAt, iinf box, data []byte) uint64 {
+	if len(data) < 4 {
+		return 0
+	}
+	skip := int64(6)
+	if data[0] != 0 {
+		skip = 8
+	}
+
+	var id uint64
+	children(r, iinf, skip, func(b box) error {
+		if b.typ != "infe" || id != 0 {
+			return nil
+		}
+		entry, err := readBytes(r, b, 64)
+		if err != nil || len(entry) < 4 {
+			return nil
+		}
+
+		c := &cursor{data: entry}
+		version := c.uint(1)
+		c.skip(3)
+		if version < 2 {
+			return nil
+		}
+
+		var itemID uint64
+		if version == 2 {
+			itemID = c.uint(2)
+		} else {
+			itemID = c.uint(4)
+		}
+		c.skip(2)
+		if c.pos+4 <= len(entry) && !c.err && string(entry[c.pos:c.pos+4]) == "Exif" {
+			id = itemID
+		}
+		return nil
+	})
+	return id
+}
+
+// parseItemLocations decodes `iloc` and returns the extents of one item,
+// nothing when it is stored anywhere but in the file itself. Counts are
+// checked against the size of the box, so a crafted one can't make it spin.
+func parseItemLocations(data []byte, item uint64) []extent {
+	c := &cursor{data: data}
+	version := c.uint(1)
+	c.skip(3)
+	sizes := c.uint(1)
+	offsetSize, lengthSize := int(sizes>>4), int(sizes&0x0F)
+	sizes = c.uint(1)
+	baseOffsetSize, indexSize := int(sizes>>4), int(sizes&0x0F)
+	if version == 0 {
+		indexSize = 0
+	}
+
+	idSize := 2
+	if version >= 2 {
+		idSize = 4
+	}
+	count := c.uint(idSize)
+
+	// Smallest item: its ID, construction method, data reference index, base
+	// offset and extent count
+	itemSize := idSize + 2 + baseOffsetSize + 2
+	if version > 0 {
+		itemSize += 2
+	}
+	extentSize := indexSize + offsetSize + lengthSize
+	if c.err || extentSize == 0 || count > uint64((len(data)-c.pos)/itemSize) {
+		return nil
+	}
+
+	for range count {
+		id := c.uint(idSize)
+		method := uint64(0)
+		if version > 0 {
+			method = c.uint(2) & 0x0F
+		}
+		c.skip(2)
+		base := c.uint(baseOffsetSize)
+
+		extents := int(c.uint(2))
+		if c.err || extents > (len(data)-c.pos)/extentSize {
+			return nil
+		}
+		if id != item {
+			c.skip(extents * extentSize)
+			continue
+		}
+		if method != 0 {
+			return nil
+		}
+
+		locations := make([]extent, 0, extents)
+		for range extents {
+			c.uint(indexSize)
+			offset := c.uint(offsetSize)
+			length := c.uint(lengthSize)
+			locations = append(locations, extent{offset: int64(base + offset), length: int64(length)})
+		}
+		return locations
+	}
+	return nil
+}
+
+// readImageSize takes the largest `ispe` property, which belongs to the
+// primary image rather than a thumbnail or grid tile.
+func readImageSize(r io.ReaderAt, iprp box, info *Info) {
+	children(r, iprp, 0, func(ipco box) error {
+		if ipco.typ != "ipco" {
+			return nil
+		}
+		return children(r, ipco, 0, func(b box) error {
+			if b.typ != "ispe" {
+				return nil
+			}
+			data, err := readBytes(r, b, 12)
+			if err != nil || len(data) < 12 {
+				return nil
+			}
+
+			width, height := int(be.Uint32(data[4:8])), int(be.Uint32(data[8:12]))
+			if width*height > info.Width*info.Height {
+				info.Width, info.Height = width, height
+			}
+			return nil
+		})
+	})
+}
+
+func readMovie(r io.ReaderAt, size int64, info *Info) error {
+	return walkBoxes(r, 0, size, func(top box) error {
+		if top.typ != "moov" {
+			return nil
+		}
+
+		return children(r, top, 0, func(b box) error {
+			switch b.typ {
+			case "mvhd":
+				readMovieHeader(r, b, info)
+			case "trak":
+				children(r, b, 0, func(t box) error {
+					if t.typ == "tkhd" {
+						readTrackHeader(r, t, info)
+					}
+					return nil
+				})
+			case "udta":
+				readUserData(r, b, info)
+			}
+			return nil
+		})
+	})
+}
+
+func readMovieHeader(r io.ReaderAt, b box, info *Info) {
+	data, err := readBytes(r, b, 32)
+	if err != nil {
+		return
+	}
+
+	c := &cursor{data: data}
+	version := c.uint(1)
+	c.skip(3)
+
+	var created, timescale, duration uint64
+	if version == 1 {
+		created = c.uint(8)
+		c.skip(8)
+		timescale = c.uint(4)
+		duration = c.uint(8)
+	} else {
+		created = c.uint(4)
+		c.skip(4)
+		timescale = c.uint(4)
+		duration = c.uint(4)
+	}
+	if c.err {
+		return
+	}
+
+	if created > quickTimeEpoch {
+		taken := time.Unix(int64(created-quickTimeEpoch), 0).UTC()
+		info.TakenAt = &taken
+	}
+	if timescale != 0 {
+		info.Duration = float64(duration) / float64(timescale)
+	}
+}
+
+// readTrackHeader takes the size and rotation of the first video track; audio
+// tracks have a zero size.
+func readTrackHeader(r io.ReaderAt, b box, info *Info) {
+	if info.Width != 0 {
+		return
+	}
+	data, err := readBytes(r, b, 104)
+	if err != nil {
+		return
+	}
+
+	c := &cursor{data: data}
+	version := c.uint(1)
+	c.skip(3)
+	if version == 1 {
+		c.skip(8 + 8 + 4 + 4 + 8)
+	} else {
+		c.skip(4 + 4 + 4 + 4 + 4)
+	}
+	c.skip(8 + 2 + 2 + 2 + 2)
+
+	var matrix [9]int32
+	for i := range matrix {
+		matrix[i] = int32(c.uint(4))
+	}
+	width, height := c.uint(4)>>16, c.uint(4)>>16
+	if c.err || width == 0 || height == 0 {
+		return
+	}
+
+	info.Width, info.Height = int(width), int(height)
+	info.Orientation = matrixOrientation(matrix[0], matrix[1], matrix[3], matrix[4])
+}
+
+// matrixOrientation maps the rotation in a track matrix onto the EXIF
+// orientation values used for photos.
+func matrixOrientation(a, b, c, d int32) int {
+	const one = 1 << 16
+	switch {
+	case a == 0 && b == one && c == -one && d == 0:
+		return 6
+	case a == -one && b == 0 && c == 0 && d == -one:
+		return 3
+	case a == 0 && b == -one && c == one && d == 0:
+		return 8
+	}
+	return 1
+}
+
+// readUserData reads the QuickTime `©xyz`, `©mak` and `©mod` atoms: a 16-bit
+// length and language, then the text.
+func readUserData(r io.ReaderAt, udta box, info *Info) {
+	children(r, udta, 0, func(b box) error {
+		switch b.typ {
+		case "\xa9xyz", "\xa9mak", "\xa9mod":
+		default:
+			return nil
+		}
+
+		data, err := readBytes(r, b, 256)
+		if err != nil || len(data) < 4 {
+			return nil
+		}
+		n := min(int(be.Uint16(data[0:2])), len(data)-4)
+		text := strings.TrimSpace(string(data[4 : 4+n]))
+
+		switch b.typ {
+		case "\xa9xyz":
+			readISO6709(text, info)
+		case "\xa9mak":
+			info.CameraMake = text
+		case "\xa9mod":
+			info.CameraModel = text
+		}
+		return nil
+	})
+}
+
+// readISO6709 parses locations like `+35.6586+139.7454+012.000/`.
+func readISO6709(text string, info *Info) {
+	text = strings.TrimSuffix(text, "/")
+
+	var parts []string
+	for i := 0; i < len(text); {
+		j := strings.IndexAny(text[i+1:], "+-")
+		if j < 0 {
+			parts = append(parts, text[i:])
+			break
+		}
+		parts = append(parts, text[i:i+1+j])
+		i += 1 + j
+	}
+	if len(parts) < 2 {
+		return
+	}
+
+	latitude, err1 := strconv.ParseFloat(parts[0], 64)
+	longitude, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || math.Abs(latitude) > 90 || math.Abs(longitude) > 180 {
+		return
+	}
+	info.Latitude = &latitude
+	info.Longitude = &longitude
+}
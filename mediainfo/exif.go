@@ -0,0 +1,328 @@
+package mediainfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+var be = binary.BigEndian
+
+var errBadTIFF = errors.New("malformed TIFF/EXIF structure")
+
+// TIFF tags the library cares about
+const (
+	tagImageWidth       = 0x0100
+	tagImageLength      = 0x0101
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagDateTimeDigitize = 0x9004
+	tagOffsetTimeOrig   = 0x9011
+	tagPixelXDimension  = 0xA002
+	tagPixelYDimension  = 0xA003
+	tagLensModel        = 0xA434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+)
+
+// Bytes per value of each TIFF field type; zero for unknown types
+var typeSizes = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+const (
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeSRational = 10
+)
+
+// Guards against corrupt files sending the reader on long detours
+const (
+	maxIFDEntries = 512
+	maxValueSize  = 64 << 10
+)
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	// The 4-byte value field: the value itself when it fits, else its offset
+	raw []byte
+}
+
+type tiffReader struct {
+	r     io.ReaderAt
+	base  int64
+	size  int64
+	order binary.ByteOrder
+}
+
+func (t *tiffReader) read(off int64, n int) ([]byte, error) {
+	if off < 0 || n < 0 || off+int64(n) > t.size {
+		return nil, errBadTIFF
+	}
+	buf := make([]byte, n)
+	if _, err := t.r.ReadAt(buf, t.base+off); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (t *tiffReader) ifd(off uint32) ([]ifdEntry, error) {
+	head, err := t.read(int64(off), 2)
+	if err != nil {
+		return nil, err
+	}
+	count := int(t.order.Uint16(head))
+	if count > maxIFDEntries {
+		return nil, errBadTIFF
+	}
+
+	data, err := t.read(int64(off)+2, count*12)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ifdEntry, count)
+	for i := range entries {
+		e := data[i*12 : i*12+12]
+		entries[i] = ifdEntry{
+			tag:   t.order.Uint16(e[0:2]),
+			typ:   t.order.Uint16(e[2:4]),
+			count: t.order.Uint32(e[4:8]),
+			raw:   e[8:12],
+		}
+	}
+	return entries, nil
+}
+
+// value returns the bytes of an entry, following the offset when needed.
+func (t *tiffReader) value(e ifdEntry) ([]byte, bool) {
+	if int(e.typ) >= len(typeSizes) || typeSizes[e.typ] == 0 {
+		return nil, false
+	}
+	n := int64(typeSizes[e.typ]) * int64(e.count)
+	if n > maxValueSize {
+		return nil, false
+	}
+	if n <= 4 {
+		return e.raw[:n], true
+	}
+
+	data, err := t.read(int64(t.order.Uint32(e.raw)), int(n))
+	return data, err == nil
+}
+
+func (t *tiffReader) string(e ifdEntry) string {
+	data, ok := t.value(e)
+	if !ok {
+		return ""
+	}
+	if i := strings.IndexByte(string(data), 0); i >= 0 {
+		data = data[:i]
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (t *tiffReader) uint(e ifdEntry) (uint32, bool) {
+	switch e.typ {
+	case typeShort:
+		return uint32(t.order.Uint16(e.raw)), true
+	case typeLong:
+		return t.order.Uint32(e.raw), true
+	}
+	return 0, false
+}
+
+func (t *tiffReader) rationals(e ifdEntry) []float64 {
+	if e.typ != typeRational && e.typ != typeSRational {
+		return nil
+	}
+	data, ok := t.value(e)
+	if !ok {
+		return nil
+	}
+
+	values := make([]float64, 0, e.count)
+	for i := 0; i+8 <= len(data); i += 8 {
+		num, den := t.order.Uint32(data[i:]), t.order.Uint32(data[i+4:])
+		if den == 0 {
+			values = append(values, 0)
+			continue
+		}
+		if e.typ == typeSRational {
+			values = append(values, float64(int32(num))/float64(int32(den)))
+		} else {
+			values = append(values, float64(num)/float64(den))
+		}
+	}
+	return values
+}
+
+// readTIFF parses the TIFF structure starting at base, which is either a whole
+// TIFF file or the payload of an EXIF block.
+func readTIFF(r io.ReaderAt, base int64, size int64, info *Info) error {
+	t := &tiffReader{r: r, base: base, size: size}
+
+	head, err := t.read(0, 8)
+	if err != nil {
+		return err
+	}
+	switch string(head[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return errBadTIFF
+	}
+	if t.order.Uint16(head[2:4]) != 42 {
+		return errBadTIFF
+	}
+
+	ifd0, err := t.ifd(t.order.Uint32(head[4:8]))
+	if err != nil {
+		return err
+	}
+
+	var (
+		modified, original, offset string
+		exifIFD, gpsIFD            uint32
+	)
+
+	for _, e := range ifd0 {
+		switch e.tag {
+		case tagImageWidth:
+			if v, ok := t.uint(e); ok {
+				info.Width = int(v)
+			}
+		case tagImageLength:
+			if v, ok := t.uint(e); ok {
+				info.Height = int(v)
+			}
+		case tagMake:
+			info.CameraMake = t.string(e)
+		case tagModel:
+			info.CameraModel = t.string(e)
+		case tagOrientation:
+			if v, ok := t.uint(e); ok && v >= 1 && v <= 8 {
+				info.Orientation = int(v)
+			}
+		case tagDateTime:
+			modified = t.string(e)
+		case tagExifIFD:
+			exifIFD, _ = t.uint(e)
+		case tagGPSIFD:
+			gpsIFD, _ = t.uint(e)
+		}
+	}
+
+	if exifIFD != 0 {
+		entries, err := t.ifd(exifIFD)
+		if err == nil {
+			for _, e := range entries {
+				switch e.tag {
+				case tagDateTimeOriginal:
+					original = t.string(e)
+				case tagDateTimeDigitize:
+					if len(original) == 0 {
+						original = t.string(e)
+					}
+				case tagOffsetTimeOrig:
+					offset = t.string(e)
+				case tagPixelXDimension:
+					if v, ok := t.uint(e); ok && v > 0 {
+						info.Width = int(v)
+					}
+				case tagPixelYDimension:
+					if v, ok := t.uint(e); ok && v > 0 {
+						info.Height = int(v)
+					}
+				case tagLensModel:
+					info.LensModel = t.string(e)
+				}
+			}
+		}
+	}
+
+	if gpsIFD != 0 {
+		if entries, err := t.ifd(gpsIFD); err == nil {
+			readGPS(t, entries, info)
+		}
+	}
+
+	if len(original) == 0 {
+		original = modified
+	}
+	if taken, ok := parseExifTime(original, offset); ok {
+		info.TakenAt = &taken
+	}
+	return nil
+}
+
+func readGPS(t *tiffReader, entries []ifdEntry, info *Info) {
+	var (
+		latRef, lonRef string
+		lat, lon       []float64
+	)
+	for _, e := range entries {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			latRef = t.string(e)
+		case tagGPSLatitude:
+			lat = t.rationals(e)
+		case tagGPSLongitudeRef:
+			lonRef = t.string(e)
+		case tagGPSLongitude:
+			lon = t.rationals(e)
+		}
+	}
+
+	if len(lat) != 3 || len(lon) != 3 {
+		return
+	}
+	latitude := lat[0] + lat[1]/60 + lat[2]/3600
+	longitude := lon[0] + lon[1]/60 + lon[2]/3600
+	if latRef == "S" {
+		latitude = -latitude
+	}
+	if lonRef == "W" {
+		longitude = -longitude
+	}
+
+	// Cameras without a fix write zeroes
+	if latitude == 0 && longitude == 0 || math.Abs(latitude) > 90 || math.Abs(longitude) > 180 {
+		return
+	}
+	info.Latitude = &latitude
+	info.Longitude = &longitude
+}
+
+// parseExifTime reads an EXIF timestamp. Without an offset tag the camera's
+// wall clock is all there is, so it is stored as if it were UTC.
+func parseExifTime(value string, offset string) (time.Time, bool) {
+	if len(value) == 0 || strings.HasPrefix(value, "0000") {
+		return time.Time{}, false
+	}
+
+	if len(offset) != 0 {
+		if t, err := time.Parse(exifTimeLayout+"-07:00", value+offset); err == nil {
+			return t.UTC(), true
+		}
+	}
+
+	t, err := time.Parse(exifTimeLayout, value)
+	return t, err == nil
+}
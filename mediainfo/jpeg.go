@@ -0,0 +1,87 @@
+package mediainfo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// readJPEG walks the segments in front of the image data for the EXIF block
+// and the frame dimensions.
+func readJPEG(r io.Reader, info *Info) error {
+	br := bufio.NewReader(r)
+	if _, err := br.Discard(2); err != nil {
+		return err
+	}
+
+	sawExif := false
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil
+		}
+		if b != 0xFF {
+			continue
+		}
+
+		marker, err := br.ReadByte()
+		for err == nil && marker == 0xFF {
+			marker, err = br.ReadByte()
+		}
+		if err != nil {
+			return nil
+		}
+
+		// Markers without a payload
+		if marker == 0x01 || marker >= 0xD0 && marker <= 0xD8 {
+			continue
+		}
+		// Start of scan or end of image; all metadata comes before
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+
+		var size [2]byte
+		if _, err := io.ReadFull(br, size[:]); err != nil {
+			return nil
+		}
+		length := int(be.Uint16(size[:])) - 2
+		if length < 0 {
+			return errors.New("malformed JPEG segment")
+		}
+
+		switch {
+		case marker == 0xE1 && !sawExif:
+			segment := make([]byte, length)
+			if _, err := io.ReadFull(br, segment); err != nil {
+				return nil
+			}
+			if payload, ok := bytes.CutPrefix(segment, []byte("Exif\x00\x00")); ok {
+				sawExif = true
+				// EXIF dimensions are often missing or stale, SOF wins below
+				width, height := info.Width, info.Height
+				if err := readTIFF(bytes.NewReader(payload), 0, int64(len(payload)), info); err != nil {
+					return nil
+				}
+				if width != 0 {
+					info.Width, info.Height = width, height
+				}
+			}
+
+		// Start of frame, except DHT (C4), JPG (C8) and DAC (CC)
+		case marker >= 0xC0 && marker <= 0xCF && marker != 0xC4 && marker != 0xC8 && marker != 0xCC:
+			frame := make([]byte, length)
+			if _, err := io.ReadFull(br, frame); err != nil || len(frame) < 5 {
+				return nil
+			}
+			info.Height = int(be.Uint16(frame[1:3]))
+			info.Width = int(be.Uint16(frame[3:5]))
+
+		default:
+			if _, err := br.Discard(length); err != nil {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package mediainfo
+
+import (
+	"LocalDex/types"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// INFO: Reads capture metadata straight from photo and video files: EXIF from
+// JPEG, TIFF and HEIF/AVIF, and the movie header of MP4/MOV. Only the values
+// the library stores are decoded; everything else is skipped.
+
+// ErrUnknownFormat is returned for files none of the readers recognise.
+var ErrUnknownFormat = errors.New("unknown media format")
+
+// Info is what Extract could read from a file. Values the file doesn't carry
+// stay zero; Orientation defaults to 1 (upright).
+type Info struct {
+	types.PhotoMetadata
+	MimeType string
+	Width    int
+	Height   int
+	// Length of videos in seconds
+	Duration float64
+}
+
+// Extract reads the metadata of the file at path.
+func Extract(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, info.Size())
+}
+
+// Read is Extract for an already opened file of the given size.
+func Read(r io.ReaderAt, size int64) (*Info, error) {
+	head := make([]byte, 16)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	info := &Info{}
+	info.Orientation = 1
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		info.MimeType = "image/jpeg"
+		err = readJPEG(io.NewSectionReader(r, 0, size), info)
+
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		info.MimeType = "image/tiff"
+		err = readTIFF(r, 0, size, info)
+
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		info.MimeType = "image/png"
+		err = readPNG(r, info)
+
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		err = readBMFF(r, size, string(head[8:12]), info)
+
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func readPNG(r io.ReaderAt, info *Info) error {
+	// The IHDR chunk always comes first: length, type, width, height
+	ihdr := make([]byte, 16)
+	if _, err := r.ReadAt(ihdr, 8); err != nil {
+		return err
+	}
+	if string(ihdr[4:8]) != "IHDR" {
+		return ErrUnknownFormat
+	}
+
+	info.Width = int(be.Uint32(ihdr[8:12]))
+	info.Height = int(be.Uint32(ihdr[12:16]))
+	return nil
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"LocalDex/types"
+	"html/template"
+	"slices"
+	"strings"
+)
+
+// INFO: Every tag rendered into `<!-- Server Props -->` carries the
+// `__SERVER_PROPS__` id, so the client can drop them once it takes over the
+// head. html/template does the escaping per context: attribute values, URLs
+// in href/src and JSON-LD bodies each get the right treatment.
+var headTemplate = template.Must(template.New("head").Parse(
+	`{{with .Title}}<title id="__SERVER_PROPS__">{{.}}</title>
+{{end}}` +
+		`{{range .Meta}}` +
+		`{{if .Charset}}<meta id="__SERVER_PROPS__" charset="{{.Charset}}">
+{{else if .Name}}<meta id="__SERVER_PROPS__" name="{{.Name}}" content="{{.Content}}">
+{{else if .Property}}<meta id="__SERVER_PROPS__" property="{{.Property}}" content="{{.Content}}">
+{{else if .HTTPEquiv}}<meta id="__SERVER_PROPS__" http-equiv="{{.HTTPEquiv}}" content="{{.Content}}">
+{{end}}` +
+		`{{end}}` +
+		`{{range .Link}}<link id="__SERVER_PROPS__" rel="{{.Rel}}" href="{{.Href}}"` +
+		`{{with .Type}} type="{{.}}"{{end}}` +
+		`{{with .Crossorigin}} crossorigin="{{.}}"{{end}}` +
+		`{{with .Media}} media="{{.}}"{{end}}` +
+		`{{with .Sizes}} sizes="{{.}}"{{end}}` +
+		`{{with .As}} as="{{.}}"{{end}}` +
+		`{{with .Referrer}} referrerpolicy="{{.}}"{{end}}` +
+		`{{with .Title}} title="{{.}}"{{end}}>
+{{end}}` +
+		`{{range .StructuredData}}<script id="__SERVER_PROPS__" type="application/ld+json"{{with $.Nonce}} nonce="{{.}}"{{end}}>{{.}}</script>
+{{end}}` +
+		`{{range .Script}}<script id="__SERVER_PROPS__"` +
+		`{{with .Src}} src="{{.}}"{{end}}` +
+		`{{with .Type}} type="{{.}}"{{end}}` +
+		`{{if .Defer}} defer{{end}}` +
+		`{{with $.Nonce}} nonce="{{.}}"{{end}}>{{.Content}}</script>
+{{end}}`,
+))
+
+// Inline script bodies come from the operator's own route config (or from a
+// loader), so they are trusted and emitted verbatim.
+type headScript struct {
+	Src     string
+	Type    string
+	Defer   bool
+	Content template.JS
+}
+
+type headData struct {
+	Title          string
+	Meta           []types.MetaTag
+	Link           []types.LinkTag
+	StructuredData []map[string]any
+	Script         []headScript
+	Nonce          string
+}
+
+// renderHead renders the merged metadata of a page. The nonce is stamped on
+// every script tag it emits, external ones included, so the page's CSP can
+// stay nonce-based.
+func renderHead(meta *types.RouteMetadata, nonce string) (string, error) {
+	data := headData{
+		Title:          meta.Title,
+		Meta:           meta.Meta,
+		Link:           meta.Link,
+		StructuredData: meta.StructuredData,
+		Nonce:          nonce,
+	}
+	for _, script := range meta.Script {
+		data.Script = append(data.Script, headScript{
+			Src:     script.Src,
+			Type:    script.Type,
+			Defer:   script.Defer,
+			Content: template.JS(script.Content),
+		})
+	}
+
+	var builder strings.Builder
+	if err := headTemplate.Execute(&builder, data); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// mergeRoutes concatenates the tags of several routes into fresh slices; the
+// first non-empty title wins.
+func mergeRoutes(routes ...*types.RouteMetadata) *types.RouteMetadata {
+	merged := &types.RouteMetadata{}
+	for _, route := range routes {
+		if route == nil {
+			continue
+		}
+		if len(merged.Title) == 0 {
+			merged.Title = route.Title
+		}
+		merged.Meta = slices.Concat(merged.Meta, route.Meta)
+		merged.Link = slices.Concat(merged.Link, route.Link)
+		merged.Script = slices.Concat(merged.Script, route.Script)
+		merged.StructuredData = slices.Concat(merged.StructuredData, route.StructuredData)
+	}
+	return merged
+}
@@ -0,0 +1,104 @@
+package parser
+
+import (
+	"LocalDex/types"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestRenderHead(t *testing.T) {
+	tests := []struct {
+		name  string
+		meta  *types.RouteMetadata
+		nonce string
+	}{
+		{
+			name: "meta",
+			meta: &types.RouteMetadata{
+				Title: `Photos & "Albums" <LocalDex>`,
+				Meta: []types.MetaTag{
+					{Charset: "utf-8"},
+					{Name: "description", Content: `Tom's "best" <shots> & more`},
+					{Property: "og:title", Content: "Photos"},
+					{HTTPEquiv: "X-UA-Compatible", Content: "IE=edge"},
+					// Tags without a key are skipped
+					{Content: "orphan"},
+				},
+			},
+		},
+		{
+			name: "link",
+			meta: &types.RouteMetadata{
+				Link: []types.LinkTag{
+					{Rel: "icon", Href: "/favicon.ico", Type: "image/x-icon", Sizes: "any"},
+					{Rel: "preload", Href: "/assets/index-a1B2c3D4.css", As: "style", Crossorigin: "anonymous", Media: "screen", Referrer: "no-referrer", Title: "Main"},
+					{Rel: "alternate", Href: "javascript:alert(1)"},
+					{Rel: "canonical", Href: "/photo?id=1&size=large"},
+				},
+			},
+		},
+		{
+			name: "jsonld",
+			meta: &types.RouteMetadata{
+				StructuredData: []map[string]any{
+					{
+						"@context": "https://schema.org",
+						"@type":    "ImageObject",
+						"name":     `</script><script>alert("x")</script>`,
+						"caption":  "Fish & <Chips>",
+						"width":    1280,
+					},
+				},
+			},
+		},
+		{
+			name: "script",
+			meta: &types.RouteMetadata{
+				Script: []types.ScriptTag{
+					{Src: "/assets/index-a1B2c3D4.js", Type: "module"},
+					{Src: "/assets/legacy-a1B2c3D4.js", Defer: true},
+					{Content: `window.__CONFIG__ = {"theme": "dark"};`},
+				},
+			},
+		},
+		{
+			name: "nonce",
+			meta: &types.RouteMetadata{
+				Script: []types.ScriptTag{
+					{Src: "/assets/index-a1B2c3D4.js", Type: "module"},
+					{Content: `console.log("ready")`},
+				},
+				StructuredData: []map[string]any{{"@type": "WebSite", "name": "LocalDex"}},
+			},
+			nonce: `r4nd0m"nonce`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := renderHead(test.meta, test.nonce)
+			if err != nil {
+				t.Fatalf("renderHead: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "head", test.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing golden file, run `go test ./parser -update`: %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("renderHead output differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
@@ -2,44 +2,253 @@ package parser
 
 import (
 	vars "LocalDex"
+	"LocalDex/settings"
 	"LocalDex/types"
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"html"
 	"io/fs"
+	"net/url"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
 )
 
-const DevHTMLShell string = `<!doctype html>
+// INFO: Markers in the HTML shell where the server inserts content. Each must
+// appear exactly once; the shell is rejected at startup otherwise.
+const (
+	serverPropsMarker = "<!-- Server Props -->"
+	ssrDataMarker     = "<!-- SSR Data -->"
+)
+
+// INFO: The development shell loads the app straight from the Vite dev server.
+// `{{VITE}}` is replaced with the configured Vite origin.
+const devHTMLShell string = `<!doctype html>
 <html lang="en">
 
 <head>
   <script type="module">
-    import { injectIntoGlobalHook } from "http://localhost:5173/@react-refresh";
+    import { injectIntoGlobalHook } from "{{VITE}}/@react-refresh";
     injectIntoGlobalHook(window);
     window.$RefreshReg$ = () => {};
     window.$RefreshSig$ = () => (type) => type;
   </script>
-  <script type="module" src="http://localhost:5173/@vite/client"></script>
+  <script type="module" src="{{VITE}}/@vite/client"></script>
 
-  <!-- Server Props -->
-  <!-- SSR Data -->
+  ` + serverPropsMarker + `
+  ` + ssrDataMarker + `
 </head>
 
 <body>
   <div id="root"></div>
-  <script type="module" src="http://localhost:5173/src/main.tsx"></script>
+  <script type="module" src="{{VITE}}/src/main.tsx"></script>
 </body>
 
 </html>`
 
-func GetHTML() ([]byte, error) {
+// HTMLShell is the page template split at its markers, so rendering is a
+// plain concatenation instead of a search through the whole document.
+type HTMLShell struct {
+	// chunks[i] is followed by the content of slots[i]; the last chunk has no slot
+	chunks [][]byte
+	slots  []string
+}
+
+var currentShell *HTMLShell
+
+// ParseShell builds the insertion plan of a shell, failing when a marker is
+// missing or appears more than once.
+func ParseShell(html []byte) (*HTMLShell, error) {
+	type position struct {
+		marker string
+		at     int
+	}
+
+	var positions []position
+	for _, marker := range []string{serverPropsMarker, ssrDataMarker} {
+		switch bytes.Count(html, []byte(marker)) {
+		case 0:
+			return nil, fmt.Errorf("HTML shell is missing the `%s` marker", marker)
+		case 1:
+			positions = append(positions, position{marker, bytes.Index(html, []byte(marker))})
+		default:
+			return nil, fmt.Errorf("HTML shell contains the `%s` marker more than once", marker)
+		}
+	}
+	slices.SortFunc(positions, func(a, b position) int { return a.at - b.at })
+
+	shell := &HTMLShell{}
+	start := 0
+	for _, pos := range positions {
+		shell.chunks = append(shell.chunks, html[start:pos.at])
+		shell.slots = append(shell.slots, pos.marker)
+		start = pos.at + len(pos.marker)
+	}
+	shell.chunks = append(shell.chunks, html[start:])
+
+	return shell, nil
+}
+
+// Render fills the shell with the head tags and the SSR data script. Both may
+// be empty.
+func (s *HTMLShell) Render(serverProps []byte, ssrData []byte) []byte {
+	size := len(serverProps) + len(ssrData)
+	for _, chunk := range s.chunks {
+		size += len(chunk)
+	}
+
+	out := make([]byte, 0, size)
+	for i, chunk := range s.chunks {
+		out = append(out, chunk...)
+		if i == len(s.slots) {
+			break
+		}
+
+		switch s.slots[i] {
+		case serverPropsMarker:
+			out = append(out, serverProps...)
+		case ssrDataMarker:
+			out = append(out, ssrData...)
+		}
+	}
+	return out
+}
+
+// devShell renders the development shell for a Vite origin such as
+// `http://localhost:5173`.
+func devShell(viteOrigin string) ([]byte, error) {
+	u, err := url.Parse(viteOrigin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 || strings.Trim(u.Path, "/") != "" {
+		return nil, fmt.Errorf("invalid Vite origin %q, expected e.g. http://localhost:5173", viteOrigin)
+	}
+
+	origin := html.EscapeString(u.Scheme + "://" + u.Host)
+	return []byte(strings.ReplaceAll(devHTMLShell, "{{VITE}}", origin)), nil
+}
+
+// LoadShell reads the production shell from the embedded Vite build (or
+// builds the development one) and prepares it for rendering.
+func LoadShell() error {
+	var (
+		content []byte
+		err     error
+	)
+
 	if os.Getenv("ENV") == types.ENV.Prod {
-		content, err := fs.ReadFile(vars.ViteFS, "client/dist/index.html")
+		content, err = fs.ReadFile(vars.ViteFS, "client/dist/index.html")
 		if err != nil {
-			return []byte{}, errors.New("file not found")
+			return fmt.Errorf("failed to read the embedded HTML shell: %w", err)
 		}
-
-		return content, nil
 	} else {
-		return []byte(DevHTMLShell), nil
+		content, err = devShell(settings.Get().ViteOrigin)
+		if err != nil {
+			return err
+		}
 	}
+
+	shell, err := ParseShell(content)
+	if err != nil {
+		return err
+	}
+
+	currentShell = shell
+	return nil
+}
+
+// Shell returns the shell prepared by LoadShell.
+func Shell() (*HTMLShell, error) {
+	if currentShell == nil {
+		return nil, errors.New("HTML shell was not loaded")
+	}
+	return currentShell, nil
+}
+
+// inlineJSON serialises data for embedding in a `<script>`. Besides
+// json.Marshal's own escaping, the output runs through json.HTMLEscape so that
+// pre-encoded values (json.RawMessage, custom marshalers) can't smuggle a
+// `</script>` or `<!--` into the page either. The result is valid JavaScript
+// as well, U+2028 and U+2029 included.
+func inlineJSON(buf *bytes.Buffer, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	json.HTMLEscape(buf, raw)
+	return nil
+}
+
+// SSRDataScript serialises data into the `__SERVER_DATA__` script.
+func SSRDataScript(data any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<script id="__SERVER_DATA__" type="application/json">`)
+	if err := inlineJSON(&buf, data); err != nil {
+		return nil, err
+	}
+	buf.WriteString(`</script>`)
+	return buf.Bytes(), nil
+}
+
+// InitialDataScript assigns preloaded API responses to
+// `window.__INITIAL_DATA__`. It is an executable inline script, so it picks
+// up the page's CSP nonce through InjectNonce.
+func InitialDataScript(data map[string]any) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<script id="__INITIAL_DATA__">window.__INITIAL_DATA__ = `)
+	if err := inlineJSON(&buf, data); err != nil {
+		return nil, err
+	}
+	buf.WriteString(`;</script>`)
+	return buf.Bytes(), nil
+}
+
+// Script types that browsers execute, and which therefore need a CSP nonce.
+var executableScriptTypes = map[string]bool{
+	"":                       true,
+	"module":                 true,
+	"text/javascript":        true,
+	"application/javascript": true,
+}
+
+var (
+	scriptOpenTag   = regexp.MustCompile(`(?i)<script\b[^>]*>`)
+	scriptSrcAttr   = regexp.MustCompile(`(?i)\ssrc\s*=`)
+	scriptNonceAttr = regexp.MustCompile(`(?i)\snonce\s*=`)
+	scriptTypeAttr  = regexp.MustCompile(`(?i)\stype\s*=\s*["']?([^"'\s>]*)`)
+)
+
+// InjectNonce adds a `nonce` attribute to every inline, executable `<script>`
+// tag of the shell. It reports whether the page carries any nonce (including
+// ones the head renderer already stamped), since such a page can no longer be
+// served from an HTTP cache under a fresh nonce.
+func InjectNonce(html []byte, nonce string) ([]byte, bool) {
+	if len(nonce) == 0 {
+		return html, false
+	}
+
+	injected := false
+	out := scriptOpenTag.ReplaceAllFunc(html, func(tag []byte) []byte {
+		if scriptNonceAttr.Match(tag) {
+			injected = true
+			return tag
+		}
+		if scriptSrcAttr.Match(tag) {
+			return tag
+		}
+
+		scriptType := ""
+		if m := scriptTypeAttr.FindSubmatch(tag); m != nil {
+			scriptType = strings.ToLower(string(m[1]))
+		}
+		if !executableScriptTypes[scriptType] {
+			return tag
+		}
+
+		injected = true
+		return append([]byte(`<script nonce="`+nonce+`"`), tag[len("<script"):]...)
+	})
+
+	return out, injected
 }
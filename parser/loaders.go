@@ -0,0 +1,298 @@
+package parser
+
+import (
+	"LocalDex/api/anime"
+	"LocalDex/api/auth"
+	"LocalDex/api/manga"
+	"LocalDex/api/photo"
+	"LocalDex/db"
+	"LocalDex/types"
+	"LocalDex/util"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Longest description placed into meta tags; unfurlers truncate anyway.
+const maxMetaDescription = 200
+
+// Number of recent items of each library preloaded for the home page.
+const homePreviewLimit = 24
+
+func init() {
+	RegisterDynamicRoute("/", loadHomePage)
+	RegisterDynamicRoute("/photo", loadPhotoLibrary)
+	RegisterDynamicRoute("/anime", loadAnimeLibrary)
+	RegisterDynamicRoute("/manga", loadMangaLibrary)
+	RegisterDynamicRoute("/photo/{id}", loadPhotoPage)
+	RegisterDynamicRoute("/anime/{id}", loadAnimePage)
+	RegisterDynamicRoute("/manga/{id}", loadMangaPage)
+}
+
+// listKey is the API URL of a listing, used as its `__INITIAL_DATA__` key.
+func listKey(kind string, q types.ListQuery) string {
+	return "/api/" + kind + "?" + util.ListQueryValues(q).Encode()
+}
+
+// itemKey is the API URL of a single library item.
+func itemKey(kind string, id int64) string {
+	return fmt.Sprintf("/api/%s/%d", kind, id)
+}
+
+// loadHomePage preloads the most recent items of every library for signed-in
+// users; anonymous visitors only get the sign-in screen.
+func loadHomePage(r *http.Request, params map[string]string) (*SSRResult, error) {
+	if !auth.IsAuthenticated(r) {
+		return &SSRResult{}, nil
+	}
+
+	q := types.ListQuery{Sort: "created_desc", Limit: homePreviewLimit, Page: 1}
+	initial := make(map[string]any)
+
+	photos, err := photo.List(r.Context(), q)
+	if err != nil {
+		return nil, err
+	}
+	initial[listKey(types.MediaPhoto, q)] = photos
+
+	animes, err := anime.List(r.Context(), q)
+	if err != nil {
+		return nil, err
+	}
+	initial[listKey(types.MediaAnime, q)] = animes
+
+	mangas, err := manga.List(r.Context(), q)
+	if err != nil {
+		return nil, err
+	}
+	initial[listKey(types.MediaManga, q)] = mangas
+
+	return &SSRResult{InitialData: initial}, nil
+}
+
+// loadLibrary preloads the listing a library page asks for. Invalid query
+// parameters aren't fatal here: the page renders without preloaded data and
+// the client's own request reports the problem.
+func loadLibrary[T any](r *http.Request, kind string, parse func(url.Values) (types.ListQuery, error), list func(context.Context, types.ListQuery) (*types.Page[T], error)) (*SSRResult, error) {
+	if !auth.IsAuthenticated(r) {
+		return &SSRResult{}, nil
+	}
+
+	q, err := parse(r.URL.Query())
+	if err != nil {
+		return &SSRResult{}, nil
+	}
+
+	page, err := list(r.Context(), q)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSRResult{InitialData: map[string]any{listKey(kind, q): page}}, nil
+}
+
+func loadPhotoLibrary(r *http.Request, params map[string]string) (*SSRResult, error) {
+	return loadLibrary(r, types.MediaPhoto, photo.ParseListQuery, photo.List)
+}
+
+func loadAnimeLibrary(r *http.Request, params map[string]string) (*SSRResult, error) {
+	return loadLibrary(r, types.MediaAnime, anime.ParseListQuery, anime.List)
+}
+
+func loadMangaLibrary(r *http.Request, params map[string]string) (*SSRResult, error) {
+	return loadLibrary(r, types.MediaManga, manga.ParseListQuery, manga.List)
+}
+
+func parseID(params map[string]string) (int64, error) {
+	id, err := strconv.ParseInt(params["id"], 10, 64)
+	if err != nil || id <= 0 {
+		return 0, db.ErrNotFound
+	}
+	return id, nil
+}
+
+// absoluteURL turns a site-relative path into an absolute URL, which Open
+// Graph consumers require for og:image and og:url.
+func absoluteURL(path string) string {
+	return strings.TrimSuffix(os.Getenv("HOST"), "/") + path
+}
+
+func truncate(s string, max int) string {
+	s = strings.TrimSpace(s)
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
+
+// itemMetadata builds the head tags shared by all library item pages.
+func itemMetadata(path string, title string, description string, image string, ogType string, card string) *types.RouteMetadata {
+	fullTitle := title + " | " + os.Getenv("TITLE")
+	description = truncate(description, maxMetaDescription)
+
+	meta := []types.MetaTag{
+		{Name: "description", Content: description},
+		{Property: "og:title", Content: fullTitle},
+		{Property: "og:description", Content: description},
+		{Property: "og:url", Content: absoluteURL(path)},
+		{Property: "og:type", Content: ogType},
+		{Property: "og:site_name", Content: os.Getenv("TITLE")},
+		{Name: "twitter:card", Content: card},
+		{Name: "twitter:title", Content: fullTitle},
+		{Name: "twitter:description", Content: description},
+	}
+	if len(image) != 0 {
+		meta = append(meta,
+			types.MetaTag{Property: "og:image", Content: image},
+			types.MetaTag{Name: "twitter:image", Content: image},
+		)
+	}
+
+	return &types.RouteMetadata{
+		Path:  path,
+		Title: fullTitle,
+		Meta:  meta,
+		Link:  []types.LinkTag{{Rel: "canonical", Href: absoluteURL(path)}},
+	}
+}
+
+// structuredData builds the schema.org object describing a library item.
+func structuredData(schemaType string, path string, name string, description string, image string) map[string]any {
+	data := map[string]any{
+		"@context":    "https://schema.org",
+		"@type":       schemaType,
+		"name":        name,
+		"description": description,
+		"url":         absoluteURL(path),
+	}
+	if len(image) != 0 {
+		data["image"] = image
+	}
+	return data
+}
+
+// loadPhotoPage preloads a photo for signed-in users. The library is
+// private and photos carry their location, so anonymous visitors get the
+// sign-in screen without any of it. The preview tags are therefore only seen
+// by signed-in browsers, never by link unfurlers; like the covers of other
+// pages they point at a thumbnail, not at the original file.
+func loadPhotoPage(r *http.Request, params map[string]string) (*SSRResult, error) {
+	if !auth.IsAuthenticated(r) {
+		return &SSRResult{}, nil
+	}
+
+	id, err := parseID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := photo.Find(r.Context(), id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	title := p.Title
+	if len(title) == 0 {
+		title = "Photo #" + strconv.FormatInt(p.ID, 10)
+	}
+	description := p.Caption
+	if len(description) == 0 {
+		description = fmt.Sprintf("%s from the %s photo library.", title, os.Getenv("TITLE"))
+	}
+
+	image := ""
+	if strings.HasPrefix(p.MimeType, "image/") {
+		image = absoluteURL(fmt.Sprintf("/api/photo/%d/thumb?size=large", p.ID))
+	}
+
+	metadata := itemMetadata(r.URL.Path, title, description, image, "website", "summary_large_image")
+	ld := structuredData("ImageObject", r.URL.Path, title, description, image)
+	if len(image) != 0 {
+		ld["thumbnailUrl"] = image
+	}
+	ld["encodingFormat"] = p.MimeType
+	ld["uploadDate"] = p.CreatedAt.Format(time.RFC3339)
+	if p.Width > 0 && p.Height > 0 {
+		ld["width"] = p.Width
+		ld["height"] = p.Height
+	}
+	metadata.StructuredData = []map[string]any{ld}
+
+	return &SSRResult{
+		Metadata:    metadata,
+		Data:        p,
+		InitialData: map[string]any{itemKey(types.MediaPhoto, p.ID): p},
+	}, nil
+}
+
+func loadAnimePage(r *http.Request, params map[string]string) (*SSRResult, error) {
+	id, err := parseID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := anime.Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return nil, err
+	}
+
+	description := a.Description
+	if len(description) == 0 {
+		description = fmt.Sprintf("%s in the %s anime library.", a.Title, os.Getenv("TITLE"))
+	}
+
+	image := ""
+	if len(a.CoverPath) != 0 {
+		image = absoluteURL(fmt.Sprintf("/api/anime/%d/cover", a.ID))
+	}
+
+	metadata := itemMetadata(r.URL.Path, a.Title, description, image, "video.tv_show", "summary_large_image")
+	metadata.StructuredData = []map[string]any{
+		structuredData("TVSeries", r.URL.Path, a.Title, description, image),
+	}
+
+	return &SSRResult{
+		Metadata:    metadata,
+		Data:        a,
+		InitialData: map[string]any{itemKey(types.MediaAnime, a.ID): a},
+	}, nil
+}
+
+func loadMangaPage(r *http.Request, params map[string]string) (*SSRResult, error) {
+	id, err := parseID(params)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := manga.Find(r.Context(), id, auth.IsAuthenticated(r))
+	if err != nil {
+		return nil, err
+	}
+
+	description := m.Description
+	if len(description) == 0 {
+		description = fmt.Sprintf("%s in the %s manga library.", m.Title, os.Getenv("TITLE"))
+	}
+
+	image := ""
+	if len(m.CoverPath) != 0 {
+		image = absoluteURL(fmt.Sprintf("/api/manga/%d/cover", m.ID))
+	}
+
+	metadata := itemMetadata(r.URL.Path, m.Title, description, image, "book", "summary_large_image")
+	metadata.StructuredData = []map[string]any{
+		structuredData("ComicSeries", r.URL.Path, m.Title, description, image),
+	}
+
+	return &SSRResult{
+		Metadata:    metadata,
+		Data:        m,
+		InitialData: map[string]any{itemKey(types.MediaManga, m.ID): m},
+	}, nil
+}
@@ -1,32 +1,67 @@
 package parser
 
 import (
+	"LocalDex/db"
+	"LocalDex/types"
+	"LocalDex/util"
+	"errors"
 	"net/http"
-	"strings"
 )
 
-var DynamicRoutes []string = []string{"/blog/"}
+// INFO: What a dynamic route loader hands back to ServePages: metadata for the
+// document head, optional data for the `__SERVER_DATA__` script and API
+// responses to preload into `window.__INITIAL_DATA__`, keyed by the API URL
+// the client would otherwise fetch them from.
+type SSRResult struct {
+	Metadata    *types.RouteMetadata
+	Data        any
+	InitialData map[string]any
+}
+
+// DynamicLoader builds the SSR result for one dynamic route. params holds the
+// values captured by the route pattern.
+type DynamicLoader func(r *http.Request, params map[string]string) (*SSRResult, error)
+
+type DynamicRoute struct {
+	Pattern string
+	Loader  DynamicLoader
+}
+
+var DynamicRoutes []DynamicRoute
 
-type RouteData struct {
-	FullPath string
-	Route    string
+// RegisterDynamicRoute adds a loader for a path pattern such as `/photo/{id}`.
+func RegisterDynamicRoute(pattern string, loader DynamicLoader) {
+	DynamicRoutes = append(DynamicRoutes, DynamicRoute{Pattern: pattern, Loader: loader})
 }
 
-func PerformSSR(fullPath string) (string, error, int) {
-	var route RouteData
+// PerformSSR runs the loader registered for the request path. It returns
+// 204 when no dynamic route matches (the page is purely static), the status
+// of an APIError returned by the loader, 404 or 410 when the requested item
+// doesn't exist or was deleted, and 500 on any other failure.
+func PerformSSR(r *http.Request) (*SSRResult, error, int) {
+	for _, route := range DynamicRoutes {
+		params, ok := util.MatchPath(route.Pattern, r.URL.Path)
+		if !ok {
+			continue
+		}
 
-	for _, DynamicRoute := range DynamicRoutes {
-		if strings.HasPrefix(fullPath, DynamicRoute) {
-			route = RouteData{
-				FullPath: fullPath,
-				Route:    DynamicRoute,
+		result, err := route.Loader(r, params)
+		if err != nil {
+			var apiErr *types.APIError
+			if errors.As(err, &apiErr) {
+				return nil, err, apiErr.Status
+			}
+			if errors.Is(err, db.ErrNotFound) {
+				return nil, err, http.StatusNotFound
+			}
+			if errors.Is(err, db.ErrDeleted) {
+				return nil, err, http.StatusGone
 			}
-			break
+			return nil, err, http.StatusInternalServerError
 		}
-	}
 
-	switch route.Route {
-	default:
-		return "", nil, http.StatusNoContent
+		return result, nil, http.StatusOK
 	}
+
+	return nil, nil, http.StatusNoContent
 }
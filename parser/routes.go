@@ -0,0 +1,386 @@
+package parser
+
+import (
+	"LocalDex/logger"
+	"LocalDex/types"
+	"LocalDex/util"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the route metadata file is checked for changes.
+const routeReloadInterval = 2 * time.Second
+
+// INFO: Parsed and validated `static.route.json`, indexed by path. A new index
+// is built on every reload and swapped in atomically; readers never see a
+// half-loaded file.
+//   - Plain paths and the special `*` / `#...` entries are looked up directly.
+//   - Patterns (`/anime/:id`, `/anime/{id}`, `/manga/*`) are kept sorted from
+//     most to least specific, so the first match is the best one.
+type routeIndex struct {
+	routes   []types.RouteMetadata
+	byPath   map[string]*types.RouteMetadata
+	patterns []*types.RouteMetadata
+}
+
+func (idx *routeIndex) get(path string) *types.RouteMetadata {
+	return idx.byPath[path]
+}
+
+// match resolves the metadata for a page path: an exact entry first, then
+// the most specific pattern. Pattern matches come back with their params
+// interpolated into the title and meta content.
+func (idx *routeIndex) match(path string) *types.RouteMetadata {
+	if route, ok := idx.byPath[path]; ok {
+		return route
+	}
+
+	for _, route := range idx.patterns {
+		if params, ok := util.MatchPath(route.Path, path); ok {
+			return interpolateRoute(route, params)
+		}
+	}
+	return nil
+}
+
+// Matches `{{name}}` placeholders in route titles and meta content.
+var routePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_*]+)\s*\}\}`)
+
+func interpolate(s string, params map[string]string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return routePlaceholder.ReplaceAllStringFunc(s, func(m string) string {
+		return params[routePlaceholder.FindStringSubmatch(m)[1]]
+	})
+}
+
+// interpolateRoute returns a copy of the route with its params filled in; the
+// indexed route is shared between requests and must stay untouched.
+func interpolateRoute(route *types.RouteMetadata, params map[string]string) *types.RouteMetadata {
+	out := &types.RouteMetadata{
+		Path:  route.Path,
+		Title: interpolate(route.Title, params),
+		Meta:  make([]types.MetaTag, len(route.Meta)),
+		Link:  route.Link,
+	}
+	for i, meta := range route.Meta {
+		meta.Content = interpolate(meta.Content, params)
+		out.Meta[i] = meta
+	}
+	return out
+}
+
+// isRoutePattern reports whether a path contains params or a wildcard.
+func isRoutePattern(path string) bool {
+	if !strings.HasPrefix(path, "/") {
+		return false
+	}
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		if seg == "*" || strings.HasPrefix(seg, ":") || (strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}")) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentRank orders pattern segments: literals beat params, params beat the
+// trailing wildcard.
+func segmentRank(seg string) int {
+	switch {
+	case seg == "*" || strings.HasSuffix(seg, "...}"):
+		return 0
+	case strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "{"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// comparePatterns sorts more specific patterns first, comparing segment by
+// segment and then preferring the longer pattern.
+func comparePatterns(a, b string) int {
+	segsA := strings.Split(strings.Trim(a, "/"), "/")
+	segsB := strings.Split(strings.Trim(b, "/"), "/")
+
+	for i := 0; i < len(segsA) && i < len(segsB); i++ {
+		if ra, rb := segmentRank(segsA[i]), segmentRank(segsB[i]); ra != rb {
+			return rb - ra
+		}
+	}
+	if len(segsA) != len(segsB) {
+		return len(segsB) - len(segsA)
+	}
+	return strings.Compare(a, b)
+}
+
+// patternKey normalises param names away, so `/anime/:id` and `/anime/{slug}`
+// are recognised as the same route.
+func patternKey(path string) string {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, seg := range segs {
+		switch segmentRank(seg) {
+		case 0:
+			segs[i] = "*"
+		case 1:
+			segs[i] = ":"
+		}
+	}
+	return "/" + strings.Join(segs, "/")
+}
+
+// patternParams lists the names a pattern captures.
+func patternParams(path string) map[string]bool {
+	names := make(map[string]bool)
+	for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+		switch {
+		case seg == "*":
+			names["*"] = true
+		case strings.HasPrefix(seg, ":"):
+			names[seg[1:]] = true
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}"):
+			names[strings.TrimSuffix(seg[1:], "...}")] = true
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			names[seg[1:len(seg)-1]] = true
+		}
+	}
+	return names
+}
+
+// validatePlaceholders makes sure every `{{name}}` used by a route refers to
+// something its pattern actually captures.
+func validatePlaceholders(route *types.RouteMetadata, params map[string]bool) []error {
+	var errs []error
+
+	check := func(field string, value string) {
+		for _, m := range routePlaceholder.FindAllStringSubmatch(value, -1) {
+			if !params[m[1]] {
+				errs = append(errs, fmt.Errorf("route %q: %s uses unknown param {{%s}}", route.Path, field, m[1]))
+			}
+		}
+	}
+
+	check("title", route.Title)
+	for j, meta := range route.Meta {
+		check(fmt.Sprintf("meta #%d", j), meta.Content)
+	}
+	return errs
+}
+
+var routeStore = struct {
+	sync.RWMutex
+	index   *routeIndex
+	modTime time.Time
+	size    int64
+	stats   types.RouteMetadataStats
+}{}
+
+func staticRoutePath() string {
+	return filepath.Join(os.Getenv("ETC_DIR"), "config", "static.route.json")
+}
+
+// parseStaticRoutes decodes and validates the route metadata file. Unknown
+// keys, a missing `*` route and duplicate paths are all rejected.
+func parseStaticRoutes(data []byte) (*routeIndex, error) {
+	var routes []types.RouteMetadata
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&routes); err != nil {
+		return nil, fmt.Errorf("failed to parse static metadata JSON: %w", err)
+	}
+
+	idx := &routeIndex{
+		routes: routes,
+		byPath: make(map[string]*types.RouteMetadata, len(routes)),
+	}
+
+	var errs []error
+	seenPatterns := make(map[string]string)
+	for i := range routes {
+		route := &routes[i]
+
+		if len(route.Path) == 0 {
+			errs = append(errs, fmt.Errorf("route #%d has an empty path", i))
+			continue
+		}
+		if _, exists := idx.byPath[route.Path]; exists {
+			errs = append(errs, fmt.Errorf("duplicate route path %q", route.Path))
+			continue
+		}
+
+		for j, meta := range route.Meta {
+			set := 0
+			for _, key := range []string{meta.Charset, meta.Name, meta.Property, meta.HTTPEquiv} {
+				if len(key) != 0 {
+					set++
+				}
+			}
+			if set != 1 {
+				errs = append(errs, fmt.Errorf("route %q: meta #%d must set exactly one of charset, name, property or http-equiv", route.Path, j))
+			}
+		}
+
+		for j, script := range route.Script {
+			if (len(script.Src) == 0) == (len(script.Content) == 0) {
+				errs = append(errs, fmt.Errorf("route %q: script #%d must set exactly one of src or content", route.Path, j))
+			}
+		}
+
+		for j, link := range route.Link {
+			if len(link.Rel) == 0 || len(link.Href) == 0 {
+				errs = append(errs, fmt.Errorf("route %q: link #%d needs both rel and href", route.Path, j))
+			}
+		}
+
+		if isRoutePattern(route.Path) {
+			key := patternKey(route.Path)
+			if other, exists := seenPatterns[key]; exists {
+				errs = append(errs, fmt.Errorf("route pattern %q duplicates %q", route.Path, other))
+				continue
+			}
+			seenPatterns[key] = route.Path
+
+			errs = append(errs, validatePlaceholders(route, patternParams(route.Path))...)
+			idx.patterns = append(idx.patterns, route)
+			continue
+		}
+
+		errs = append(errs, validatePlaceholders(route, nil)...)
+		idx.byPath[route.Path] = route
+	}
+
+	slices.SortFunc(idx.patterns, func(a, b *types.RouteMetadata) int {
+		return comparePatterns(a.Path, b.Path)
+	})
+
+	if idx.get("*") == nil {
+		errs = append(errs, errors.New(`missing the default "*" route`))
+	}
+
+	if len(errs) != 0 {
+		return nil, fmt.Errorf("invalid static metadata: %w", errors.Join(errs...))
+	}
+	return idx, nil
+}
+
+// LoadStaticRoutes (re)reads `static.route.json`. On failure the previously
+// loaded routes stay in place.
+func LoadStaticRoutes() error {
+	path := staticRoutePath()
+
+	info, err := os.Stat(path)
+	if err == nil {
+		var data []byte
+		data, err = os.ReadFile(path)
+		if err == nil {
+			var idx *routeIndex
+			idx, err = parseStaticRoutes(data)
+			if err == nil {
+				routeStore.Lock()
+				routeStore.index = idx
+				routeStore.modTime = info.ModTime()
+				routeStore.size = info.Size()
+				routeStore.stats.Reloads++
+				routeStore.stats.Routes = len(idx.routes)
+				routeStore.stats.LastReloadAt = time.Now().UTC()
+				routeStore.stats.LastError = ""
+				routeStore.Unlock()
+				return nil
+			}
+		}
+	}
+
+	routeStore.Lock()
+	// Remember the failing file version so the watcher doesn't retry it in a loop
+	if info != nil {
+		routeStore.modTime = info.ModTime()
+		routeStore.size = info.Size()
+	}
+	routeStore.stats.FailedReloads++
+	routeStore.stats.LastError = err.Error()
+	routeStore.Unlock()
+
+	return fmt.Errorf("failed to load static metadata file: %w", err)
+}
+
+// staticRoutes returns the current route index, loading it on first use.
+func staticRoutes() (*routeIndex, error) {
+	routeStore.RLock()
+	idx := routeStore.index
+	routeStore.RUnlock()
+
+	if idx != nil {
+		return idx, nil
+	}
+
+	if err := LoadStaticRoutes(); err != nil {
+		return nil, err
+	}
+
+	routeStore.RLock()
+	defer routeStore.RUnlock()
+	return routeStore.index, nil
+}
+
+// WatchStaticRoutes polls `static.route.json` and reloads it whenever its
+// modification time or size changes. It never returns.
+func WatchStaticRoutes() {
+	ticker := time.NewTicker(routeReloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(staticRoutePath())
+		if err != nil {
+			continue
+		}
+
+		routeStore.RLock()
+		changed := !info.ModTime().Equal(routeStore.modTime) || info.Size() != routeStore.size
+		routeStore.RUnlock()
+
+		if !changed {
+			continue
+		}
+
+		if err := LoadStaticRoutes(); err != nil {
+			logger.TimedError("keeping previous route metadata,", err.Error())
+			continue
+		}
+		logger.TimedOkay("Reloaded route metadata from `" + staticRoutePath() + "`.")
+	}
+}
+
+// StaticRouteStats reports reload counters for the metrics endpoint.
+func StaticRouteStats() types.RouteMetadataStats {
+	routeStore.RLock()
+	defer routeStore.RUnlock()
+	return routeStore.stats
+}
+
+// StaticPagePaths lists the plain page paths of `static.route.json`, leaving
+// out the `*` defaults, the `#...` error entries and patterns.
+func StaticPagePaths() ([]string, error) {
+	routes, err := staticRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(routes.byPath))
+	for path := range routes.byPath {
+		if strings.HasPrefix(path, "/") {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	return paths, nil
+}
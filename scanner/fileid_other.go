@@ -0,0 +1,10 @@
+//go:build !unix
+
+package scanner
+
+import "io/fs"
+
+// fileID is unavailable here; renames are recognized by quickHash alone.
+func fileID(info fs.FileInfo) (uint64, uint64) {
+	return 0, 0
+}
@@ -0,0 +1,102 @@
+package scanner
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// INFO: Filenames of fansub releases and scanlations carry the series and the
+// episode or chapter, surrounded by release tags:
+//   - [Group] Title - 01 [1080p].mkv
+//   - Title.S01E03.1080p.WEB.mkv
+//   - Title Vol.01 Ch.003.cbz
+
+var (
+	// Release tags such as [Group], [1080p], (BD) and {x265}
+	releaseTags = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)|\{[^}]*\}`)
+	spaces      = regexp.MustCompile(`\s+`)
+
+	// Tried in order, the first match wins. The number is the last group.
+	episodePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bS\d{1,2}\s?E(\d{1,4})(?:v\d)?\b`),
+		regexp.MustCompile(`(?i)\b(?:episode|ep|e)\.?\s?(\d{1,4})(?:v\d)?\b`),
+		regexp.MustCompile(`\s-\s?(\d{1,4})(?:v\d)?\b`),
+		regexp.MustCompile(`(?:^|\s)#?(\d{1,4})(?:v\d)?(?:\s|$)`),
+	}
+
+	volumePattern  = regexp.MustCompile(`(?i)\b(?:volume|vol|v)\.?\s?(\d{1,4})\b`)
+	chapterPattern = regexp.MustCompile(`(?i)\b(?:chapter|ch|c)\.?\s?(\d{1,4}(?:\.\d{1,2})?)\b`)
+	// A bare number at the end, "Title 012"
+	trailingNumber = regexp.MustCompile(`(?:^|\s)-?\s?(\d{1,4}(?:\.\d{1,2})?)$`)
+)
+
+// cleanName strips the extension and release tags off a filename and turns
+// dot or underscore separated names into words.
+func cleanName(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	name = releaseTags.ReplaceAllString(name, " ")
+	name = strings.ReplaceAll(name, "_", " ")
+	if !strings.Contains(strings.TrimSpace(name), " ") {
+		name = strings.ReplaceAll(name, ".", " ")
+	}
+	return strings.TrimSpace(spaces.ReplaceAllString(name, " "))
+}
+
+// cleanTitle trims the separators left between a title and what followed it.
+func cleanTitle(title string) string {
+	return strings.Trim(title, " -_.~")
+}
+
+// ParseEpisode reads the series title and episode number from the filename
+// of an episode. The title is empty when the filename only has a number.
+func ParseEpisode(filename string) (string, int, bool) {
+	name := cleanName(filename)
+
+	for _, pattern := range episodePatterns {
+		match := pattern.FindStringSubmatchIndex(name)
+		if match == nil {
+			continue
+		}
+
+		number, err := strconv.Atoi(name[match[2]:match[3]])
+		if err != nil || number == 0 {
+			continue
+		}
+		return cleanTitle(name[:match[0]]), number, true
+	}
+	return "", 0, false
+}
+
+// ParseChapter reads the series title, volume and chapter from the filename
+// of a manga archive. Volume is zero when not named, chapter is zero for a
+// file holding a whole volume.
+func ParseChapter(filename string) (string, int, float64, bool) {
+	name := cleanName(filename)
+
+	var (
+		volume  int
+		chapter float64
+		end     = len(name)
+	)
+	if match := volumePattern.FindStringSubmatchIndex(name); match != nil {
+		volume, _ = strconv.Atoi(name[match[2]:match[3]])
+		end = min(end, match[0])
+	}
+	if match := chapterPattern.FindStringSubmatchIndex(name); match != nil {
+		chapter, _ = strconv.ParseFloat(name[match[2]:match[3]], 64)
+		end = min(end, match[0])
+	}
+	if volume == 0 && chapter == 0 {
+		if match := trailingNumber.FindStringSubmatchIndex(name); match != nil {
+			chapter, _ = strconv.ParseFloat(name[match[2]:match[3]], 64)
+			end = match[0]
+		}
+	}
+
+	if volume == 0 && chapter == 0 {
+		return "", 0, 0, false
+	}
+	return cleanTitle(name[:end]), volume, chapter, true
+}
@@ -0,0 +1,38 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+)
+
+// Bytes read from each end of a file for its quick hash
+const quickHashSpan = 64 << 10
+
+// quickHash fingerprints a file by its size and the bytes at both ends. It is
+// cheap even for episodes of several gigabytes and tells files apart well
+// enough to recognize one that was moved to another filesystem, where its
+// inode changes.
+func quickHash(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	binary.Write(hash, binary.LittleEndian, size)
+
+	if _, err := io.Copy(hash, io.LimitReader(f, quickHashSpan)); err != nil {
+		return "", err
+	}
+	if size > quickHashSpan {
+		tail := max(quickHashSpan, size-quickHashSpan)
+		if _, err := io.Copy(hash, io.NewSectionReader(f, tail, size-tail)); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
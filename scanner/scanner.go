@@ -0,0 +1,620 @@
+package scanner
+
+import (
+	"LocalDex/api/anime"
+	"LocalDex/api/manga"
+	"LocalDex/api/photo"
+	"LocalDex/db"
+	"LocalDex/logger"
+	"LocalDex/settings"
+	"LocalDex/types"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// INFO: Indexes the folders configured as library roots in place: photos
+// become photos, videos become anime episodes and archives manga chapters.
+// Files are only read again when their size or modification time changed.
+
+// ErrScanRunning is returned when a scan is requested while one is running.
+var ErrScanRunning = errors.New("a library scan is already running")
+
+var (
+	// Held for the duration of a scan
+	running sync.Mutex
+
+	statusMu sync.Mutex
+	status   = types.ScanStatus{Last: []types.ScanResult{}}
+)
+
+// Extensions of the files indexed from photo and anime roots; manga roots
+// index what manga.IsChapterFile accepts.
+var (
+	photoExtensions = []string{
+		".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".tif", ".tiff", ".heic", ".heif", ".avif",
+		".mp4", ".m4v", ".mov", ".webm",
+	}
+	videoExtensions = []string{".mkv", ".mp4", ".m4v", ".webm", ".avi", ".mov", ".ts"}
+)
+
+// Interval returns the configured time between full rescans, zero when they
+// are off.
+func Interval() (time.Duration, error) {
+	raw := settings.Get().Library.ScanInterval
+	if len(raw) == 0 {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid library scan interval %q: %w", raw, err)
+	}
+	if interval < 0 {
+		return 0, fmt.Errorf("invalid library scan interval %q: must not be negative", raw)
+	}
+	return interval, nil
+}
+
+// Roots returns the configured library roots with their item type filled in.
+func Roots() ([]types.LibraryRoot, error) {
+	var roots []types.LibraryRoot
+	for _, root := range settings.Get().Library.Roots {
+		if !filepath.IsAbs(root.Path) {
+			return nil, fmt.Errorf("library root %q must be an absolute path", root.Path)
+		}
+		root.Path = filepath.Clean(root.Path)
+
+		switch root.Kind {
+		case types.MediaPhoto:
+			root.Type = ""
+		case types.MediaAnime:
+			if len(root.Type) == 0 {
+				root.Type = types.AnimeTypeAnime
+			}
+			if root.Type != types.AnimeTypeAnime && root.Type != types.AnimeTypeHentai {
+				return nil, fmt.Errorf("library root %q: anime type must be %s or %s", root.Path, types.AnimeTypeAnime, types.AnimeTypeHentai)
+			}
+		case types.MediaManga:
+			if len(root.Type) == 0 {
+				root.Type = types.MangaTypeManga
+			}
+			if root.Type != types.MangaTypeManga && root.Type != types.MangaTypeDoujin {
+				return nil, fmt.Errorf("library root %q: manga type must be %s or %s", root.Path, types.MangaTypeManga, types.MangaTypeDoujin)
+			}
+		default:
+			return nil, fmt.Errorf("library root %q: kind must be %s, %s or %s", root.Path, types.MediaPhoto, types.MediaAnime, types.MediaManga)
+		}
+
+		for _, other := range roots {
+			if root.Path == other.Path || isWithin(root.Path, other.Path) || isWithin(other.Path, root.Path) {
+				return nil, fmt.Errorf("library roots %q and %q overlap", other.Path, root.Path)
+			}
+		}
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// Prepare validates the library settings.
+func Prepare() error {
+	if _, err := Interval(); err != nil {
+		return err
+	}
+	_, err := Roots()
+	return err
+}
+
+// isWithin reports whether path lies inside dir.
+func isWithin(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Status returns whether a scan is running and the results of the last one.
+func Status() types.ScanStatus {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return status
+}
+
+func setRunning(value bool) {
+	statusMu.Lock()
+	status.Running = value
+	statusMu.Unlock()
+}
+
+// Scan indexes every library root, one after another. A root that can't be
+// read doesn't stop the others; its result carries the error.
+func Scan(ctx context.Context) ([]types.ScanResult, error) {
+	if !running.TryLock() {
+		return nil, ErrScanRunning
+	}
+	defer running.Unlock()
+
+	return scanAll(ctx)
+}
+
+// Start runs a scan in the background.
+func Start() error {
+	if !running.TryLock() {
+		return ErrScanRunning
+	}
+	setRunning(true)
+
+	go func() {
+		defer running.Unlock()
+		if _, err := scanAll(context.Background()); err != nil {
+			logger.TimedError("library scan failed:", err.Error())
+		}
+	}()
+	return nil
+}
+
+func scanAll(ctx context.Context) ([]types.ScanResult, error) {
+	roots, err := Roots()
+	if err != nil {
+		return nil, err
+	}
+
+	setRunning(true)
+	defer setRunning(false)
+
+	results := make([]types.ScanResult, 0, len(roots))
+	for _, root := range roots {
+		result := scanRoot(ctx, root, []scope{{dir: root.Path, recursive: true}})
+		if len(result.Error) != 0 {
+			logger.TimedError("library scan of", root.Path, "failed:", result.Error)
+		} else {
+			logChanges("Scanned", result)
+		}
+		results = append(results, result)
+	}
+
+	statusMu.Lock()
+	status.Last = results
+	statusMu.Unlock()
+	return results, ctx.Err()
+}
+
+// rescanScopes brings parts of the library roots up to date, waiting for a
+// running scan to finish first.
+func rescanScopes(ctx context.Context, roots []types.LibraryRoot, scopes []scope) {
+	running.Lock()
+	defer running.Unlock()
+
+	for _, root := range roots {
+		var within []scope
+		for _, s := range scopes {
+			if s.dir == root.Path || isWithin(s.dir, root.Path) {
+				within = append(within, s)
+			}
+		}
+		if len(within) == 0 {
+			continue
+		}
+
+		result := scanRoot(ctx, root, within)
+		if len(result.Error) != 0 {
+			logger.TimedError("library sync of", root.Path, "failed:", result.Error)
+			continue
+		}
+		logChanges("Synced", result)
+	}
+}
+
+// logChanges reports what a scan changed, if anything.
+func logChanges(verb string, r types.ScanResult) {
+	if r.Added+r.Updated+r.Moved+r.Restored+r.Missing == 0 {
+		return
+	}
+	logger.TimedOkay(fmt.Sprintf("%s %s: %d added, %d updated, %d moved, %d restored, %d offline.",
+		verb, r.Root, r.Added, r.Updated, r.Moved, r.Restored, r.Missing))
+}
+
+// scope is a folder to scan, with or without its subfolders.
+type scope struct {
+	dir       string
+	recursive bool
+}
+
+func (s scope) contains(path string) bool {
+	if s.recursive {
+		return isWithin(path, s.dir)
+	}
+	return filepath.Dir(path) == s.dir
+}
+
+// found is a file seen on disk during a scan.
+type found struct {
+	path          string
+	size          int64
+	modTime       time.Time
+	device, inode uint64
+}
+
+// isHidden reports whether a file or folder is hidden: dotfiles, `.@__thumb`
+// folders of NAS software and the like.
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// scanRoot brings the index of a root in line with the files on disk within
+// the given scopes. New paths are matched against files that disappeared by
+// inode and quick hash first, so a renamed file keeps its item; files that
+// are gone for good are marked offline.
+func scanRoot(ctx context.Context, root types.LibraryRoot, scopes []scope) types.ScanResult {
+	result := types.ScanResult{Root: root.Path, Kind: root.Kind, StartedAt: time.Now().UTC()}
+	defer func() { result.FinishedAt = time.Now().UTC() }()
+
+	// An unmounted share must not take the whole root offline
+	if info, err := os.Stat(root.Path); err != nil {
+		result.Error = err.Error()
+		return result
+	} else if !info.IsDir() {
+		result.Error = "not a directory"
+		return result
+	}
+
+	known, err := db.LibraryFiles(ctx, root.Path)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var (
+		seen  = make(map[string]bool)
+		fresh []found
+	)
+	for _, s := range scopes {
+		err := filepath.WalkDir(s.dir, func(path string, entry fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				// The folder itself was removed or moved away
+				if path == s.dir && errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				// An unreadable folder is skipped, the rest of the root is not
+				logger.TimedWarning("library scan:", err.Error())
+				result.Failed++
+				return nil
+			}
+
+			if entry.IsDir() {
+				if path != s.dir && (!s.recursive || isHidden(entry.Name())) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if isHidden(entry.Name()) || !entry.Type().IsRegular() || !accepts(root.Kind, path) || seen[path] {
+				return nil
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				result.Failed++
+				return nil
+			}
+			seen[path] = true
+
+			f := found{path: path, size: info.Size(), modTime: info.ModTime()}
+			f.device, f.inode = fileID(info)
+
+			file, exists := known[path]
+			if !exists {
+				fresh = append(fresh, f)
+				return nil
+			}
+			return rescan(ctx, root, file, f, &result)
+		})
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+
+	// Files that vanished from the scanned folders, plus those that went
+	// offline earlier and may turn up again under a new name
+	var gone []types.LibraryFile
+	for path, file := range known {
+		if seen[path] {
+			continue
+		}
+		if file.OfflineAt != nil || slices.ContainsFunc(scopes, func(s scope) bool { return s.contains(path) }) {
+			gone = append(gone, file)
+		}
+	}
+
+	byInode := make(map[[2]uint64]int)
+	byHash := make(map[string]int)
+	for i, file := range gone {
+		if file.Inode != 0 {
+			byInode[[2]uint64{file.Device, file.Inode}] = i
+		}
+		if len(file.QuickHash) != 0 {
+			byHash[file.QuickHash] = i
+		}
+	}
+
+	moved := make(map[int]bool)
+	for _, f := range fresh {
+		hash, err := quickHash(f.path, f.size)
+		if err != nil {
+			logger.TimedWarning("library scan: failed to read", f.path, ":", err.Error())
+			result.Failed++
+			continue
+		}
+
+		// A rename keeps the inode and modification time; a move to another
+		// filesystem only the content
+		i, ok := byInode[[2]uint64{f.device, f.inode}]
+		if !ok || f.inode == 0 || gone[i].Size != f.size || !gone[i].ModTime.Equal(f.modTime) {
+			i, ok = byHash[hash]
+		}
+		if ok && !moved[i] {
+			moved[i] = true
+
+			file := gone[i]
+			file.Root, file.Path, file.Size, file.ModTime = root.Path, f.path, f.size, f.modTime
+			file.Device, file.Inode, file.QuickHash = f.device, f.inode, hash
+			if err := db.MoveLibraryFile(ctx, &file); err != nil {
+				result.Error = err.Error()
+				return result
+			}
+			result.Moved++
+			continue
+		}
+
+		itemID, err := index(ctx, root, f.path, 0)
+		if errors.Is(err, errUnrecognized) {
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			logger.TimedWarning("library scan: failed to index", f.path, ":", err.Error())
+			result.Failed++
+			continue
+		}
+		if err := record(ctx, root, f, itemID, hash); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Added++
+	}
+
+	var offline []int64
+	for i, file := range gone {
+		if !moved[i] && file.OfflineAt == nil {
+			offline = append(offline, file.ID)
+		}
+	}
+	if err := db.SetLibraryFilesOffline(ctx, offline, time.Now()); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Missing = len(offline)
+	return result
+}
+
+// rescan handles a file that is already indexed under its path: it is reread
+// when it changed and brought back online when it was offline.
+func rescan(ctx context.Context, root types.LibraryRoot, file types.LibraryFile, f found, result *types.ScanResult) error {
+	unchanged := file.Size == f.size && file.ModTime.Equal(f.modTime)
+
+	if unchanged && file.OfflineAt == nil {
+		// Files indexed before their identity was kept get it now
+		if (file.Inode == 0 && f.inode != 0) || len(file.QuickHash) == 0 {
+			if err := record(ctx, root, f, file.ItemID, ""); err != nil {
+				return err
+			}
+		}
+		result.Unchanged++
+		return nil
+	}
+
+	itemID := file.ItemID
+	if !unchanged {
+		var err error
+		itemID, err = index(ctx, root, f.path, file.ItemID)
+		if errors.Is(err, errUnrecognized) {
+			result.Skipped++
+			return nil
+		}
+		if err != nil {
+			logger.TimedWarning("library scan: failed to index", f.path, ":", err.Error())
+			result.Failed++
+			return nil
+		}
+	}
+
+	if err := record(ctx, root, f, itemID, ""); err != nil {
+		return err
+	}
+	if file.OfflineAt != nil {
+		result.Restored++
+	} else {
+		result.Updated++
+	}
+	return nil
+}
+
+// record saves a file as indexed. The quick hash is computed when not given.
+func record(ctx context.Context, root types.LibraryRoot, f found, itemID int64, hash string) error {
+	if len(hash) == 0 {
+		var err error
+		if hash, err = quickHash(f.path, f.size); err != nil {
+			// Without a hash the file is still indexed, only a move to
+			// another filesystem goes unrecognized
+			logger.TimedWarning("library scan: failed to read", f.path, ":", err.Error())
+		}
+	}
+
+	return db.SaveLibraryFile(ctx, &types.LibraryFile{
+		Root:      root.Path,
+		Path:      f.path,
+		Kind:      root.Kind,
+		ItemID:    itemID,
+		Size:      f.size,
+		ModTime:   f.modTime,
+		Device:    f.device,
+		Inode:     f.inode,
+		QuickHash: hash,
+	})
+}
+
+// accepts reports whether a file belongs in a root of the given kind.
+func accepts(kind string, path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch kind {
+	case types.MediaPhoto:
+		return slices.Contains(photoExtensions, ext)
+	case types.MediaAnime:
+		return slices.Contains(videoExtensions, ext)
+	case types.MediaManga:
+		return manga.IsChapterFile(path)
+	}
+	return false
+}
+
+// errUnrecognized is returned for files whose name doesn't say which episode
+// or chapter they are.
+var errUnrecognized = errors.New("unrecognized filename")
+
+// index adds a file to its library, or rereads it when it was indexed as
+// itemID before, and returns the ID of the item it is.
+func index(ctx context.Context, root types.LibraryRoot, path string, itemID int64) (int64, error) {
+	switch root.Kind {
+	case types.MediaPhoto:
+		if itemID != 0 {
+			p, err := photo.RefreshFile(ctx, itemID, path)
+			if err == nil {
+				return p.ID, nil
+			}
+			if !isNotFound(err) {
+				return 0, err
+			}
+		}
+
+		p, err := photo.IndexFile(ctx, path)
+		if err != nil {
+			return 0, err
+		}
+		return p.ID, nil
+
+	case types.MediaAnime:
+		if itemID != 0 {
+			e, err := anime.RefreshEpisode(ctx, itemID, path)
+			if err == nil {
+				return e.ID, nil
+			}
+			if !isNotFound(err) {
+				return 0, err
+			}
+		}
+
+		title, number, ok := ParseEpisode(path)
+		if !ok {
+			return 0, errUnrecognized
+		}
+		a, err := anime.FindOrCreate(ctx, seriesTitle(root.Path, path, title), root.Type)
+		if err != nil {
+			return 0, err
+		}
+		e, err := anime.IndexEpisode(ctx, a.ID, number, path)
+		if err != nil {
+			return 0, err
+		}
+		return e.ID, nil
+
+	case types.MediaManga:
+		if itemID != 0 {
+			c, err := manga.RefreshChapter(ctx, itemID, path)
+			if err == nil {
+				return c.ID, nil
+			}
+			if !isNotFound(err) {
+				return 0, err
+			}
+		}
+
+		title, volume, chapter, ok := ParseChapter(path)
+		if !ok {
+			// A lone archive in the root is a one-shot, common for doujin
+			if filepath.Dir(path) != root.Path {
+				return 0, errUnrecognized
+			}
+			title, volume = cleanName(path), 1
+		}
+		m, err := manga.FindOrCreate(ctx, seriesTitle(root.Path, path, title), root.Type)
+		if err != nil {
+			return 0, err
+		}
+		c, err := manga.IndexChapter(ctx, m.ID, volume, chapter, path)
+		if err != nil {
+			return 0, err
+		}
+		return c.ID, nil
+	}
+
+	return 0, fmt.Errorf("unknown library kind %q", root.Kind)
+}
+
+// isNotFound reports whether the item a file was indexed as no longer exists.
+func isNotFound(err error) bool {
+	var apiErr *types.APIError
+	return errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound
+}
+
+// seriesTitle names the series a file belongs to: the folder it sits in
+// directly under the root, or the title from its filename when it lies in
+// the root itself.
+func seriesTitle(root string, path string, parsed string) string {
+	rel, err := filepath.Rel(root, path)
+	if err == nil {
+		if folder, _, nested := strings.Cut(rel, string(filepath.Separator)); nested {
+			if title := cleanTitle(releaseTags.ReplaceAllString(folder, " ")); len(title) != 0 {
+				return spaces.ReplaceAllString(title, " ")
+			}
+		}
+	}
+	if len(parsed) != 0 {
+		return parsed
+	}
+	return cleanName(filepath.Base(filepath.Dir(path)))
+}
+
+// Schedule scans the library roots at startup and then every configured
+// interval.
+func Schedule() {
+	interval, err := Interval()
+	if err != nil || len(settings.Get().Library.Roots) == 0 {
+		return
+	}
+
+	for {
+		started := time.Now()
+
+		// Waits for a manual scan or synced changes instead of skipping a turn
+		running.Lock()
+		_, err := scanAll(context.Background())
+		running.Unlock()
+		if err != nil {
+			logger.TimedError("library scan failed:", err.Error())
+		}
+
+		if interval == 0 {
+			return
+		}
+		time.Sleep(time.Until(started.Add(interval)))
+	}
+}
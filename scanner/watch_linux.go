@@ -0,0 +1,251 @@
+//go:build linux
+
+package scanner
+
+import (
+	"LocalDex/logger"
+	"LocalDex/types"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Changes are synced once the library has been quiet this long
+	settleDelay = 2 * time.Second
+	// but no later than this after the first change, for folders that are
+	// written to continuously
+	maxSettleDelay = 30 * time.Second
+	// How often roots that lost their watch, e.g. an unmounted share, are
+	// watched again
+	rewatchInterval = 5 * time.Minute
+
+	// Files are picked up once written and closed, not when created, so a
+	// copy in progress isn't indexed halfway
+	watchMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+		unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+)
+
+// event is an inotify event on a file or folder inside a watched folder.
+type event struct {
+	wd   int
+	mask uint32
+	name string
+}
+
+type watcher struct {
+	fd    int
+	roots []types.LibraryRoot
+	// Watched folder of each watch descriptor
+	watches map[int]string
+	// Whether running out of watches has been reported
+	exhausted bool
+}
+
+// Watch keeps the index of the library roots in sync with files added,
+// changed, renamed or removed directly on disk, such as over the NAS share.
+// Changes are collected per folder and synced once things settle down.
+func Watch() {
+	roots, err := Roots()
+	if err != nil || len(roots) == 0 {
+		return
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		logger.TimedError("failed to watch the library roots:", err.Error())
+		return
+	}
+
+	w := &watcher{fd: fd, roots: roots, watches: make(map[int]string)}
+	for _, root := range roots {
+		w.addTree(root.Path)
+	}
+
+	events := make(chan event, 256)
+	go w.read(events)
+	w.collect(events)
+}
+
+// read decodes inotify events until the descriptor fails.
+func (w *watcher) read(events chan<- event) {
+	defer close(events)
+
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			logger.TimedError("stopped watching the library roots:", err.Error())
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+
+			events <- event{
+				wd:   int(raw.Wd),
+				mask: raw.Mask,
+				name: string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00")),
+			}
+			offset = nameEnd
+		}
+	}
+}
+
+// collect gathers the folders events happened in and syncs them once no
+// event arrived for settleDelay.
+func (w *watcher) collect(events <-chan event) {
+	var (
+		// Folder to sync, and whether its subfolders are included
+		pending = make(map[string]bool)
+		first   time.Time
+		settle  = time.NewTimer(settleDelay)
+		rewatch = time.NewTicker(rewatchInterval)
+	)
+	settle.Stop()
+	defer rewatch.Stop()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			w.handle(e, pending)
+			if len(pending) == 0 {
+				continue
+			}
+			if first.IsZero() {
+				first = time.Now()
+			}
+			settle.Reset(min(settleDelay, time.Until(first.Add(maxSettleDelay))))
+
+		case <-settle.C:
+			scopes := make([]scope, 0, len(pending))
+			for dir, recursive := range pending {
+				scopes = append(scopes, scope{dir: dir, recursive: recursive})
+			}
+			clear(pending)
+			first = time.Time{}
+
+			rescanScopes(context.Background(), w.roots, scopes)
+
+		case <-rewatch.C:
+			for _, root := range w.roots {
+				if !w.isWatched(root.Path) && w.addTree(root.Path) {
+					// Whatever changed while it wasn't watched
+					pending[root.Path] = true
+					settle.Reset(settleDelay)
+				}
+			}
+		}
+	}
+}
+
+// handle records the folder an event affects.
+func (w *watcher) handle(e event, pending map[string]bool) {
+	if e.mask&unix.IN_Q_OVERFLOW != 0 {
+		// Events were lost, only a full rescan can tell what changed
+		logger.TimedWarning("library watch queue overflowed, rescanning the library roots")
+		for _, root := range w.roots {
+			pending[root.Path] = true
+		}
+		return
+	}
+
+	dir, ok := w.watches[e.wd]
+	if !ok {
+		return
+	}
+	if e.mask&unix.IN_IGNORED != 0 {
+		// The folder was removed or its filesystem unmounted
+		delete(w.watches, e.wd)
+		return
+	}
+	if len(e.name) == 0 || isHidden(e.name) {
+		return
+	}
+	path := filepath.Join(dir, e.name)
+
+	if e.mask&unix.IN_ISDIR != 0 {
+		switch {
+		case e.mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+			w.addTree(path)
+		case e.mask&unix.IN_MOVED_FROM != 0:
+			w.removeTree(path)
+		}
+		pending[path] = true
+		return
+	}
+
+	// Created files are synced when closed after writing
+	if e.mask == unix.IN_CREATE {
+		return
+	}
+	if _, ok := pending[dir]; !ok {
+		pending[dir] = false
+	}
+}
+
+// addTree watches a folder and its subfolders, and reports whether the
+// folder itself could be watched.
+func (w *watcher) addTree(dir string) bool {
+	added := false
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if path != dir && isHidden(entry.Name()) {
+			return filepath.SkipDir
+		}
+
+		wd, err := unix.InotifyAddWatch(w.fd, path, watchMask)
+		if errors.Is(err, unix.ENOSPC) {
+			if !w.exhausted {
+				w.exhausted = true
+				logger.TimedWarning("ran out of inotify watches, raise fs.inotify.max_user_watches;",
+					"changes in the remaining folders are only picked up by scheduled scans")
+			}
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return filepath.SkipDir
+		}
+
+		w.watches[wd] = path
+		added = added || path == dir
+		return nil
+	})
+	return added
+}
+
+// isWatched reports whether a folder has a watch.
+func (w *watcher) isWatched(dir string) bool {
+	for _, path := range w.watches {
+		if path == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTree stops watching a folder that was moved away, and its subfolders.
+func (w *watcher) removeTree(dir string) {
+	for wd, path := range w.watches {
+		if path == dir || isWithin(path, dir) {
+			unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watches, wd)
+		}
+	}
+}
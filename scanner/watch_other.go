@@ -0,0 +1,16 @@
+//go:build !linux
+
+package scanner
+
+import (
+	"LocalDex/logger"
+	"LocalDex/settings"
+)
+
+// Watch needs inotify; elsewhere the index is only brought up to date by the
+// scheduled scans.
+func Watch() {
+	if len(settings.Get().Library.Roots) > 0 {
+		logger.TimedWarning("Live library updates are only supported on Linux, relying on scheduled scans.")
+	}
+}
@@ -0,0 +1,109 @@
+package settings
+
+import (
+	"LocalDex/types"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	mu      sync.RWMutex
+	current = Defaults()
+)
+
+// Defaults returns the configuration used for every key that is missing from
+// `server.config.json`.
+func Defaults() types.ServerConfig {
+	return types.ServerConfig{
+		ViteOrigin: "http://localhost:5173",
+		Security: types.SecurityConfig{
+			HSTS:                    "max-age=63072000; includeSubDomains; preload",
+			FrameOptions:            "DENY",
+			ReferrerPolicy:          "strict-origin-when-cross-origin",
+			PermissionsPolicy:       "geolocation=(), microphone=(), camera=()",
+			CrossOriginOpenerPolicy: "same-origin",
+			CSP: types.CSPConfig{
+				ReportOnly: false,
+				ReportURI:  "/api/csp-report",
+				Directives: map[string][]string{
+					"default-src":     {"'self'"},
+					"script-src":      {"'self'"},
+					"style-src":       {"'self'", "'unsafe-inline'"},
+					"img-src":         {"'self'", "data:", "blob:"},
+					"media-src":       {"'self'", "blob:"},
+					"font-src":        {"'self'"},
+					"connect-src":     {"'self'"},
+					"worker-src":      {"'self'"},
+					"manifest-src":    {"'self'"},
+					"object-src":      {"'none'"},
+					"base-uri":        {"'self'"},
+					"form-action":     {"'self'"},
+					"frame-ancestors": {"'none'"},
+				},
+				Routes: []types.CSPRoute{
+					{
+						Prefix: "/api/",
+						Directives: map[string][]string{
+							"default-src":     {"'none'"},
+							"frame-ancestors": {"'none'"},
+						},
+						Replace: true,
+					},
+				},
+			},
+		},
+		// A private NAS has nothing to offer to crawlers
+		Robots: types.RobotsConfig{
+			Rules: []types.RobotsRule{
+				{UserAgent: "*", Disallow: []string{"/"}},
+			},
+		},
+		Sitemap: types.SitemapConfig{
+			Enabled: false,
+		},
+		Backup: types.BackupConfig{
+			Interval: "24h",
+			Keep:     7,
+		},
+		Library: types.LibraryConfig{
+			ScanInterval: "6h",
+		},
+		Trash: types.TrashConfig{
+			Retention: "720h",
+		},
+	}
+}
+
+// Path returns the location of the runtime server configuration file.
+func Path() string {
+	return filepath.Join(os.Getenv("ETC_DIR"), "config", "server.config.json")
+}
+
+// Load reads `server.config.json` on top of the defaults and makes the result
+// available through Get. Keys the file doesn't mention keep their defaults.
+func Load() error {
+	data, err := os.ReadFile(Path())
+	if err != nil {
+		return fmt.Errorf("failed to read server config: %w", err)
+	}
+
+	cfg := Defaults()
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("failed to parse server config: %w", err)
+	}
+
+	mu.Lock()
+	current = cfg
+	mu.Unlock()
+	return nil
+}
+
+// Get returns the currently loaded configuration.
+func Get() types.ServerConfig {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
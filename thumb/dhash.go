@@ -0,0 +1,40 @@
+package thumb
+
+import (
+	"image"
+	"io"
+	"math/bits"
+	"os"
+
+	"golang.org/x/image/draw"
+)
+
+// DHash computes the 64-bit difference hash of an image: it is shrunk to 9x8
+// grey pixels and each bit records whether a pixel is brighter than its right
+// neighbour. Re-encoded, resized or slightly edited copies of a photo end up
+// within a few bits of each other.
+func DHash(path string) (uint64, error) {
+	img, err := decode(func() (io.ReadCloser, error) { return os.Open(path) })
+	if err != nil {
+		return 0, err
+	}
+
+	small := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.BiLinear.Scale(small, small.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	var hash uint64
+	for y := range 8 {
+		for x := range 8 {
+			hash <<= 1
+			if small.GrayAt(x, y).Y > small.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// Distance is the number of bits two hashes differ in.
+func Distance(a uint64, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,489 @@
+package thumb
+
+import (
+	"LocalDex/logger"
+	"LocalDex/mediainfo"
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"sync"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// INFO: Thumbnails are JPEG or WebP. The WebP encoder is lossless, so those
+// are larger than JPEG but keep transparency. Sources may be JPEG, PNG, GIF or
+// WebP files, or such images inside a zip archive, like the pages of a manga
+// chapter.
+
+// Sizes maps the `size` query values to the length of the longest edge.
+var Sizes = map[string]int{
+	"small":  256,
+	"medium": 640,
+	"large":  1280,
+}
+
+// DefaultSize is used when a request doesn't ask for a size.
+const DefaultSize = "medium"
+
+// Formats maps the `format` query values to the MIME type of the thumbnail.
+var Formats = map[string]string{
+	"jpeg": "image/jpeg",
+	"webp": "image/webp",
+}
+
+// DefaultFormat is used when a request doesn't ask for a format.
+const DefaultFormat = "jpeg"
+
+// File name extensions of cached thumbnails, by format
+var extensions = map[string]string{
+	"jpeg": ".jpg",
+	"webp": ".webp",
+}
+
+const jpegQuality = 82
+
+// Largest image that is decoded, in pixels. The header of a small file can
+// claim dimensions that would take gigabytes of memory to decode.
+const maxPixels = 100_000_000
+
+// ErrUnsupported is returned for sources that can't be decoded as an image,
+// such as videos.
+var ErrUnsupported = errors.New("no thumbnail can be made from this file")
+
+// ErrTooLarge is returned for images with more than maxPixels pixels.
+var ErrTooLarge = errors.New("image is too large to decode")
+
+// SizeNames returns the valid `size` values, smallest first.
+func SizeNames() []string {
+	names := make([]string, 0, len(Sizes))
+	for name := range Sizes {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int { return Sizes[a] - Sizes[b] })
+	return names
+}
+
+// Dir returns the directory derived files are cached in.
+func Dir() string {
+	return filepath.Join(os.Getenv("APP_ROOT"), "cache", "thumbs")
+}
+
+// fileKey names the thumbnails of src after the file's path, size and
+// modification time, so a replaced original never serves a stale thumbnail.
+func fileKey(src string, variant string) (string, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(src + "\x00" + strconv.FormatInt(info.Size(), 10) + "\x00" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + "\x00" + variant))
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// cachePath returns where the thumbnail of src is cached. The orientation is
+// part of the name, since it can be edited.
+func cachePath(src string, size string, format string, orientation int) (string, error) {
+	key, err := fileKey(src, strconv.Itoa(orientation))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(Dir(), key[:2], key+"-"+size+extensions[format]), nil
+}
+
+// pagesDir returns the directory the page thumbnails of an archive are cached
+// in, so they can be removed together.
+func pagesDir(archive string) (string, error) {
+	key, err := fileKey(archive, "pages")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(Dir(), key[:2], key), nil
+}
+
+// pageCachePath returns where the thumbnail of an entry of archive is cached.
+func pageCachePath(archive string, entry string, size string, format string) (string, error) {
+	dir, err := pagesDir(archive)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(entry))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+"-"+size+extensions[format]), nil
+}
+
+type job struct {
+	src string
+	// Name of the image inside the zip archive src, empty when src is the image
+	entry       string
+	size        string
+	format      string
+	orientation int
+	dest        string
+	// Nobody waits for background jobs, so their failures are logged instead
+	background bool
+	// Closed once the thumbnail is written or err is set
+	done chan struct{}
+	err  error
+}
+
+var errQueueFull = errors.New("thumbnail queue is full")
+
+var (
+	queue = make(chan *job, 256)
+
+	// Jobs being generated, keyed by their cache path, so concurrent requests
+	// for one thumbnail share the work
+	mu      sync.Mutex
+	pending = map[string]*job{}
+)
+
+// Start launches the worker pool. It should be called once, before any
+// thumbnails are requested.
+func Start() {
+	for range max(1, runtime.NumCPU()/2) {
+		go work()
+	}
+}
+
+func work() {
+	for j := range queue {
+		j.err = generate(j)
+		if j.err != nil && j.background && !errors.Is(j.err, ErrUnsupported) && !errors.Is(j.err, ErrTooLarge) {
+			logger.TimedWarning("failed to generate thumbnail of `"+j.src+"`:", j.err.Error())
+		}
+		finish(j)
+	}
+}
+
+func finish(j *job) {
+	mu.Lock()
+	delete(pending, j.dest)
+	mu.Unlock()
+	close(j.done)
+}
+
+// submit queues a job unless the same thumbnail is already being made, and
+// returns the job that will produce it. Background jobs are dropped when the
+// queue is full, since Get regenerates missing thumbnails on demand anyway.
+func submit(j *job) *job {
+	mu.Lock()
+	if existing, ok := pending[j.dest]; ok {
+		mu.Unlock()
+		return existing
+	}
+	j.done = make(chan struct{})
+	pending[j.dest] = j
+	mu.Unlock()
+
+	if !j.background {
+		queue <- j
+		return j
+	}
+
+	select {
+	case queue <- j:
+	default:
+		j.err = errQueueFull
+		finish(j)
+	}
+	return j
+}
+
+// resolveOrientation reads the orientation from the file itself when the
+// caller doesn't know it (zero).
+func resolveOrientation(src string, orientation int) int {
+	if orientation >= 1 && orientation <= 8 {
+		return orientation
+	}
+	if info, err := mediainfo.Extract(src); err == nil {
+		return info.Orientation
+	}
+	return 1
+}
+
+// Enqueue generates every thumbnail size of src in the background, e.g. right
+// after an upload. Only the default format is made ahead of time. See Get for
+// orientation.
+func Enqueue(src string, orientation int) {
+	orientation = resolveOrientation(src, orientation)
+	for size := range Sizes {
+		dest, err := cachePath(src, size, DefaultFormat, orientation)
+		if err != nil {
+			return
+		}
+		if _, err := os.Stat(dest); err == nil {
+			continue
+		}
+		submit(&job{src: src, size: size, format: DefaultFormat, orientation: orientation, dest: dest, background: true})
+	}
+}
+
+// EnqueuePages generates small thumbnails of the given entries of a zip
+// archive in the background, e.g. the pages of a newly indexed chapter.
+func EnqueuePages(archive string, entries []string) {
+	for _, entry := range entries {
+		dest, err := pageCachePath(archive, entry, "small", DefaultFormat)
+		if err != nil {
+			return
+		}
+		if _, err := os.Stat(dest); err == nil {
+			continue
+		}
+		submit(&job{src: archive, entry: entry, size: "small", format: DefaultFormat, orientation: 1, dest: dest, background: true})
+	}
+}
+
+// Remove deletes every cached thumbnail of src, including those of the pages
+// when it is an archive. It must be called before src itself is deleted, as
+// the cache is keyed by the file's modification time.
+func Remove(src string) {
+	for size := range Sizes {
+		for format := range Formats {
+			for orientation := 1; orientation <= 8; orientation++ {
+				if dest, err := cachePath(src, size, format, orientation); err == nil {
+					os.Remove(dest)
+				}
+			}
+		}
+	}
+	if dir, err := pagesDir(src); err == nil {
+		os.RemoveAll(dir)
+	}
+}
+
+// Get returns the path of the cached thumbnail of src, generating it first
+// when it's missing. Thumbnails are turned upright according to the EXIF
+// orientation (1-8); pass zero to read it from the file.
+func Get(ctx context.Context, src string, size string, format string, orientation int) (string, error) {
+	if err := validate(size, format); err != nil {
+		return "", err
+	}
+
+	orientation = resolveOrientation(src, orientation)
+	dest, err := cachePath(src, size, format, orientation)
+	if err != nil {
+		return "", err
+	}
+	return wait(ctx, &job{src: src, size: size, format: format, orientation: orientation, dest: dest})
+}
+
+// GetPage is Get for an image inside a zip archive, such as a manga page.
+func GetPage(ctx context.Context, archive string, entry string, size string, format string) (string, error) {
+	if err := validate(size, format); err != nil {
+		return "", err
+	}
+
+	dest, err := pageCachePath(archive, entry, size, format)
+	if err != nil {
+		return "", err
+	}
+	return wait(ctx, &job{src: archive, entry: entry, size: size, format: format, orientation: 1, dest: dest})
+}
+
+func validate(size string, format string) error {
+	if _, ok := Sizes[size]; !ok {
+		return fmt.Errorf("unknown thumbnail size %q", size)
+	}
+	if _, ok := Formats[format]; !ok {
+		return fmt.Errorf("unknown thumbnail format %q", format)
+	}
+	return nil
+}
+
+// wait returns the cached thumbnail of j, generating it first when it's
+// missing.
+func wait(ctx context.Context, j *job) (string, error) {
+	if _, err := os.Stat(j.dest); err == nil {
+		return j.dest, nil
+	}
+
+	j = submit(j)
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	if j.err != nil {
+		return "", j.err
+	}
+	return j.dest, nil
+}
+
+// entryReader closes an entry of a zip archive along with the archive.
+type entryReader struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (e entryReader) Close() error {
+	return errors.Join(e.ReadCloser.Close(), e.archive.Close())
+}
+
+// open opens the source image of j.
+func open(j *job) (io.ReadCloser, error) {
+	if len(j.entry) == 0 {
+		return os.Open(j.src)
+	}
+
+	archive, err := zip.OpenReader(j.src)
+	if err != nil {
+		if errors.Is(err, zip.ErrFormat) {
+			return nil, ErrUnsupported
+		}
+		return nil, err
+	}
+	entry, err := archive.Open(j.entry)
+	if err != nil {
+		archive.Close()
+		return nil, err
+	}
+	return entryReader{entry, archive}, nil
+}
+
+// decode reads the image returned by open, which is called twice: the
+// dimensions are checked against maxPixels before the pixels are decoded.
+func decode(open func() (io.ReadCloser, error)) (image.Image, error) {
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	config, _, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil, ErrUnsupported
+		}
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, config.Width, config.Height)
+	}
+
+	f, err = open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, nil
+}
+
+func generate(j *job) error {
+	if _, err := os.Stat(j.dest); err == nil {
+		return nil
+	}
+
+	img, err := decode(func() (io.ReadCloser, error) { return open(j) })
+	if err != nil {
+		return err
+	}
+
+	scaled := orient(scale(img, Sizes[j.size]), j.orientation)
+
+	if err := os.MkdirAll(filepath.Dir(j.dest), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary name, so readers never see a half-written thumbnail
+	tmp, err := os.CreateTemp(filepath.Dir(j.dest), ".thumb-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if j.format == "webp" {
+		err = nativewebp.Encode(tmp, scaled, nil)
+	} else {
+		err = jpeg.Encode(tmp, scaled, &jpeg.Options{Quality: jpegQuality})
+	}
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), j.dest)
+}
+
+// scale fits img into a box of edge x edge pixels, keeping its aspect ratio.
+// Images that already fit are re-encoded as they are, never upscaled.
+func scale(img image.Image, edge int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= edge && h <= edge {
+		return img
+	}
+
+	if w >= h {
+		w, h = edge, max(1, h*edge/w)
+	} else {
+		w, h = max(1, w*edge/h), edge
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation, turning img upright. Orientations 5-8
+// swap width and height.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := range dh {
+		for x := range dw {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // mirrored along the main diagonal
+				sx, sy = y, x
+			case 6: // needs a 90° clockwise turn
+				sx, sy = y, h-1-x
+			case 7: // mirrored along the anti-diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs a 90° counter-clockwise turn
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
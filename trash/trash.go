@@ -0,0 +1,158 @@
+package trash
+
+import (
+	"LocalDex/db"
+	"LocalDex/logger"
+	"LocalDex/settings"
+	"LocalDex/thumb"
+	"LocalDex/types"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How often the trash is checked for items past the retention period
+const purgeInterval = time.Hour
+
+// Retention returns how long deleted items are kept, zero when they are kept
+// until purged by hand.
+func Retention() (time.Duration, error) {
+	raw := settings.Get().Trash.Retention
+	if len(raw) == 0 {
+		return 0, nil
+	}
+
+	retention, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid trash retention %q: %w", raw, err)
+	}
+	if retention < 0 {
+		return 0, fmt.Errorf("invalid trash retention %q: must not be negative", raw)
+	}
+	return retention, nil
+}
+
+// Prepare validates the trash settings.
+func Prepare() error {
+	_, err := Retention()
+	return err
+}
+
+// List returns one page of the trash, most recently deleted first. An empty
+// kind lists photos, anime and manga together.
+func List(ctx context.Context, kind string, q types.ListQuery) (*types.Page[types.TrashItem], error) {
+	items, total, err := db.ListTrash(ctx, kind, q)
+	if err != nil {
+		return nil, err
+	}
+
+	if retention, _ := Retention(); retention > 0 {
+		for i := range items {
+			purgeAt := items[i].DeletedAt.Add(retention)
+			items[i].PurgeAt = &purgeAt
+		}
+	}
+	return types.NewPage(items, q, total), nil
+}
+
+// Restore takes items out of the trash and returns the IDs that were in it.
+func Restore(ctx context.Context, kind string, ids []int64) ([]int64, error) {
+	restored, err := db.RestoreItems(ctx, kind, ids)
+	if restored == nil {
+		restored = []int64{}
+	}
+	return restored, err
+}
+
+// inLibraryRoot reports whether a file lies inside one of the library roots,
+// which are indexed in place and belong to the user.
+func inLibraryRoot(path string) bool {
+	for _, root := range settings.Get().Library.Roots {
+		rel, err := filepath.Rel(filepath.Clean(root.Path), path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Purge permanently deletes items that are in the trash, along with their
+// cached thumbnails and the files no other item uses, and returns the IDs
+// that were purged. Files inside library roots are only forgotten, never
+// deleted. Files that can't be removed are logged; the items are gone either
+// way.
+func Purge(ctx context.Context, kind string, ids []int64) ([]int64, error) {
+	purged, files, err := db.PurgeItems(ctx, kind, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range files {
+		thumb.Remove(path)
+		if inLibraryRoot(path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.TimedWarning("failed to remove purged file", path, ":", err.Error())
+		}
+	}
+
+	if purged == nil {
+		purged = []int64{}
+	}
+	return purged, nil
+}
+
+// purgeBefore purges every item deleted before t and returns how many there
+// were.
+func purgeBefore(ctx context.Context, t time.Time) (int, error) {
+	expired, err := db.TrashedBefore(ctx, t)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for kind, ids := range expired {
+		// Keep each statement well below SQLite's limit on bound parameters
+		for start := 0; start < len(ids); start += 500 {
+			purged, err := Purge(ctx, kind, ids[start:min(start+500, len(ids))])
+			if err != nil {
+				return count, err
+			}
+			count += len(purged)
+		}
+	}
+	return count, nil
+}
+
+// Empty purges everything in the trash and returns how many items it held.
+func Empty(ctx context.Context) (int, error) {
+	// Deletion times have a resolution of seconds
+	return purgeBefore(ctx, time.Now().Add(time.Second))
+}
+
+// Schedule purges items that have been in the trash longer than the
+// retention period, at startup and then every hour.
+func Schedule() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for ; ; <-ticker.C {
+		retention, err := Retention()
+		if err != nil || retention == 0 {
+			continue
+		}
+
+		count, err := purgeBefore(context.Background(), time.Now().Add(-retention))
+		if err != nil {
+			logger.TimedError("failed to purge the trash:", err.Error())
+		}
+		if count > 0 {
+			logger.TimedOkay("Purged", count, "items from the trash.")
+		}
+	}
+}
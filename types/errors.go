@@ -0,0 +1,121 @@
+package types
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// INFO: Stable, machine-readable error codes. The client branches on these, so
+// existing values must never change meaning; add new ones instead.
+const (
+	ErrCodeBadRequest         = "bad_request"
+	ErrCodeValidation         = "validation_failed"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeInvalidCredentials = "invalid_credentials"
+	ErrCodeInvalidOTP         = "invalid_otp"
+	ErrCodeSessionMissing     = "session_missing"
+	ErrCodeSessionInvalid     = "session_invalid"
+	ErrCodeSessionExpired     = "session_expired"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeCSRFFailed         = "csrf_failed"
+	ErrCodeOriginNotAllowed   = "origin_not_allowed"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeRouteNotFound      = "route_not_found"
+	ErrCodeMethodNotAllowed   = "method_not_allowed"
+	ErrCodeRequestTimeout     = "request_timeout"
+	ErrCodeConflict           = "conflict"
+	ErrCodeOffsetMismatch     = "offset_mismatch"
+	ErrCodeGone               = "gone"
+	ErrCodeNSFWLocked         = "nsfw_locked"
+	ErrCodePayloadTooLarge    = "payload_too_large"
+	ErrCodeUnsupportedMedia   = "unsupported_media_type"
+	ErrCodeChecksumMismatch   = "checksum_mismatch"
+	ErrCodeTusVersion         = "unsupported_tus_version"
+	ErrCodeInternal           = "internal_error"
+	ErrCodeUnavailable        = "service_unavailable"
+)
+
+// INFO: A problem with a single input field, reported alongside an APIError
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// INFO: The one error type every API handler returns. It is rendered as an
+// RFC 7807 `application/problem+json` document by util.WriteProblem.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string
+	Details []FieldError
+	// Underlying cause, logged on the server but never sent to the client
+	Cause error
+}
+
+func (e *APIError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%d %s: %s: %v", e.Status, e.Code, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Cause
+}
+
+// WithCause attaches the underlying error for server-side logging.
+func (e *APIError) WithCause(err error) *APIError {
+	e.Cause = err
+	return e
+}
+
+// WithDetails attaches field-level validation errors.
+func (e *APIError) WithDetails(details ...FieldError) *APIError {
+	e.Details = append(e.Details, details...)
+	return e
+}
+
+// NewAPIError builds an APIError; an empty message falls back to the status text.
+func NewAPIError(status int, code string, message string) *APIError {
+	if len(message) == 0 {
+		message = http.StatusText(status)
+	}
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+func ErrBadRequest(message string) *APIError {
+	return NewAPIError(http.StatusBadRequest, ErrCodeBadRequest, message)
+}
+
+func ErrValidation(message string, details ...FieldError) *APIError {
+	return NewAPIError(http.StatusUnprocessableEntity, ErrCodeValidation, message).WithDetails(details...)
+}
+
+func ErrUnauthorized(code string, message string) *APIError {
+	return NewAPIError(http.StatusUnauthorized, code, message)
+}
+
+func ErrForbidden(code string, message string) *APIError {
+	return NewAPIError(http.StatusForbidden, code, message)
+}
+
+func ErrNotFound(message string) *APIError {
+	return NewAPIError(http.StatusNotFound, ErrCodeNotFound, message)
+}
+
+func ErrConflict(message string) *APIError {
+	return NewAPIError(http.StatusConflict, ErrCodeConflict, message)
+}
+
+func ErrGone(message string) *APIError {
+	return NewAPIError(http.StatusGone, ErrCodeGone, message)
+}
+
+func ErrInternal(message string) *APIError {
+	return NewAPIError(http.StatusInternalServerError, ErrCodeInternal, message)
+}
+
+// INFO: Signature shared by every API handler. A returned *APIError is written
+// as-is; any other error becomes a logged 500.
+type APIHandler func(w http.ResponseWriter, r *http.Request) error
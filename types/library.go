@@ -0,0 +1,251 @@
+package types
+
+import "time"
+
+// INFO: Kinds of library items
+const (
+	MediaPhoto = "photo"
+	MediaAnime = "anime"
+	MediaManga = "manga"
+)
+
+// INFO: Item types; hentai and doujin are NSFW and locked behind a session
+const (
+	AnimeTypeAnime  = "anime"
+	AnimeTypeHentai = "hentai"
+	MangaTypeManga  = "manga"
+	MangaTypeDoujin = "doujin"
+)
+
+// INFO: A photo or video in the photo library
+type Photo struct {
+	ID       int64  `json:"id"`
+	Title    string `json:"title"`
+	Caption  string `json:"caption"`
+	FilePath string `json:"-"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	// Length of videos in seconds, zero for photos
+	Duration float64 `json:"duration,omitempty"`
+	Favorite bool    `json:"favorite"`
+	// Hex SHA-256 of the file, empty until it has been hashed
+	SHA256 string `json:"sha256"`
+	// Perceptual difference hash of images, see thumb.DHash
+	DHash *uint64 `json:"-"`
+	// Whether the file was uploaded into the photo store, which owns it, rather
+	// than indexed in place from a library root
+	Stored bool `json:"-"`
+	PhotoMetadata
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// INFO: Capture details of a photo, read from the file on upload and editable
+// afterwards. Orientation uses the EXIF values 1-8, where 1 is upright.
+type PhotoMetadata struct {
+	TakenAt     *time.Time `json:"taken_at"`
+	CameraMake  string     `json:"camera_make"`
+	CameraModel string     `json:"camera_model"`
+	LensModel   string     `json:"lens_model"`
+	Latitude    *float64   `json:"latitude"`
+	Longitude   *float64   `json:"longitude"`
+	Orientation int        `json:"orientation"`
+}
+
+// INFO: Photos that are the same file (Exact) or look alike. Best is the one
+// worth keeping: the largest resolution, then the largest file, then the oldest.
+type DuplicateGroup struct {
+	Exact  bool    `json:"exact"`
+	Best   int64   `json:"best"`
+	Photos []Photo `json:"photos"`
+}
+
+// INFO: A photo album. Smart albums hold every live photo matching Filter,
+// manual ones a hand-picked, ordered list. CoverID is the chosen cover, or the
+// first photo of the album when none was chosen or it left the album.
+type Album struct {
+	ID           int64     `json:"id"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Smart        bool      `json:"smart"`
+	Filter       string    `json:"filter"`
+	CoverPhotoID *int64    `json:"cover_photo_id"`
+	CoverID      *int64    `json:"cover_id"`
+	PhotoCount   int       `json:"photo_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// INFO: Tag namespaces, written before the name as in `genre:action`. Tags
+// may also go without one.
+var TagNamespaces = []string{"artist", "character", "genre", "group", "language", "parody", "series"}
+
+// INFO: A tag shared by photos, anime and manga. An alias stands for the tag
+// in AliasOf and is resolved whenever it is used. Count is the number of items
+// tagged with it.
+type Tag struct {
+	ID        int64     `json:"id"`
+	Tag       string    `json:"tag"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	AliasOf   *int64    `json:"alias_of,omitempty"`
+	Count     int       `json:"count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// INFO: A tag with its aliases, the tags it implies and the tags implying it.
+// Items tagged with a tag are also tagged with everything it implies.
+type TagDetails struct {
+	Tag
+	Aliases   []Tag `json:"aliases"`
+	Implies   []Tag `json:"implies"`
+	ImpliedBy []Tag `json:"implied_by"`
+}
+
+// INFO: An anime or hentai series
+type Anime struct {
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	AltTitles   []string   `json:"alt_titles"` // Other titles, such as the original Japanese one
+	Type        string     `json:"type"`
+	Description string     `json:"description"`
+	CoverPath   string     `json:"-"`
+	Status      string     `json:"status"`
+	ViewCount   int64      `json:"view_count"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// INFO: A video file belonging to an anime
+type AnimeEpisode struct {
+	ID        int64     `json:"id"`
+	AnimeID   int64     `json:"anime_id"`
+	Number    int       `json:"number"`
+	Title     string    `json:"title"`
+	FilePath  string    `json:"-"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	Duration  float64   `json:"duration"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// INFO: A manga or doujin
+type Manga struct {
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	AltTitles   []string   `json:"alt_titles"` // Other titles, such as the original Japanese one
+	Type        string     `json:"type"`
+	Description string     `json:"description"`
+	CoverPath   string     `json:"-"`
+	ReadCount   int64      `json:"read_count"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+// INFO: A file of a manga, usually an archive of pages. Volume is zero when
+// the file doesn't name one, Chapter is zero for a whole volume.
+type MangaChapter struct {
+	ID        int64     `json:"id"`
+	MangaID   int64     `json:"manga_id"`
+	Volume    int       `json:"volume"`
+	Chapter   float64   `json:"chapter"`
+	Title     string    `json:"title"`
+	FilePath  string    `json:"-"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MangaPage is an image of a chapter archive, numbered from 1 in reading
+// order.
+type MangaPage struct {
+	Number int    `json:"number"`
+	Name   string `json:"name"`
+}
+
+// INFO: A file under a library root, indexed in place. ItemID is the photo,
+// anime episode or manga chapter it became, depending on Kind. Device, Inode
+// and QuickHash recognize the file after a rename; OfflineAt is set while it
+// is missing from disk.
+type LibraryFile struct {
+	ID        int64      `json:"id"`
+	Root      string     `json:"root"`
+	Path      string     `json:"path"`
+	Kind      string     `json:"kind"`
+	ItemID    int64      `json:"item_id"`
+	Size      int64      `json:"size"`
+	ModTime   time.Time  `json:"mod_time"`
+	Device    uint64     `json:"-"`
+	Inode     uint64     `json:"-"`
+	QuickHash string     `json:"-"`
+	IndexedAt time.Time  `json:"indexed_at"`
+	OfflineAt *time.Time `json:"offline_at,omitempty"`
+}
+
+// INFO: Outcome of scanning one library root. Moved counts renamed files
+// that kept their item, Restored offline files that came back and Missing
+// files that went offline.
+type ScanResult struct {
+	Root       string    `json:"root"`
+	Kind       string    `json:"kind"`
+	Added      int       `json:"added"`
+	Updated    int       `json:"updated"`
+	Moved      int       `json:"moved"`
+	Restored   int       `json:"restored"`
+	Unchanged  int       `json:"unchanged"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Missing    int       `json:"missing"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// INFO: Whether a scan is running and what the last one found
+type ScanStatus struct {
+	Running bool         `json:"running"`
+	Last    []ScanResult `json:"last"`
+}
+
+// INFO: A deleted photo, anime or manga. PurgeAt is when it will be removed
+// for good, nil when the trash is kept until emptied by hand.
+type TrashItem struct {
+	Kind      string     `json:"kind"`
+	ID        int64      `json:"id"`
+	Title     string     `json:"title"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+func (a *Anime) NSFW() bool {
+	return a.Type == AnimeTypeHentai
+}
+
+func (m *Manga) NSFW() bool {
+	return m.Type == MangaTypeDoujin
+}
+
+// INFO: A search hit. Highlight is the title and Snippet the best matching
+// excerpt of the item, both HTML escaped with the matches wrapped in <mark>.
+// Lower scores rank higher.
+type SearchResult struct {
+	Kind      string  `json:"kind"`
+	ID        int64   `json:"id"`
+	Title     string  `json:"title"`
+	Highlight string  `json:"highlight"`
+	Snippet   string  `json:"snippet"`
+	Score     float64 `json:"score"`
+}
+
+// INFO: One page of search hits, with the number of hits of each kind
+// regardless of the kind searched.
+type SearchResults struct {
+	*Page[SearchResult]
+	Query  string         `json:"query"`
+	Facets map[string]int `json:"facets"`
+}
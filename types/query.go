@@ -0,0 +1,40 @@
+package types
+
+// INFO: Paging and ordering of library listings, parsed from the query string
+// (`?sort=created_desc&limit=50&page=2&filter=beach&type=anime`).
+type ListQuery struct {
+	Sort   string
+	Limit  int
+	Page   int
+	Filter string
+	// Anime/manga type (anime, hentai, manga, doujin); ignored for photos
+	Type string
+}
+
+// Offset is the number of rows skipped before the requested page.
+func (q ListQuery) Offset() int {
+	return (q.Page - 1) * q.Limit
+}
+
+// INFO: One page of a listing, as returned by every list endpoint
+type Page[T any] struct {
+	Items   []T  `json:"items"`
+	Page    int  `json:"page"`
+	Limit   int  `json:"limit"`
+	Total   int  `json:"total"`
+	HasMore bool `json:"has_more"`
+}
+
+// NewPage wraps the rows of a listing together with its paging state.
+func NewPage[T any](items []T, q ListQuery, total int) *Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	return &Page[T]{
+		Items:   items,
+		Page:    q.Page,
+		Limit:   q.Limit,
+		Total:   total,
+		HasMore: q.Offset()+len(items) < total,
+	}
+}
@@ -1,20 +1,70 @@
 package types
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 // INFO: RobotsRule represents the rules for a specific user-agent
 type RobotsRule struct {
-	UserAgent  string
-	Disallow   []string
-	Allow      []string
-	CrawlDelay *int
+	UserAgent  string   `json:"user_agent"`
+	Disallow   []string `json:"disallow,omitempty"`
+	Allow      []string `json:"allow,omitempty"`
+	CrawlDelay *int     `json:"crawl_delay,omitempty"`
 }
 
 // INFO: RobotsConfig holds the entire robots.txt configuration
 type RobotsConfig struct {
-	Rules    []RobotsRule
-	Host     string
-	Sitemaps []string
+	Rules    []RobotsRule `json:"rules"`
+	Host     string       `json:"host,omitempty"`
+	Sitemaps []string     `json:"sitemaps,omitempty"`
+}
+
+// INFO: sitemap.xml is off unless enabled; Dynamic lists the media kinds
+// (photo, anime, manga) whose item pages are included.
+type SitemapConfig struct {
+	Enabled bool     `json:"enabled"`
+	Dynamic []string `json:"dynamic,omitempty"`
+}
+
+// INFO: Scheduled database snapshots under `APP_ROOT/backups`. An empty or
+// zero Interval turns the schedule off; manual backups still work.
+type BackupConfig struct {
+	// Go duration between snapshots, e.g. "24h"
+	Interval string `json:"interval"`
+	// Number of snapshots kept, oldest are removed first
+	Keep int `json:"keep"`
+}
+
+// INFO: Deleted items, and the files that belong to them, are removed for good
+// once they have been in the trash for Retention. Empty or zero keeps them
+// until the trash is emptied by hand.
+type TrashConfig struct {
+	// Go duration, e.g. "720h" for 30 days
+	Retention string `json:"retention"`
+}
+
+// INFO: Folders on disk that are indexed in place instead of uploaded. A full
+// rescan runs at startup and then every ScanInterval; empty turns it off.
+type LibraryConfig struct {
+	Roots []LibraryRoot `json:"roots"`
+	// Go duration between full rescans, e.g. "6h"
+	ScanInterval string `json:"scan_interval"`
+}
+
+// INFO: A folder holding one kind of media (photo, anime or manga). Type is
+// the item type series found in it get: anime/hentai or manga/doujin.
+type LibraryRoot struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	Type string `json:"type,omitempty"`
+}
+
+// INFO: A database snapshot on disk
+type BackupSnapshot struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // INFO: Type of Server Environment
@@ -56,11 +106,23 @@ type LinkTag struct {
 	Title       string `json:"title,omitempty"`
 }
 
+// INFO: A script tag is either external (Src) or inline (Content), never both
+type ScriptTag struct {
+	Src     string `json:"src,omitempty"`
+	Defer   bool   `json:"defer,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
 type RouteMetadata struct {
-	Path  string    `json:"path"`
-	Title string    `json:"title,omitempty"`
-	Meta  []MetaTag `json:"meta,omitempty"`
-	Link  []LinkTag `json:"link,omitempty"`
+	Path   string      `json:"path"`
+	Title  string      `json:"title,omitempty"`
+	Meta   []MetaTag   `json:"meta,omitempty"`
+	Link   []LinkTag   `json:"link,omitempty"`
+	Script []ScriptTag `json:"script,omitempty"`
+
+	// INFO: schema.org JSON-LD objects, rendered as `application/ld+json` scripts
+	StructuredData []map[string]any `json:"structured_data,omitempty"`
 }
 
 type Middleware func(http.Handler) http.Handler
@@ -69,3 +131,52 @@ type MiddlewareChain struct {
 	Handler     http.Handler
 	Middlewares []Middleware
 }
+
+// INFO: Runtime server configuration read from `config/server.config.json`
+type ServerConfig struct {
+	// Origin of the Vite dev server the development shell loads the app from
+	ViteOrigin string         `json:"vite_origin"`
+	Security   SecurityConfig `json:"security"`
+	Robots     RobotsConfig   `json:"robots"`
+	Sitemap    SitemapConfig  `json:"sitemap"`
+	Backup     BackupConfig   `json:"backup"`
+	Library    LibraryConfig  `json:"library"`
+	Trash      TrashConfig    `json:"trash"`
+}
+
+// INFO: Headers applied to every response by the security middleware
+type SecurityConfig struct {
+	HSTS                    string    `json:"hsts"`
+	FrameOptions            string    `json:"frame_options"`
+	ReferrerPolicy          string    `json:"referrer_policy"`
+	PermissionsPolicy       string    `json:"permissions_policy"`
+	CrossOriginOpenerPolicy string    `json:"cross_origin_opener_policy"`
+	CSP                     CSPConfig `json:"csp"`
+	// Origins besides HOST that may send state-changing requests (other hostnames, LAN addresses)
+	TrustedOrigins []string `json:"trusted_origins,omitempty"`
+}
+
+type CSPConfig struct {
+	// Send `Content-Security-Policy-Report-Only` instead of enforcing the policy
+	ReportOnly bool                `json:"report_only"`
+	ReportURI  string              `json:"report_uri,omitempty"`
+	Directives map[string][]string `json:"directives"`
+	Routes     []CSPRoute          `json:"routes,omitempty"`
+}
+
+// INFO: Per-route CSP override, matched by path prefix (longest prefix wins)
+type CSPRoute struct {
+	Prefix     string              `json:"prefix"`
+	Directives map[string][]string `json:"directives"`
+	// Use only these directives instead of merging them into the defaults
+	Replace bool `json:"replace,omitempty"`
+}
+
+// INFO: Reload counters of the cached `static.route.json`
+type RouteMetadataStats struct {
+	Routes        int       `json:"routes"`
+	Reloads       int64     `json:"reloads"`
+	FailedReloads int64     `json:"failed_reloads"`
+	LastReloadAt  time.Time `json:"last_reload_at"`
+	LastError     string    `json:"last_error,omitempty"`
+}
@@ -0,0 +1,35 @@
+package types
+
+import "time"
+
+// INFO: A resumable (tus) upload. Offset grows as chunks arrive; once it
+// reaches Length the file is handed to the library named by Kind in the
+// background and ItemID points at the photo or episode it became. Error says
+// why the last attempt failed.
+type Upload struct {
+	ID        string            `json:"id"`
+	Kind      string            `json:"kind"`
+	Filename  string            `json:"filename"`
+	Metadata  map[string]string `json:"metadata"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	ItemID    *int64            `json:"item_id,omitempty"`
+	Status    string            `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Upload statuses, in the order an upload goes through them
+const (
+	UploadReceiving  = "receiving"
+	UploadProcessing = "processing"
+	UploadFailed     = "failed"
+	UploadDone       = "done"
+)
+
+// Complete reports whether every byte has been received.
+func (u *Upload) Complete() bool {
+	return u.Offset == u.Length
+}
@@ -0,0 +1,148 @@
+package util
+
+import (
+	"LocalDex/types"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// INFO: Bounds of the `limit` and `page` query parameters. The last page
+// keeps the row offset far from overflowing, even on 32-bit platforms.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+	MaxListPage      = 1_000_000
+)
+
+// Most IDs a bulk action accepts at once
+const MaxBulkIDs = 1000
+
+// ParseListQuery reads the paging parameters of a list endpoint. sorts holds
+// the accepted sort keys, the first being the default; kinds the accepted
+// `type` values, if the listing can be narrowed down by type.
+func ParseListQuery(values url.Values, sorts []string, kinds ...string) (types.ListQuery, error) {
+	q := types.ListQuery{
+		Sort:   sorts[0],
+		Limit:  DefaultListLimit,
+		Page:   1,
+		Filter: strings.TrimSpace(values.Get("filter")),
+		Type:   values.Get("type"),
+	}
+
+	var details []types.FieldError
+
+	if v := values.Get("sort"); len(v) != 0 {
+		if !slices.Contains(sorts, v) {
+			details = append(details, types.FieldError{
+				Field:   "sort",
+				Code:    "invalid",
+				Message: "must be one of " + strings.Join(sorts, ", "),
+			})
+		}
+		q.Sort = v
+	}
+
+	if v := values.Get("limit"); len(v) != 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxListLimit {
+			details = append(details, types.FieldError{
+				Field:   "limit",
+				Code:    "out_of_range",
+				Message: "must be a number between 1 and " + strconv.Itoa(MaxListLimit),
+			})
+		}
+		q.Limit = n
+	}
+
+	if v := values.Get("page"); len(v) != 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxListPage {
+			details = append(details, types.FieldError{
+				Field:   "page",
+				Code:    "out_of_range",
+				Message: "must be a number between 1 and " + strconv.Itoa(MaxListPage),
+			})
+		}
+		q.Page = n
+	}
+
+	if len(q.Type) != 0 && len(kinds) != 0 && !slices.Contains(kinds, q.Type) {
+		details = append(details, types.FieldError{
+			Field:   "type",
+			Code:    "invalid",
+			Message: "must be one of " + strings.Join(kinds, ", "),
+		})
+	}
+
+	if len(details) != 0 {
+		return q, types.ErrValidation("Invalid list parameters!", details...)
+	}
+	return q, nil
+}
+
+// ListQueryValues is the inverse of ParseListQuery. Its encoding is stable, so
+// it doubles as the cache key of a listing.
+func ListQueryValues(q types.ListQuery) url.Values {
+	values := url.Values{}
+	values.Set("sort", q.Sort)
+	values.Set("limit", strconv.Itoa(q.Limit))
+	values.Set("page", strconv.Itoa(q.Page))
+	if len(q.Filter) != 0 {
+		values.Set("filter", q.Filter)
+	}
+	if len(q.Type) != 0 {
+		values.Set("type", q.Type)
+	}
+	return values
+}
+
+// FilterError reports a problem with a filter expression, see
+// db.CheckFilter, as a validation error of the `filter` parameter.
+func FilterError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return types.ErrValidation("Invalid filter!", types.FieldError{
+		Field:   "filter",
+		Code:    "invalid",
+		Message: err.Error(),
+	})
+}
+
+// ParseIDs reads a comma separated list of row IDs, e.g. the `ids` parameter
+// of bulk actions. Duplicates are dropped.
+func ParseIDs(raw string, field string) ([]int64, error) {
+	invalid := func(message string) error {
+		return types.ErrValidation("Invalid list of IDs!", types.FieldError{
+			Field:   field,
+			Code:    "invalid",
+			Message: message,
+		})
+	}
+
+	if len(strings.TrimSpace(raw)) == 0 {
+		return nil, invalid("must list at least one ID")
+	}
+
+	// Counted before anything is parsed, so a huge list is turned away cheaply
+	if strings.Count(raw, ",") >= MaxBulkIDs {
+		return nil, invalid("must not list more than " + strconv.Itoa(MaxBulkIDs) + " IDs")
+	}
+
+	parts := strings.Split(raw, ",")
+	ids := make([]int64, 0, len(parts))
+	seen := make(map[int64]bool, len(parts))
+	for _, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, invalid("must be positive numbers separated by commas")
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,88 @@
+package util
+
+import (
+	"LocalDex/thumb"
+	"LocalDex/types"
+	"errors"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// thumbnailOptions reads the `size` and `format` query parameters.
+func thumbnailOptions(r *http.Request) (string, string, error) {
+	size := r.URL.Query().Get("size")
+	if len(size) == 0 {
+		size = thumb.DefaultSize
+	}
+	if _, ok := thumb.Sizes[size]; !ok {
+		return "", "", types.ErrValidation("Invalid thumbnail size!", types.FieldError{
+			Field:   "size",
+			Code:    "invalid",
+			Message: "must be one of " + strings.Join(thumb.SizeNames(), ", "),
+		})
+	}
+
+	format := r.URL.Query().Get("format")
+	if len(format) == 0 {
+		format = thumb.DefaultFormat
+	}
+	if _, ok := thumb.Formats[format]; !ok {
+		formats := make([]string, 0, len(thumb.Formats))
+		for name := range thumb.Formats {
+			formats = append(formats, name)
+		}
+		slices.Sort(formats)
+		return "", "", types.ErrValidation("Invalid thumbnail format!", types.FieldError{
+			Field:   "format",
+			Code:    "invalid",
+			Message: "must be one of " + strings.Join(formats, ", "),
+		})
+	}
+	return size, format, nil
+}
+
+// ServeThumbnail streams the cached thumbnail of a library file, generating it
+// first when it's missing. The size and format come from the `size` and
+// `format` query parameters; see thumb.Get for orientation.
+func ServeThumbnail(w http.ResponseWriter, r *http.Request, src string, orientation int) error {
+	size, format, err := thumbnailOptions(r)
+	if err != nil {
+		return err
+	}
+
+	if len(src) == 0 {
+		return types.ErrNotFound("This item has no file attached!")
+	}
+
+	path, err := thumb.Get(r.Context(), src, size, format, orientation)
+	return serveThumbnail(w, r, path, format, err)
+}
+
+// ServePageThumbnail is ServeThumbnail for an image inside a zip archive, such
+// as a manga page.
+func ServePageThumbnail(w http.ResponseWriter, r *http.Request, archive string, entry string) error {
+	size, format, err := thumbnailOptions(r)
+	if err != nil {
+		return err
+	}
+
+	path, err := thumb.GetPage(r.Context(), archive, entry, size, format)
+	return serveThumbnail(w, r, path, format, err)
+}
+
+func serveThumbnail(w http.ResponseWriter, r *http.Request, path string, format string, err error) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return types.ErrNotFound("The file of this item is missing from the library!").WithCause(err)
+	case errors.Is(err, thumb.ErrUnsupported):
+		return types.NewAPIError(http.StatusUnsupportedMediaType, types.ErrCodeUnsupportedMedia, "No thumbnail can be made from this file!")
+	case errors.Is(err, thumb.ErrTooLarge):
+		return types.NewAPIError(http.StatusUnsupportedMediaType, types.ErrCodeUnsupportedMedia, "This image is too large to make a thumbnail of!").WithCause(err)
+	case err != nil:
+		return types.ErrInternal("Failed to generate thumbnail!").WithCause(err)
+	}
+
+	return ServeLibraryFile(w, r, path, thumb.Formats[format])
+}
@@ -1,15 +1,33 @@
 package util
 
 import (
+	"LocalDex/logger"
 	"LocalDex/types"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 // AddrOf takes a value and returns its address as a pointer.
 func AddrOf[T any](literal T) *T { return &literal }
 
+// CleanTitles trims a list of titles, collapsing inner whitespace, and drops
+// empty and repeated ones.
+func CleanTitles(titles []string) []string {
+	cleaned := []string{}
+	for _, t := range titles {
+		t = strings.Join(strings.Fields(t), " ")
+		if len(t) != 0 && !slices.Contains(cleaned, t) {
+			cleaned = append(cleaned, t)
+		}
+	}
+	return cleaned
+}
+
 func IsValidPort(portStr string) bool {
 	port, err := strconv.Atoi(portStr)
 	if err != nil {
@@ -24,13 +42,56 @@ func WriteJSON(w http.ResponseWriter, status int, data any) {
 	json.NewEncoder(w).Encode(data)
 }
 
-func WriteError(w http.ResponseWriter, statusCode int, errorText string, msg *string) {
-	resp := map[string]any{
-		"error":   errorText,
-		"Message": msg,
+// INFO: RFC 7807 problem details document
+type problem struct {
+	Type     string             `json:"type"`
+	Title    string             `json:"title"`
+	Status   int                `json:"status"`
+	Detail   string             `json:"detail"`
+	Instance string             `json:"instance,omitempty"`
+	Code     string             `json:"code"`
+	Errors   []types.FieldError `json:"errors,omitempty"`
+}
+
+// WriteProblem writes an APIError as `application/problem+json`.
+func WriteProblem(w http.ResponseWriter, r *http.Request, apiErr *types.APIError) {
+	if apiErr.Cause != nil {
+		logger.TimedError(r.Method, r.URL.Path, "failed:\n    "+apiErr.Error())
 	}
 
-	WriteJSON(w, statusCode, resp)
+	resp := problem{
+		Type:     "urn:localdex:problem:" + apiErr.Code,
+		Title:    http.StatusText(apiErr.Status),
+		Status:   apiErr.Status,
+		Detail:   apiErr.Message,
+		Instance: r.URL.Path,
+		Code:     apiErr.Code,
+		Errors:   apiErr.Details,
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// WriteError renders any error returned by a handler. Errors that aren't an
+// APIError are logged and reported as a generic 500 so internals don't leak.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *types.APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = types.ErrInternal("").WithCause(err)
+	}
+	WriteProblem(w, r, apiErr)
+}
+
+// Handle adapts an APIHandler to net/http.
+func Handle(h types.APIHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h(w, r); err != nil {
+			WriteError(w, r, err)
+		}
+	}
 }
 
 func WriteSuccess(w http.ResponseWriter, statusCode int, successText string, msg *string) {
@@ -48,3 +109,100 @@ func Chain(cm types.MiddlewareChain) http.Handler {
 	}
 	return cm.Handler
 }
+
+// MatchPath matches a URL path against a route pattern and returns the named
+// segments. Segments written as `{name}` or `:name` capture a single path
+// segment, and a trailing `*` (or `{name...}`) captures the rest of the path
+// under the key "*" (or name). Everything else must match literally.
+func MatchPath(pattern string, path string) (map[string]string, bool) {
+	patternSegs := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegs := strings.Split(strings.Trim(path, "/"), "/")
+	params := make(map[string]string)
+
+	for i, seg := range patternSegs {
+		isLast := i == len(patternSegs)-1
+
+		if isLast && (seg == "*" || (strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}"))) {
+			name := "*"
+			if seg != "*" {
+				name = strings.TrimSuffix(strings.TrimPrefix(seg, "{"), "...}")
+			}
+			if i >= len(pathSegs) {
+				return nil, false
+			}
+			params[name] = strings.Join(pathSegs[i:], "/")
+			return params, true
+		}
+
+		if i >= len(pathSegs) {
+			return nil, false
+		}
+
+		switch {
+		case strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}"):
+			if len(pathSegs[i]) == 0 {
+				return nil, false
+			}
+			params[seg[1:len(seg)-1]] = pathSegs[i]
+
+		case strings.HasPrefix(seg, ":"):
+			if len(pathSegs[i]) == 0 {
+				return nil, false
+			}
+			params[seg[1:]] = pathSegs[i]
+
+		default:
+			if seg != pathSegs[i] {
+				return nil, false
+			}
+		}
+	}
+
+	if len(pathSegs) != len(patternSegs) {
+		return nil, false
+	}
+	return params, true
+}
+
+// PathID parses a numeric route parameter, answering 404 for anything that
+// can't be a row ID.
+func PathID(r *http.Request, name string) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, types.ErrNotFound("No item with this ID exists!")
+	}
+	return id, nil
+}
+
+// ServeLibraryFile streams a file from the library with Range and
+// If-Modified-Since support. The caller decides how long it may be cached.
+func ServeLibraryFile(w http.ResponseWriter, r *http.Request, path string, mimeType string) error {
+	if len(path) == 0 {
+		return types.ErrNotFound("This item has no file attached!")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return types.ErrNotFound("The file of this item is missing from the library!").WithCause(err)
+		}
+		return types.ErrInternal("Failed to open library file!").WithCause(err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return types.ErrInternal("Failed to stat library file!").WithCause(err)
+	}
+
+	// The API router marks responses as uncacheable for HTTP/1.0 caches; library
+	// files are cacheable, as decided by the caller's Cache-Control.
+	w.Header().Del("Pragma")
+	w.Header().Del("Expires")
+
+	if len(mimeType) != 0 {
+		w.Header().Set("Content-Type", mimeType)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	return nil
+}